@@ -0,0 +1,227 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Command filetransfer sends files to a receiver over tcp or tls and resumes
+// interrupted transfers.
+//
+//	filetransfer receive -port 9000 -dir ./incoming
+//	filetransfer send -host device.local -port 9000 firmware.bin
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/filetransfer"
+	"github.com/ChrIgiSta/go-utils/connection/socket"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "send":
+		err = send(os.Args[2:])
+	case "receive":
+		err = receive(os.Args[2:])
+	default:
+		usage()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: filetransfer send|receive [flags] [files]")
+	os.Exit(2)
+}
+
+func receive(args []string) error {
+	flags := flag.NewFlagSet("receive", flag.ExitOnError)
+	host := flags.String("host", "0.0.0.0", "listen address")
+	port := flags.Uint("port", 9000, "listen port")
+	dir := flags.String("dir", ".", "directory for received files")
+	cert := flags.String("cert", "", "tls certificate (pem), enables tls")
+	key := flags.String("key", "", "tls private key (pem)")
+	_ = flags.Parse(args)
+
+	listenPort, err := portFlag(*port)
+	if err != nil {
+		return err
+	}
+
+	endpoint := filetransfer.NewEndpoint(filetransfer.Config{
+		Directory: *dir,
+		Progress:  printProgress,
+		Received: func(id int, path string, err error) {
+			if err != nil {
+				fmt.Printf("\n%s: %v\n", path, err)
+			} else {
+				fmt.Printf("\n%s: complete\n", path)
+			}
+		},
+	})
+
+	var server *socket.Server
+
+	if *cert != "" {
+		certificate, err := os.ReadFile(*cert)
+		if err != nil {
+			return err
+		}
+		privateKey, err := os.ReadFile(*key)
+		if err != nil {
+			return err
+		}
+
+		server, err = socket.NewServerWithOptions(*host, listenPort, endpoint,
+			connection.Tls, socket.WithCertificate(certificate, privateKey))
+		if err != nil {
+			return err
+		}
+	} else {
+		server = socket.NewTcpServer(*host, listenPort, endpoint)
+	}
+	endpoint.SetTransport(server)
+
+	if err = server.ListenAndServe(); err != nil {
+		return err
+	}
+	defer server.Stop()
+
+	fmt.Printf("receiving on %s:%d into %s\n", *host, *port, *dir)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+
+	return nil
+}
+
+func send(args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	host := flags.String("host", "localhost", "receiver address")
+	port := flags.Uint("port", 9000, "receiver port")
+	retries := flags.Int("retries", 5, "reconnects to resume a transfer")
+	ca := flags.String("ca", "", "ca certificates (pem), enables tls")
+	insecure := flags.Bool("insecure", false, "skip tls server verification")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return fmt.Errorf("no files to send")
+	}
+	receiverPort, err := portFlag(*port)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	for _, path := range flags.Args() {
+		var err error
+
+		for attempt := 0; attempt <= *retries; attempt++ {
+			if attempt > 0 {
+				fmt.Printf("\nretry %d of %d: %v\n", attempt, *retries, err)
+				time.Sleep(time.Second)
+			}
+
+			err = sendFile(ctx, *host, receiverPort, *ca, *insecure, path)
+			if err == nil || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("\n%s: complete\n", path)
+	}
+
+	return nil
+}
+
+func sendFile(ctx context.Context, host string, port uint16, ca string,
+	insecure bool, path string) error {
+
+	endpoint := filetransfer.NewEndpoint(filetransfer.Config{
+		Progress: printProgress,
+	})
+
+	var client *socket.Client
+
+	if ca != "" {
+		caCert, err := os.ReadFile(ca)
+		if err != nil {
+			return err
+		}
+
+		client, err = socket.NewClientWithOptions(host, port, endpoint,
+			connection.Tls, socket.WithRootCA(caCert, !insecure))
+		if err != nil {
+			return err
+		}
+	} else {
+		client = socket.NewTcpClient(host, port, endpoint)
+	}
+	endpoint.SetTransport(filetransfer.ClientTransport(client))
+
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	return endpoint.Send(ctx, 1, path)
+}
+
+func portFlag(port uint) (uint16, error) {
+	if port == 0 || port > math.MaxUint16 {
+		return 0, fmt.Errorf("invalid port %d", port)
+	}
+	return uint16(port), nil
+}
+
+func printProgress(progress filetransfer.Progress) {
+	percent := int64(100)
+	if progress.Size > 0 {
+		percent = progress.Transferred * 100 / progress.Size
+	}
+
+	fmt.Printf("\r%s %s %3d%% (%d/%d bytes)", progress.Direction,
+		progress.Name, percent, progress.Transferred, progress.Size)
+}
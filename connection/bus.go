@@ -0,0 +1,248 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import (
+	"sync"
+	"sync/atomic"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// Filter selects the events a subscriber gets.
+type Filter func(evt Event) bool
+
+// FilterIds passes the events of the given connections.
+func FilterIds(ids ...int) Filter {
+	return func(evt Event) bool {
+		for _, id := range ids {
+			if evt.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterTypes passes the events of the given types.
+func FilterTypes(types ...EventType) Filter {
+	return func(evt Event) bool {
+		for _, eventType := range types {
+			if evt.EventType == eventType {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterMessages passes the messages matching predicate and all other
+// events.
+func FilterMessages(predicate func(message []byte) bool) Filter {
+	return func(evt Event) bool {
+		return evt.EventType != RECEIVED || predicate(evt.Content)
+	}
+}
+
+// Bus is a Handler, which publishes the events of a connection to any number
+// of subscribers. Received messages are published as RECEIVED events.
+type Bus struct {
+	lock        sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events, which pass all its filters. Messages and
+// errors are dropped, while its buffer is full. Connected and disconnected
+// events are never dropped, they wait in an unbounded queue instead.
+type Subscription struct {
+	bus     *Bus
+	events  chan Event
+	filters []Filter
+	dropped atomic.Uint64
+
+	lock sync.Mutex
+	// pending are the events waiting for space in the buffer
+	pending  []Event
+	done     chan struct{}
+	flushing sync.WaitGroup
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Subscribe adds a subscriber with a buffer for size events.
+func (b *Bus) Subscribe(size int, filters ...Filter) *Subscription {
+	sub := &Subscription{
+		bus:     b,
+		events:  make(chan Event, size),
+		filters: filters,
+		done:    make(chan struct{}),
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Close unsubscribes all subscribers.
+func (b *Bus) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for sub := range b.subscribers {
+		sub.close()
+	}
+	b.subscribers = make(map[*Subscription]struct{})
+}
+
+func (b *Bus) Connected(id int) {
+	b.publish(Event{Id: id, EventType: CONNECTED})
+}
+
+// Received publishes a copy of message, as the socket may reuse its buffer.
+// All subscribers share the copy.
+func (b *Bus) Received(id int, message []byte) {
+	b.publish(Event{Id: id, EventType: RECEIVED, Content: append([]byte(nil), message...)})
+}
+
+func (b *Bus) Disconnected(id int) {
+	b.publish(Event{Id: id, EventType: DISCONNECTED})
+}
+
+func (b *Bus) Error(id int, category ErrorCategory, err error) {
+	b.publish(Event{Id: id, EventType: ERROR, Category: category, Err: err})
+}
+
+func (b *Bus) publish(evt Event) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for sub := range b.subscribers {
+		if sub.accepts(evt) {
+			sub.deliver(evt)
+		}
+	}
+}
+
+// Events returns the channel of the subscriber, it is closed on Unsubscribe.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of messages and errors dropped so far. The first
+// drop of a subscriber is logged as warning.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.bus.lock.Lock()
+	defer s.bus.lock.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		s.close()
+	}
+}
+
+// deliver passes evt to the buffer without blocking. Behind pending events
+// messages are dropped and connected or disconnected events queued, so the
+// order holds.
+func (s *Subscription) deliver(evt Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.pending) == 0 {
+		select {
+		case s.events <- evt:
+			return
+		default:
+		}
+	}
+
+	if evt.EventType == CONNECTED || evt.EventType == DISCONNECTED {
+		s.pending = append(s.pending, evt)
+		if len(s.pending) == 1 {
+			s.flushing.Add(1)
+			go s.flush()
+		}
+		return
+	}
+
+	if s.dropped.Add(1) == 1 {
+		_ = log.Warn("bus", "subscriber full, drop event %d of %d", evt.EventType, evt.Id)
+	} else {
+		_ = log.Fine("bus", "drop event %d of %d, subscriber full", evt.EventType, evt.Id)
+	}
+}
+
+// flush moves the pending events to the buffer, until none are left.
+func (s *Subscription) flush() {
+	defer s.flushing.Done()
+
+	for {
+		s.lock.Lock()
+		evt := s.pending[0]
+		s.lock.Unlock()
+
+		select {
+		case s.events <- evt:
+		case <-s.done:
+			return
+		}
+
+		s.lock.Lock()
+		s.pending = s.pending[1:]
+		empty := len(s.pending) == 0
+		if empty {
+			s.pending = nil
+		}
+		s.lock.Unlock()
+
+		if empty {
+			return
+		}
+	}
+}
+
+// close ends the flushing and closes the buffer, the bus is locked.
+func (s *Subscription) close() {
+	close(s.done)
+	s.flushing.Wait()
+	close(s.events)
+}
+
+func (s *Subscription) accepts(evt Event) bool {
+	for _, filter := range s.filters {
+		if !filter(evt) {
+			return false
+		}
+	}
+	return true
+}
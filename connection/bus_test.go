@@ -0,0 +1,120 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	all := bus.Subscribe(8)
+	errs := bus.Subscribe(8, FilterTypes(ERROR))
+	single := bus.Subscribe(8, FilterIds(2), FilterMessages(func(message []byte) bool {
+		return bytes.HasPrefix(message, []byte("cmd:"))
+	}))
+	full := bus.Subscribe(1)
+
+	var handler Handler = bus
+	handler.Connected(1)
+	handler.Connected(2)
+	handler.Received(1, []byte("cmd:stop"))
+	handler.Received(2, []byte("telemetry"))
+	handler.Received(2, []byte("cmd:start"))
+	bus.Error(2, ReadError, errors.New("broken"))
+	handler.Disconnected(2)
+
+	if len(all.Events()) != 7 {
+		t.Error("unexpected events: ", len(all.Events()))
+	}
+	if evt := <-errs.Events(); len(errs.Events()) != 0 || evt.Category != ReadError {
+		t.Error("unexpected error event: ", evt)
+	}
+
+	var types []EventType
+	for len(single.Events()) > 0 {
+		evt := <-single.Events()
+		if evt.Id != 2 {
+			t.Error("unexpected id: ", evt.Id)
+		}
+		if evt.EventType == RECEIVED && string(evt.Content) != "cmd:start" {
+			t.Error("unexpected message: ", string(evt.Content))
+		}
+		types = append(types, evt.EventType)
+	}
+	if len(types) != 4 {
+		t.Error("unexpected events: ", types)
+	}
+
+	// connected and disconnected wait for a full subscriber, in order
+	if full.Dropped() != 4 {
+		t.Error("unexpected dropped: ", full.Dropped())
+	}
+	for _, expected := range []Event{{Id: 1, EventType: CONNECTED},
+		{Id: 2, EventType: CONNECTED}, {Id: 2, EventType: DISCONNECTED}} {
+
+		select {
+		case evt := <-full.Events():
+			if evt.Id != expected.Id || evt.EventType != expected.EventType {
+				t.Error("unexpected event: ", evt)
+			}
+		case <-time.After(time.Second):
+			t.Error("lifecycle event dropped: ", expected)
+		}
+	}
+
+	all.Unsubscribe()
+	all.Unsubscribe()
+	bus.Connected(3)
+	drained := 0
+	for range all.Events() {
+		drained++
+	}
+	if drained != 7 {
+		t.Error("event after unsubscribe")
+	}
+	if len(errs.Events()) != 0 {
+		t.Error("filtered event delivered")
+	}
+
+	// the content is copied, the socket reuses its buffer
+	copied := bus.Subscribe(1)
+	buffer := []byte("first")
+	bus.Received(4, buffer)
+	copy(buffer, "reuse")
+	if evt := <-copied.Events(); string(evt.Content) != "first" {
+		t.Error("content not copied: ", string(evt.Content))
+	}
+
+	bus.Close()
+	if _, ok := <-single.Events(); ok {
+		t.Error("subscription not closed")
+	}
+}
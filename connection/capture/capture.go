@@ -0,0 +1,84 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+type Direction string
+
+const (
+	Rx Direction = "rx"
+	Tx Direction = "tx"
+)
+
+// Record is one framed message as seen by a socket.Client or socket.Server,
+// without the frame delimiter.
+type Record struct {
+	Time      time.Time           `json:"time"`
+	Direction Direction           `json:"dir"`
+	Id        int                 `json:"id"`
+	Protocol  connection.Protocol `json:"proto,omitempty"`
+	Local     string              `json:"local,omitempty"`
+	Remote    string              `json:"remote,omitempty"`
+	Payload   []byte              `json:"payload"`
+}
+
+type Recorder interface {
+	Record(record Record) error
+}
+
+type tee []Recorder
+
+// Tee records to all given recorders, e.g. json lines and pcapng at once.
+func Tee(recorders ...Recorder) Recorder {
+	return tee(recorders)
+}
+
+func (t tee) Record(record Record) error {
+	var errs []error
+
+	for _, recorder := range t {
+		if err := recorder.Record(record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func Filter(records []Record, keep func(record Record) bool) (filtered []Record) {
+	for _, record := range records {
+		if keep(record) {
+			filtered = append(filtered, record)
+		}
+	}
+	return
+}
@@ -0,0 +1,175 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func testRecords() []Record {
+	start := time.Now()
+
+	return []Record{
+		{Time: start, Direction: Rx, Id: 7, Remote: "127.0.0.1:4000",
+			Local: "127.0.0.1:22334", Payload: []byte("first")},
+		{Time: start.Add(100 * time.Millisecond), Direction: Tx, Id: 7,
+			Remote: "127.0.0.1:4000", Payload: []byte("answer")},
+		{Time: start.Add(200 * time.Millisecond), Direction: Rx, Id: 7,
+			Remote: "/tmp/test.sock", Payload: []byte{0x01, 0x02}},
+	}
+}
+
+func TestCaptureJsonRoundtrip(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := NewJsonWriter(buffer)
+
+	for _, record := range testRecords() {
+		if err := writer.Record(record); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if lines := bytes.Count(buffer.Bytes(), []byte("\n")); lines != 3 {
+		t.Error("expected 3 json lines, got ", lines)
+	}
+
+	records, err := NewJsonReader(buffer).ReadAll()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(records) != 3 {
+		t.Error("unexpected record count: ", len(records))
+		t.FailNow()
+	}
+	if records[1].Direction != Tx || string(records[1].Payload) != "answer" {
+		t.Error("unexpected record: ", records[1])
+	}
+	if !bytes.Equal(records[2].Payload, []byte{0x01, 0x02}) {
+		t.Error("binary payload not preserved")
+	}
+}
+
+func TestCapturePcapng(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := NewPcapngWriter(buffer)
+
+	for _, record := range testRecords() {
+		if err := writer.Record(record); err != nil {
+			t.Error(err)
+		}
+	}
+
+	raw := buffer.Bytes()
+	if binary.LittleEndian.Uint32(raw) != pcapngSectionHeader {
+		t.Error("missing section header")
+	}
+
+	// section header, interface description, one packet block per record
+	offset, blocks := 0, 0
+	for offset < len(raw) {
+		blockLen := int(binary.LittleEndian.Uint32(raw[offset+4:]))
+		if blockLen%4 != 0 || offset+blockLen > len(raw) ||
+			binary.LittleEndian.Uint32(raw[offset+blockLen-4:]) != uint32(blockLen) {
+
+			t.Error("invalid block at ", offset)
+			t.FailNow()
+		}
+		offset += blockLen
+		blocks++
+	}
+	if blocks != 5 {
+		t.Error("unexpected block count: ", blocks)
+	}
+
+	// payload of the first packet behind the ip and udp header
+	packet := raw[28+20+28:]
+	if !bytes.Equal(packet[28:33], []byte("first")) {
+		t.Error("unexpected payload: ", string(packet[28:33]))
+	}
+	if !bytes.Equal(packet[12:16], []byte{127, 0, 0, 1}) {
+		t.Error("unexpected source ip: ", packet[12:16])
+	}
+}
+
+func TestCaptureReplayToHandler(t *testing.T) {
+	msgCh := make(chan connection.Message, 3)
+	evtCh := make(chan connection.Event, 3)
+
+	start := time.Now()
+	err := NewReplayer(2).ToHandler(context.Background(), testRecords(),
+		connection.NewEventsToChannel(msgCh, evtCh))
+	if err != nil {
+		t.Error(err)
+	}
+
+	// 200ms of capture replayed twice as fast
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond ||
+		elapsed > time.Second {
+
+		t.Error("unexpected replay duration: ", elapsed)
+	}
+
+	if len(msgCh) != 2 {
+		t.Error("expected the two received messages, got ", len(msgCh))
+	}
+	if msg := <-msgCh; string(msg.Content) != "first" || msg.Id != 7 {
+		t.Error("unexpected message: ", msg)
+	}
+
+	if evt := <-evtCh; evt.EventType != connection.CONNECTED {
+		t.Error("expected connected event first")
+	}
+	if evt := <-evtCh; evt.EventType != connection.DISCONNECTED {
+		t.Error("expected disconnected event last")
+	}
+}
+
+func TestCaptureReplayCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var sent int
+	err := NewReplayer(1).ToSender(ctx, testRecords(), senderFunc(func(msg []byte) error {
+		sent++
+		return nil
+	}))
+	if err == nil || sent != 0 {
+		t.Error("replay not canceled: ", err, sent)
+	}
+}
+
+type senderFunc func(msg []byte) error
+
+func (f senderFunc) Send(msg []byte) error {
+	return f(msg)
+}
@@ -0,0 +1,114 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// JsonWriter records in the JSON Lines format, one record per line with a
+// base64 encoded payload.
+type JsonWriter struct {
+	lock    sync.Mutex
+	writer  io.Writer
+	encoder *json.Encoder
+}
+
+func NewJsonWriter(writer io.Writer) *JsonWriter {
+	return &JsonWriter{
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+func CreateJsonFile(path string) (*JsonWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJsonWriter(file), nil
+}
+
+func (w *JsonWriter) Record(record Record) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.encoder.Encode(record)
+}
+
+func (w *JsonWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if closer, ok := w.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+type JsonReader struct {
+	decoder *json.Decoder
+}
+
+func NewJsonReader(reader io.Reader) *JsonReader {
+	return &JsonReader{
+		decoder: json.NewDecoder(reader),
+	}
+}
+
+// Next returns the next record or io.EOF at the end of the capture.
+func (r *JsonReader) Next() (record Record, err error) {
+	err = r.decoder.Decode(&record)
+	return
+}
+
+func (r *JsonReader) ReadAll() (records []Record, err error) {
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func ReadJsonFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return NewJsonReader(file).ReadAll()
+}
@@ -0,0 +1,203 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// pcapng block types and the raw ip link type, see
+// https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-02.html
+const (
+	pcapngSectionHeader  uint32 = 0x0A0D0D0A
+	pcapngInterfaceDesc  uint32 = 0x00000001
+	pcapngEnhancedPacket uint32 = 0x00000006
+	pcapngByteOrderMagic uint32 = 0x1A2B3C4D
+	linkTypeRaw          uint16 = 101
+
+	ipv4HeaderLen = 20
+	udpHeaderLen  = 8
+	maxPayloadLen = 0xFFFF - ipv4HeaderLen - udpHeaderLen
+)
+
+// PcapngWriter records every message as a udp datagram with synthetic ip and
+// udp headers, so captures can be inspected with wireshark. Addresses which
+// are not ipv4 (unix sockets, ipv6) are mapped to 10.0.0.0/8 addresses derived
+// from the connection. Payloads larger than a datagram are truncated.
+type PcapngWriter struct {
+	lock   sync.Mutex
+	writer io.Writer
+	header bool
+}
+
+func NewPcapngWriter(writer io.Writer) *PcapngWriter {
+	return &PcapngWriter{
+		writer: writer,
+	}
+}
+
+func CreatePcapngFile(path string) (*PcapngWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPcapngWriter(file), nil
+}
+
+func (w *PcapngWriter) Record(record Record) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.header {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+		w.header = true
+	}
+
+	payload := record.Payload
+	if len(payload) > maxPayloadLen {
+		payload = payload[:maxPayloadLen]
+	}
+
+	remoteIp, remotePort := endpoint(record.Remote, record.Id, 2)
+	localIp, localPort := endpoint(record.Local, 0, 1)
+
+	src, dst := remoteIp, localIp
+	srcPort, dstPort := remotePort, localPort
+	if record.Direction == Tx {
+		src, dst = localIp, remoteIp
+		srcPort, dstPort = localPort, remotePort
+	}
+
+	packet := make([]byte, ipv4HeaderLen+udpHeaderLen+len(payload))
+	writeIpv4Header(packet, src, dst, udpHeaderLen+len(payload))
+
+	udp := packet[ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:], srcPort)
+	binary.BigEndian.PutUint16(udp[2:], dstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+len(payload)))
+	copy(udp[udpHeaderLen:], payload)
+
+	originalLen := ipv4HeaderLen + udpHeaderLen + len(record.Payload)
+	micros := uint64(record.Time.UnixMicro())
+	padded := (len(packet) + 3) &^ 3
+	blockLen := uint32(32 + padded)
+
+	block := make([]byte, blockLen)
+	binary.LittleEndian.PutUint32(block[0:], pcapngEnhancedPacket)
+	binary.LittleEndian.PutUint32(block[4:], blockLen)
+	binary.LittleEndian.PutUint32(block[8:], 0)
+	binary.LittleEndian.PutUint32(block[12:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(block[16:], uint32(micros))
+	binary.LittleEndian.PutUint32(block[20:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(block[24:], uint32(originalLen))
+	copy(block[28:], packet)
+	binary.LittleEndian.PutUint32(block[blockLen-4:], blockLen)
+
+	_, err := w.writer.Write(block)
+	return err
+}
+
+func (w *PcapngWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if closer, ok := w.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (w *PcapngWriter) writeHeader() error {
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngSectionHeader)
+	binary.LittleEndian.PutUint32(shb[4:], 28)
+	binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], ^uint64(0))
+	binary.LittleEndian.PutUint32(shb[24:], 28)
+
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], pcapngInterfaceDesc)
+	binary.LittleEndian.PutUint32(idb[4:], 20)
+	binary.LittleEndian.PutUint16(idb[8:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[12:], 0xFFFF)
+	binary.LittleEndian.PutUint32(idb[16:], 20)
+
+	_, err := w.writer.Write(append(shb, idb...))
+	return err
+}
+
+func writeIpv4Header(packet []byte, src, dst net.IP, payloadLen int) {
+	packet[0] = 0x45
+	binary.BigEndian.PutUint16(packet[2:], uint16(ipv4HeaderLen+payloadLen))
+	packet[8] = 64
+	packet[9] = 17 // udp
+	copy(packet[12:16], src.To4())
+	copy(packet[16:20], dst.To4())
+
+	var sum uint32
+	for i := 0; i < ipv4HeaderLen; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	binary.BigEndian.PutUint16(packet[10:], ^uint16(sum))
+}
+
+// endpoint maps an address to an ipv4 address and port. Unknown addresses get
+// a stable 10.x.y.z address derived from the address and the connection id.
+func endpoint(address string, id int, fallbackHost byte) (net.IP, uint16) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err == nil {
+		ip := net.ParseIP(host)
+		port, perr := strconv.ParseUint(portStr, 10, 16)
+		if ip != nil && ip.To4() != nil && perr == nil {
+			return ip.To4(), uint16(port)
+		}
+	}
+
+	if address == "" && id == 0 {
+		return net.IPv4(10, 0, 0, fallbackHost).To4(), 1
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(address + "#" + strconv.Itoa(id)))
+	sum := hash.Sum32()
+
+	return net.IPv4(10, byte(sum>>16), byte(sum>>8), fallbackHost).To4(),
+		uint16(1024 + sum%60000)
+}
@@ -0,0 +1,132 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package capture
+
+import (
+	"context"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// Sender is the sending side of a live connection, e.g. a socket.Client.
+type Sender interface {
+	Send(msg []byte) error
+}
+
+// Replayer feeds captured records back with their original timing divided
+// by Speed. A Speed of 2 replays twice as fast, zero or below replays without
+// any delay.
+type Replayer struct {
+	Speed float64
+}
+
+func NewReplayer(speed float64) *Replayer {
+	return &Replayer{
+		Speed: speed,
+	}
+}
+
+// ToHandler replays the received (Rx) records into a handler. Every connection
+// id gets a Connected call before its first message and a Disconnected call
+// after the last record.
+func (r *Replayer) ToHandler(ctx context.Context, records []Record,
+	handler connection.Handler) error {
+
+	var connected []int
+	seen := make(map[int]bool)
+
+	defer func() {
+		for _, id := range connected {
+			handler.Disconnected(id)
+		}
+	}()
+
+	return r.replay(ctx, records, func(record Record) error {
+		if !seen[record.Id] {
+			seen[record.Id] = true
+			connected = append(connected, record.Id)
+			handler.Connected(record.Id)
+		}
+		handler.Received(record.Id, record.Payload)
+		return nil
+	})
+}
+
+// ToSender sends the received (Rx) records to a live peer. Use Filter to pick
+// a single connection out of a server capture.
+func (r *Replayer) ToSender(ctx context.Context, records []Record,
+	sender Sender) error {
+
+	return r.replay(ctx, records, func(record Record) error {
+		return sender.Send(record.Payload)
+	})
+}
+
+func (r *Replayer) replay(ctx context.Context, records []Record,
+	deliver func(record Record) error) error {
+
+	var first time.Time
+	start := time.Now()
+
+	for _, record := range records {
+		if record.Direction != Rx {
+			continue
+		}
+
+		if first.IsZero() {
+			first = record.Time
+		}
+
+		if r.Speed > 0 {
+			offset := time.Duration(float64(record.Time.Sub(first)) / r.Speed)
+			wait := time.Until(start.Add(offset))
+
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_ = log.Fine("capture", "replay %d bytes of %d", len(record.Payload), record.Id)
+
+		if err := deliver(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// Direction selects which data direction of a wrapped connection is affected
+// by the injected faults.
+type Direction int
+
+const (
+	Outbound Direction = iota
+	Inbound
+	Both
+)
+
+const DefaultReorderDelay = 20 * time.Millisecond
+
+var ErrInjectedDisconnect = errors.New("chaos: injected disconnect")
+
+// Config describes the faults an Injector applies. Rates are probabilities
+// in the range [0, 1] evaluated per read or write call. A zero value injects
+// nothing.
+type Config struct {
+	// Seed for the random source. Zero picks a time based seed, which is
+	// logged and available through Injector.Seed() to reproduce a run.
+	Seed      int64
+	Direction Direction
+
+	Latency time.Duration
+	Jitter  time.Duration
+	// Bandwidth limit in bytes per second, zero is unlimited.
+	Bandwidth int
+
+	// DropRate drops a datagram, or a whole write call on stream
+	// connections (one framed message on socket connections).
+	DropRate    float64
+	CorruptRate float64
+
+	// ReorderRate delays outgoing datagrams by ReorderDelay so that later
+	// ones overtake them. Only used on packet connections.
+	ReorderRate  float64
+	ReorderDelay time.Duration
+
+	// DisconnectAfter closes a connection once the given amount of bytes
+	// went through it, zero disables it. DisconnectRate closes it at random.
+	// Both are only applied to connections, not to packet listeners.
+	DisconnectAfter int64
+	DisconnectRate  float64
+}
+
+type Stats struct {
+	Dropped     uint64
+	Corrupted   uint64
+	Reordered   uint64
+	Disconnects uint64
+}
+
+// Injector wraps connections and applies the configured faults. It
+// implements connection.ConnWrapper, so it can be handed to socket.Client
+// and socket.Server.
+type Injector struct {
+	config Config
+	seed   int64
+	lock   sync.Mutex
+	rng    *rand.Rand
+
+	dropped     atomic.Uint64
+	corrupted   atomic.Uint64
+	reordered   atomic.Uint64
+	disconnects atomic.Uint64
+}
+
+func NewInjector(config Config) *Injector {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		_ = log.Info("chaos", "random seed %d", seed)
+	}
+	if config.ReorderDelay <= 0 {
+		config.ReorderDelay = DefaultReorderDelay
+	}
+
+	return &Injector{
+		config: config,
+		seed:   seed,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (i *Injector) Seed() int64 {
+	return i.seed
+}
+
+func (i *Injector) Stats() Stats {
+	return Stats{
+		Dropped:     i.dropped.Load(),
+		Corrupted:   i.corrupted.Load(),
+		Reordered:   i.reordered.Load(),
+		Disconnects: i.disconnects.Load(),
+	}
+}
+
+func (i *Injector) WrapConn(conn net.Conn) net.Conn {
+	if conn == nil {
+		return nil
+	}
+
+	return &Conn{
+		Conn:     conn,
+		injector: i,
+		packet:   isPacketNetwork(conn.LocalAddr()),
+	}
+}
+
+func (i *Injector) WrapPacketConn(conn net.PacketConn) net.PacketConn {
+	if conn == nil {
+		return nil
+	}
+
+	return &PacketConn{
+		PacketConn: conn,
+		injector:   i,
+	}
+}
+
+func (i *Injector) outbound() bool {
+	return i.config.Direction == Outbound || i.config.Direction == Both
+}
+
+func (i *Injector) inbound() bool {
+	return i.config.Direction == Inbound || i.config.Direction == Both
+}
+
+func (i *Injector) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.rng.Float64() < rate
+}
+
+// wait blocks for the latency, jitter and the transmission time of n bytes.
+func (i *Injector) wait(n int) {
+	delay := i.config.Latency
+
+	if i.config.Jitter > 0 {
+		i.lock.Lock()
+		delay += time.Duration(i.rng.Int63n(int64(2*i.config.Jitter))) - i.config.Jitter
+		i.lock.Unlock()
+	}
+	if i.config.Bandwidth > 0 {
+		delay += time.Duration(int64(n) * int64(time.Second) / int64(i.config.Bandwidth))
+	}
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// corrupt flips one random bit. The input is not modified.
+func (i *Injector) corrupt(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+
+	i.lock.Lock()
+	pos := i.rng.Intn(len(b))
+	bit := byte(1 << uint(i.rng.Intn(8)))
+	i.lock.Unlock()
+
+	corrupted := make([]byte, len(b))
+	copy(corrupted, b)
+	corrupted[pos] ^= bit
+
+	i.corrupted.Add(1)
+
+	return corrupted
+}
+
+func isPacketNetwork(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+
+	switch addr.Network() {
+	case "udp", "udp4", "udp6", "unixgram", "ip", "ip4", "ip6":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package chaos
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func udpPair(t *testing.T) (client net.Conn, server net.PacketConn) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	client, err = net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return
+}
+
+func TestChaosDrop(t *testing.T) {
+	client, server := udpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	injector := NewInjector(Config{Seed: 1, DropRate: 1})
+	faulty := injector.WrapConn(client)
+
+	for i := 0; i < 5; i++ {
+		if _, err := faulty.Write([]byte("lost")); err != nil {
+			t.Error(err)
+		}
+	}
+
+	buffer := make([]byte, 64)
+	_ = server.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if n, _, err := server.ReadFrom(buffer); err == nil {
+		t.Error("unexpected rx: ", string(buffer[:n]))
+	}
+
+	if injector.Stats().Dropped != 5 {
+		t.Error("unexpected drop count: ", injector.Stats().Dropped)
+	}
+}
+
+func TestChaosReorder(t *testing.T) {
+	client, server := udpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	faulty := NewInjector(Config{Seed: 1, ReorderRate: 1}).WrapConn(client)
+
+	if _, err := faulty.Write([]byte("first")); err != nil {
+		t.Error(err)
+	}
+	if _, err := client.Write([]byte("second")); err != nil {
+		t.Error(err)
+	}
+
+	buffer := make([]byte, 64)
+	_ = server.SetReadDeadline(time.Now().Add(time.Second))
+	for _, expected := range []string{"second", "first"} {
+		n, _, err := server.ReadFrom(buffer)
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if string(buffer[:n]) != expected {
+			t.Error("unexpected order, got: ", string(buffer[:n]))
+		}
+	}
+}
+
+func TestChaosCorruptReproducible(t *testing.T) {
+	payload := []byte("reproducible payload")
+
+	first := NewInjector(Config{Seed: 42}).corrupt(payload)
+	second := NewInjector(Config{Seed: 42}).corrupt(payload)
+
+	if !bytes.Equal(first, second) {
+		t.Error("same seed, different corruption")
+	}
+	if bytes.Equal(first, payload) {
+		t.Error("payload not corrupted")
+	}
+	if string(payload) != "reproducible payload" {
+		t.Error("input modified")
+	}
+}
+
+func TestChaosDisconnectAfter(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			if _, err := remote.Read(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	injector := NewInjector(Config{Seed: 1, DisconnectAfter: 10})
+	faulty := injector.WrapConn(local)
+
+	n, err := faulty.Write([]byte("12345678"))
+	if err != nil || n != 8 {
+		t.Error("first write: ", n, err)
+	}
+
+	n, err = faulty.Write([]byte("12345678"))
+	if !errors.Is(err, ErrInjectedDisconnect) || n != 2 {
+		t.Error("second write: ", n, err)
+	}
+
+	if _, err = local.Write([]byte("x")); err == nil {
+		t.Error("connection still open")
+	}
+	if injector.Stats().Disconnects != 1 {
+		t.Error("unexpected disconnect count: ", injector.Stats().Disconnects)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	go func() {
+		buffer := make([]byte, 64)
+		for {
+			if _, err := remote.Read(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	faulty := NewInjector(Config{Seed: 1, Latency: 50 * time.Millisecond,
+		Bandwidth: 1000}).WrapConn(local)
+
+	start := time.Now()
+	if _, err := faulty.Write(make([]byte, 100)); err != nil {
+		t.Error(err)
+	}
+
+	// 50ms latency + 100ms transmission at 1000 bytes/s
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Error("write too fast: ", elapsed)
+	}
+}
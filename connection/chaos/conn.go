@@ -0,0 +1,241 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package chaos
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn applies the faults of its Injector to a net.Conn.
+type Conn struct {
+	net.Conn
+	injector *Injector
+
+	packet    bool
+	lock      sync.Mutex
+	bytes     int64
+	cutOff    bool
+	closeOnce sync.Once
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	i := c.injector
+
+	if !i.outbound() {
+		return c.Conn.Write(b)
+	}
+
+	allowed, err := c.account(len(b))
+	if allowed < len(b) {
+		if allowed > 0 {
+			_, _ = c.Conn.Write(b[:allowed])
+		}
+		c.disconnect()
+		return allowed, err
+	}
+
+	i.wait(len(b))
+
+	if i.chance(i.config.DropRate) {
+		i.dropped.Add(1)
+		return len(b), nil
+	}
+
+	out := b
+	if i.chance(i.config.CorruptRate) {
+		out = i.corrupt(b)
+	}
+
+	if c.packet && i.chance(i.config.ReorderRate) {
+		i.reordered.Add(1)
+
+		delayed := make([]byte, len(out))
+		copy(delayed, out)
+		time.AfterFunc(i.config.ReorderDelay, func() {
+			_, _ = c.Conn.Write(delayed)
+		})
+		return len(b), nil
+	}
+
+	n, err := c.Conn.Write(out)
+	if n > len(b) {
+		n = len(b)
+	}
+	return n, err
+}
+
+func (c *Conn) Read(b []byte) (n int, err error) {
+	i := c.injector
+
+	if !i.inbound() {
+		return c.Conn.Read(b)
+	}
+
+	for {
+		n, err = c.Conn.Read(b)
+		if n == 0 {
+			return
+		}
+
+		allowed, cutErr := c.account(n)
+		if allowed < n {
+			c.disconnect()
+			return allowed, cutErr
+		}
+
+		i.wait(n)
+
+		if c.packet && i.chance(i.config.DropRate) {
+			i.dropped.Add(1)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if i.chance(i.config.CorruptRate) {
+			copy(b[:n], i.corrupt(b[:n]))
+		}
+		return
+	}
+}
+
+// NetConn returns the wrapped connection, in the same manner as tls.Conn.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// account registers n transferred bytes and returns how many of them may
+// pass before an injected disconnect.
+func (c *Conn) account(n int) (int, error) {
+	i := c.injector
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cutOff {
+		return 0, ErrInjectedDisconnect
+	}
+
+	if i.chance(i.config.DisconnectRate) {
+		c.cutOff = true
+		return 0, ErrInjectedDisconnect
+	}
+
+	if i.config.DisconnectAfter > 0 &&
+		c.bytes+int64(n) > i.config.DisconnectAfter {
+
+		allowed := int(i.config.DisconnectAfter - c.bytes)
+		c.bytes = i.config.DisconnectAfter
+		c.cutOff = true
+		return allowed, ErrInjectedDisconnect
+	}
+
+	c.bytes += int64(n)
+	return n, nil
+}
+
+func (c *Conn) disconnect() {
+	c.closeOnce.Do(func() {
+		c.injector.disconnects.Add(1)
+		_ = c.Conn.Close()
+	})
+}
+
+// PacketConn applies the faults of its Injector to a net.PacketConn. Forced
+// disconnects are not applied, as closing a packet listener would affect
+// every peer.
+type PacketConn struct {
+	net.PacketConn
+	injector *Injector
+}
+
+// NetPacketConn returns the wrapped packet connection.
+func (p *PacketConn) NetPacketConn() net.PacketConn {
+	return p.PacketConn
+}
+
+func (p *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	i := p.injector
+
+	if !i.outbound() {
+		return p.PacketConn.WriteTo(b, addr)
+	}
+
+	i.wait(len(b))
+
+	if i.chance(i.config.DropRate) {
+		i.dropped.Add(1)
+		return len(b), nil
+	}
+
+	out := b
+	if i.chance(i.config.CorruptRate) {
+		out = i.corrupt(b)
+	}
+
+	if i.chance(i.config.ReorderRate) {
+		i.reordered.Add(1)
+
+		delayed := make([]byte, len(out))
+		copy(delayed, out)
+		time.AfterFunc(i.config.ReorderDelay, func() {
+			_, _ = p.PacketConn.WriteTo(delayed, addr)
+		})
+		return len(b), nil
+	}
+
+	return p.PacketConn.WriteTo(out, addr)
+}
+
+func (p *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	i := p.injector
+
+	if !i.inbound() {
+		return p.PacketConn.ReadFrom(b)
+	}
+
+	for {
+		n, addr, err = p.PacketConn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		i.wait(n)
+
+		if i.chance(i.config.DropRate) {
+			i.dropped.Add(1)
+			continue
+		}
+
+		if i.chance(i.config.CorruptRate) {
+			copy(b[:n], i.corrupt(b[:n]))
+		}
+		return
+	}
+}
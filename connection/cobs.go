@@ -0,0 +1,75 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import "errors"
+
+var ErrCobsMalformed = errors.New("malformed cobs data")
+
+// CobsEncode removes all delimiter bytes (0x00) with consistent overhead
+// byte stuffing, so binary data can be sent through the delimiter framing.
+// The overhead is at most one byte per 254 bytes.
+func CobsEncode(raw []byte) []byte {
+	encoded := make([]byte, 1, len(raw)+len(raw)/254+2)
+	codeIndex := 0
+	code := byte(1)
+
+	for _, b := range raw {
+		if b != 0 {
+			encoded = append(encoded, b)
+			code++
+		}
+		if b == 0 || code == 0xFF {
+			encoded[codeIndex] = code
+			codeIndex = len(encoded)
+			encoded = append(encoded, 0)
+			code = 1
+		}
+	}
+	encoded[codeIndex] = code
+
+	return encoded
+}
+
+func CobsDecode(encoded []byte) ([]byte, error) {
+	decoded := make([]byte, 0, len(encoded))
+
+	for i := 0; i < len(encoded); {
+		code := int(encoded[i])
+		if code == 0 || i+code > len(encoded) {
+			return nil, ErrCobsMalformed
+		}
+
+		decoded = append(decoded, encoded[i+1:i+code]...)
+		i += code
+
+		if code < 0xFF && i < len(encoded) {
+			decoded = append(decoded, 0)
+		}
+	}
+
+	return decoded, nil
+}
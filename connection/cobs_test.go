@@ -0,0 +1,80 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCobsRoundtrip(t *testing.T) {
+	long := make([]byte, 600)
+	for i := range long {
+		long[i] = byte(i%255 + 1)
+	}
+
+	inputs := [][]byte{
+		{},
+		{0x00},
+		{0x00, 0x00},
+		{0x11, 0x22, 0x00, 0x33},
+		{0x11, 0x00},
+		long[:254],
+		long[:255],
+		append(long, 0x00),
+	}
+
+	for _, input := range inputs {
+		encoded := CobsEncode(input)
+		if bytes.IndexByte(encoded, DefaultDelimiter) >= 0 {
+			t.Error("delimiter in encoded data: ", encoded)
+		}
+		if len(encoded) > len(input)+len(input)/254+1 {
+			t.Error("unexpected overhead: ", len(input), len(encoded))
+		}
+
+		decoded, err := CobsDecode(encoded)
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(decoded, input) {
+			t.Error("roundtrip failed: ", input, decoded)
+		}
+	}
+
+	if !bytes.Equal(CobsEncode([]byte{0x11, 0x22, 0x00, 0x33}),
+		[]byte{0x03, 0x11, 0x22, 0x02, 0x33}) {
+
+		t.Error("unexpected encoding")
+	}
+
+	if _, err := CobsDecode([]byte{0x05, 0x11}); err == nil {
+		t.Error("truncated data decoded")
+	}
+	if _, err := CobsDecode([]byte{0x02, 0x11, 0x00}); err == nil {
+		t.Error("data with delimiter decoded")
+	}
+}
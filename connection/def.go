@@ -26,8 +26,17 @@
 package connection
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
 	log "github.com/ChrIgiSta/go-utils/logger"
@@ -50,6 +59,65 @@ type Handler interface {
 	Disconnected(id int)
 }
 
+// StreamHandler is implemented by handlers, which accept streams sent with
+// SendStream. ReceivedStream is called in its own goroutine and has to read
+// the stream until it returns an error (io.EOF when complete) or close it.
+type StreamHandler interface {
+	ReceivedStream(id int, streamId uint32, stream io.ReadCloser)
+}
+
+// FileHandler is implemented by handlers, which accept file descriptors sent
+// with SendFiles over unix sockets. The handler owns the files and has to
+// close them. Without it, received files are closed and Received is called.
+type FileHandler interface {
+	ReceivedFiles(id int, msg []byte, files []*os.File)
+}
+
+// ContextHandler is implemented by handlers, which take the trace context of
+// received messages, see socket.WithTraceparent. ReceivedContext is called
+// instead of Received.
+type ContextHandler interface {
+	ReceivedContext(ctx context.Context, id int, message []byte)
+}
+
+// ConnWrapper decorates the connections opened by a client or server, e.g.
+// to inject faults for testing.
+type ConnWrapper interface {
+	WrapConn(conn net.Conn) net.Conn
+	WrapPacketConn(conn net.PacketConn) net.PacketConn
+}
+
+type ErrorCategory string
+
+const (
+	HandshakeError ErrorCategory = "handshake"
+	AcceptError    ErrorCategory = "accept"
+	ReadError      ErrorCategory = "read"
+	WriteError     ErrorCategory = "write"
+	FramingError   ErrorCategory = "framing"
+	TimeoutError   ErrorCategory = "timeout"
+)
+
+// ErrorHandler is implemented by handlers, which want to react on errors of
+// a connection. Errors not related to a connection (e.g. accept) have id 0,
+// as have handshake errors, which end a connection before it got Connected.
+type ErrorHandler interface {
+	Error(id int, category ErrorCategory, err error)
+}
+
+// CategorizeError returns TimeoutError for timeouts and the given category
+// otherwise.
+func CategorizeError(err error, category ErrorCategory) ErrorCategory {
+	var netErr net.Error
+
+	if errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+
+		return TimeoutError
+	}
+	return category
+}
+
 type Message struct {
 	Id      int
 	Content []byte
@@ -61,6 +129,8 @@ const (
 	DISCONNECTED EventType = 0
 	CONNECTED    EventType = 1
 	ERROR        EventType = -1
+	// RECEIVED is published by the Bus only
+	RECEIVED EventType = 2
 )
 
 func GetIdFromConn(conn *net.Conn) int {
@@ -93,44 +163,83 @@ func GetUdpAddress(host string,
 		Address(host, port))
 }
 
+// GetUnixAddress resolves "host:port" or, with port 0, the plain path in
+// host. On Linux a leading "@" addresses the abstract namespace.
 func GetUnixAddress(host string,
 	port uint16) (addr *net.UnixAddr, err error) {
 
+	if port == 0 {
+		return net.ResolveUnixAddr(string(Unix), host)
+	}
 	return net.ResolveUnixAddr(string(Unix),
-		Address(host, port))
+		fmt.Sprintf("%s:%d", host, port))
 }
 
+// Address joins host and port. IPv6 hosts are bracketed, an empty host
+// stands for all interfaces of both IP versions.
 func Address(host string, port uint16) string {
-	return fmt.Sprintf("%s:%d", host, port)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
 }
 
 type Event struct {
 	Id int
 	EventType
+	// Category and Err are set on ERROR events
+	Category ErrorCategory
+	Err      error
+	// Content is set on RECEIVED events
+	Content []byte
 }
 
 type EventsToChannel struct {
 	messageChannel chan<- Message
 	eventChannel   chan<- Event
+
+	overflow OverflowPolicy
+	timeout  time.Duration
+	ctx      context.Context
+	close    context.CancelFunc
+	dropped  atomic.Uint64
+
+	ringLock sync.Mutex
+	ring     []Message
+	ringHead int
+	ringLen  int
+	ringWake chan struct{}
 }
 
+// NewEventsToChannel forwards the handler calls to the channels. By default
+// it blocks until a channel takes the message, see WithOverflow.
 func NewEventsToChannel(messageChannel chan<- Message,
-	eventChannel chan<- Event) *EventsToChannel {
+	eventChannel chan<- Event, options ...EventsOption) *EventsToChannel {
 
-	return &EventsToChannel{
+	e2c := &EventsToChannel{
 		messageChannel: messageChannel,
 		eventChannel:   eventChannel,
+		ctx:            context.Background(),
+	}
+	for _, option := range options {
+		option(e2c)
+	}
+	e2c.ctx, e2c.close = context.WithCancel(e2c.ctx)
+	if e2c.overflow == OverflowDropOldest && messageChannel != nil {
+		e2c.startRing()
 	}
+
+	return e2c
 }
 
 func (e2c *EventsToChannel) Connected(id int) {
 	_ = log.Fine("evt2ch", "connected called with id %d", id)
 
 	if e2c.eventChannel != nil {
-		e2c.eventChannel <- Event{
+		e2c.sendEvent(Event{
 			Id:        id,
 			EventType: CONNECTED,
-		}
+		})
 	} else {
 		_ = log.Warn("evt2ch", "event channel is nil")
 	}
@@ -140,10 +249,11 @@ func (e2c *EventsToChannel) Received(id int, message []byte) {
 	_ = log.Fine("evt2ch", "rx called with id %d, %v", id, string(message))
 
 	if e2c.messageChannel != nil {
-		e2c.messageChannel <- Message{
+		// the socket may reuse the buffer, e.g. for the next datagram
+		e2c.sendMessage(Message{
 			Id:      id,
-			Content: message,
-		}
+			Content: append([]byte(nil), message...),
+		})
 	} else {
 		_ = log.Warn("evt2ch", "message channel is nil")
 	}
@@ -153,10 +263,25 @@ func (e2c *EventsToChannel) Disconnected(id int) {
 	_ = log.Fine("evt2ch", "disconnected called with id %d", id)
 
 	if e2c.eventChannel != nil {
-		e2c.eventChannel <- Event{
+		e2c.sendEvent(Event{
 			Id:        id,
 			EventType: DISCONNECTED,
-		}
+		})
+	} else {
+		_ = log.Warn("evt2ch", "event channel is nil")
+	}
+}
+
+func (e2c *EventsToChannel) Error(id int, category ErrorCategory, err error) {
+	_ = log.Fine("evt2ch", "error called with id %d, %s: %v", id, category, err)
+
+	if e2c.eventChannel != nil {
+		e2c.sendEvent(Event{
+			Id:        id,
+			EventType: ERROR,
+			Category:  category,
+			Err:       err,
+		})
 	} else {
 		_ = log.Warn("evt2ch", "event channel is nil")
 	}
@@ -0,0 +1,349 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package diskqueue is an append-only message queue in a file. Messages are
+// removed by advancing the head, which is kept in a second file, so the queue
+// survives restarts. The file is compacted once the head went far enough.
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// record: length uint32 | crc32 of time and message uint32 | time int64 | message
+const headerSize = 16
+
+const compactThreshold = 1 << 20
+
+var (
+	ErrEmpty    = errors.New("diskqueue: empty")
+	ErrTooLarge = errors.New("diskqueue: message exceeds size limit")
+	ErrClosed   = errors.New("diskqueue: closed")
+)
+
+type Config struct {
+	// MaxBytes limits the queued bytes, the oldest messages are dropped to
+	// make room. 0 is unlimited.
+	MaxBytes int64
+	// MaxAge drops messages queued for longer. 0 is unlimited.
+	MaxAge time.Duration
+	// Sync flushes every change to disk, slow but safe against power loss.
+	Sync bool
+}
+
+type Queue struct {
+	config Config
+
+	lock     sync.Mutex
+	path     string
+	file     *os.File
+	headFile *os.File
+	head     int64
+	size     int64
+	count    int
+	dropped  uint64
+}
+
+// Open opens or creates the queue in path, the head is kept in path.head. A
+// message torn by a crash is cut off.
+func Open(path string, config Config) (*Queue, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	headFile, err := os.OpenFile(path+".head", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	q := &Queue{
+		config:   config,
+		path:     path,
+		file:     file,
+		headFile: headFile,
+	}
+	if err = q.load(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *Queue) load() error {
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+	q.size = info.Size()
+
+	var buffer [8]byte
+	if _, err = q.headFile.ReadAt(buffer[:], 0); err == nil {
+		q.head = int64(binary.BigEndian.Uint64(buffer[:]))
+	} else if err != io.EOF {
+		return err
+	}
+	if q.head > q.size {
+		q.head = 0
+	}
+
+	offset := q.head
+	for offset < q.size {
+		_, _, next, err := q.read(offset)
+		if err != nil {
+			break
+		}
+		offset = next
+		q.count++
+	}
+	if offset < q.size {
+		q.size = offset
+		return q.file.Truncate(offset)
+	}
+	return nil
+}
+
+// Append adds msg to the tail of the queue.
+func (q *Queue) Append(msg []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return ErrClosed
+	}
+
+	length := int64(headerSize + len(msg))
+	if q.config.MaxBytes > 0 {
+		if length > q.config.MaxBytes {
+			return ErrTooLarge
+		}
+		for q.count > 0 && q.size-q.head+length > q.config.MaxBytes {
+			if err := q.drop(); err != nil {
+				return err
+			}
+		}
+	}
+
+	record := make([]byte, length)
+	binary.BigEndian.PutUint32(record, uint32(len(msg)))
+	binary.BigEndian.PutUint64(record[8:], uint64(time.Now().UnixNano()))
+	copy(record[headerSize:], msg)
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(record[8:]))
+
+	if _, err := q.file.WriteAt(record, q.size); err != nil {
+		return err
+	}
+	if q.config.Sync {
+		if err := q.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	q.size += length
+	q.count++
+	return nil
+}
+
+// Peek returns the message at the head, ErrEmpty if there is none. Expired
+// messages are dropped on the way.
+func (q *Queue) Peek() ([]byte, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return nil, ErrClosed
+	}
+
+	for q.count > 0 {
+		msg, queued, _, err := q.read(q.head)
+		if err != nil {
+			return nil, err
+		}
+		if q.config.MaxAge <= 0 || time.Since(queued) <= q.config.MaxAge {
+			return msg, nil
+		}
+		if err = q.drop(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrEmpty
+}
+
+// Ack removes the message at the head, after it was delivered.
+func (q *Queue) Ack() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return ErrClosed
+	}
+	if q.count == 0 {
+		return ErrEmpty
+	}
+
+	_, _, next, err := q.read(q.head)
+	if err != nil {
+		return err
+	}
+	return q.advance(next)
+}
+
+// Len returns the number of queued messages.
+func (q *Queue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.count
+}
+
+// Size returns the number of queued bytes, including the record headers.
+func (q *Queue) Size() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.size - q.head
+}
+
+// Dropped returns the number of messages dropped for the limits since Open.
+func (q *Queue) Dropped() uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.dropped
+}
+
+func (q *Queue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+
+	err := errors.Join(q.file.Close(), q.headFile.Close())
+	q.file = nil
+	q.headFile = nil
+	return err
+}
+
+func (q *Queue) read(offset int64) (msg []byte, queued time.Time, next int64, err error) {
+	var header [headerSize]byte
+	if _, err = q.file.ReadAt(header[:], offset); err != nil {
+		return nil, queued, 0, err
+	}
+
+	length := int64(binary.BigEndian.Uint32(header[:]))
+	next = offset + headerSize + length
+	if next > q.size {
+		return nil, queued, 0, io.ErrUnexpectedEOF
+	}
+
+	record := make([]byte, 8+length)
+	if _, err = q.file.ReadAt(record, offset+8); err != nil {
+		return nil, queued, 0, err
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, queued, 0, errors.New("diskqueue: checksum mismatch")
+	}
+
+	queued = time.Unix(0, int64(binary.BigEndian.Uint64(record)))
+	return record[8:], queued, next, nil
+}
+
+func (q *Queue) drop() error {
+	_, _, next, err := q.read(q.head)
+	if err != nil {
+		return err
+	}
+	q.dropped++
+	return q.advance(next)
+}
+
+// advance moves the head past a message and compacts the file.
+func (q *Queue) advance(next int64) error {
+	q.count--
+
+	if q.count == 0 {
+		if err := q.file.Truncate(0); err != nil {
+			return err
+		}
+		q.size = 0
+		return q.storeHead(0)
+	}
+	if next >= compactThreshold && next > q.size-next {
+		return q.compact(next)
+	}
+	return q.storeHead(next)
+}
+
+// compact rewrites the queue from head on. Resetting the head first replays
+// acknowledged messages after a crash, but never loses one.
+func (q *Queue) compact(head int64) error {
+	tmp, err := os.OpenFile(q.path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmp, io.NewSectionReader(q.file, head, q.size-head))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = q.storeHead(0)
+	}
+	if err == nil {
+		err = os.Rename(q.path+".tmp", q.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(q.path + ".tmp")
+		return errors.Join(err, q.storeHead(head))
+	}
+
+	q.file.Close()
+	q.file = tmp
+	q.size -= head
+	return nil
+}
+
+func (q *Queue) storeHead(head int64) error {
+	var buffer [8]byte
+	binary.BigEndian.PutUint64(buffer[:], uint64(head))
+	if _, err := q.headFile.WriteAt(buffer[:], 0); err != nil {
+		return err
+	}
+	q.head = head
+
+	if q.config.Sync {
+		return q.headFile.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package diskqueue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+
+	q, err := Open(path, Config{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err = q.Peek(); !errors.Is(err, ErrEmpty) {
+		t.Error("unexpected error: ", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = q.Append([]byte(fmt.Sprint("msg", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if msg, _ := q.Peek(); string(msg) != "msg0" {
+		t.Error("unexpected head: ", string(msg))
+	}
+	if err = q.Ack(); err != nil {
+		t.Error(err)
+	}
+	_ = q.Close()
+
+	// reopen continues after the acknowledged message
+	if q, err = Open(path, Config{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	if q.Len() != 2 {
+		t.Error("unexpected length: ", q.Len())
+	}
+	for _, expected := range []string{"msg1", "msg2"} {
+		if msg, _ := q.Peek(); string(msg) != expected {
+			t.Error("unexpected message: ", string(msg))
+		}
+		_ = q.Ack()
+	}
+	if q.Len() != 0 || q.Size() != 0 {
+		t.Error("queue not empty")
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Error("file not truncated")
+	}
+}
+
+func TestQueueTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+
+	q, _ := Open(path, Config{})
+	_ = q.Append([]byte("complete"))
+	_ = q.Append([]byte("torn"))
+	_ = q.Close()
+
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-2); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	q, err := Open(path, Config{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	if q.Len() != 1 {
+		t.Error("unexpected length: ", q.Len())
+	}
+	_ = q.Append([]byte("next"))
+	_ = q.Ack()
+	if msg, _ := q.Peek(); string(msg) != "next" {
+		t.Error("unexpected message: ", string(msg))
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	q, err := Open(filepath.Join(t.TempDir(), "queue"), Config{MaxBytes: 3 * (headerSize + 4)})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	for i := 0; i < 5; i++ {
+		_ = q.Append([]byte(fmt.Sprint("msg", i)))
+	}
+	if q.Len() != 3 || q.Dropped() != 2 {
+		t.Error("unexpected length: ", q.Len(), q.Dropped())
+	}
+	if msg, _ := q.Peek(); string(msg) != "msg2" {
+		t.Error("unexpected head: ", string(msg))
+	}
+	if err = q.Append(make([]byte, 100)); !errors.Is(err, ErrTooLarge) {
+		t.Error("unexpected error: ", err)
+	}
+
+	aged, _ := Open(filepath.Join(t.TempDir(), "aged"), Config{MaxAge: 20 * time.Millisecond})
+	defer aged.Close()
+
+	_ = aged.Append([]byte("old"))
+	time.Sleep(30 * time.Millisecond)
+	_ = aged.Append([]byte("new"))
+	if msg, _ := aged.Peek(); string(msg) != "new" || aged.Dropped() != 1 {
+		t.Error("expired message not dropped: ", string(msg))
+	}
+}
+
+func TestQueueCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+
+	q, _ := Open(path, Config{})
+	msg := make([]byte, 64*1024)
+	for i := 0; i < 40; i++ {
+		msg[0] = byte(i)
+		_ = q.Append(msg)
+	}
+	for i := 0; i < 30; i++ {
+		_ = q.Ack()
+	}
+	if info, _ := os.Stat(path); info.Size() >= 20*int64(len(msg)) {
+		t.Error("file not compacted: ", info.Size())
+	}
+	_ = q.Close()
+
+	q, _ = Open(path, Config{})
+	defer q.Close()
+	if head, _ := q.Peek(); q.Len() != 10 || head[0] != 30 {
+		t.Error("unexpected queue after compaction: ", q.Len())
+	}
+}
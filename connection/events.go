@@ -0,0 +1,212 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import (
+	"context"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// OverflowPolicy decides what EventsToChannel does with a message, while the
+// message channel is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the channel takes the message.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the message.
+	OverflowDropNewest
+	// OverflowDropOldest queues the message in a ring buffer, which drops
+	// its oldest message once full. A goroutine forwards the buffer until
+	// the context is done or Close is called.
+	OverflowDropOldest
+	// OverflowTimeout waits up to a timeout and drops the message then.
+	OverflowTimeout
+)
+
+const defaultRingSize = 64
+
+type EventsOption func(e2c *EventsToChannel)
+
+// WithOverflow sets the policy for a full message channel. Events are never
+// dropped, they block until taken or the context is done.
+func WithOverflow(policy OverflowPolicy) EventsOption {
+	return func(e2c *EventsToChannel) {
+		e2c.overflow = policy
+	}
+}
+
+// WithOverflowTimeout drops messages the channel did not take in time.
+func WithOverflowTimeout(timeout time.Duration) EventsOption {
+	return func(e2c *EventsToChannel) {
+		e2c.overflow = OverflowTimeout
+		e2c.timeout = timeout
+	}
+}
+
+// WithRingSize sets the size of the ring buffer on OverflowDropOldest, 64
+// if not set.
+func WithRingSize(size int) EventsOption {
+	return func(e2c *EventsToChannel) {
+		if size > 0 {
+			e2c.ring = make([]Message, size)
+		}
+	}
+}
+
+// WithContext shuts the adapter down once ctx is done. Blocked calls return,
+// later messages and events are dropped.
+func WithContext(ctx context.Context) EventsOption {
+	return func(e2c *EventsToChannel) {
+		e2c.ctx = ctx
+	}
+}
+
+// Close shuts the adapter down like a done context, see WithContext. It ends
+// the forwarding of the ring buffer on OverflowDropOldest, which runs until
+// then.
+func (e2c *EventsToChannel) Close() {
+	e2c.close()
+}
+
+// Dropped returns the number of messages dropped so far.
+func (e2c *EventsToChannel) Dropped() uint64 {
+	return e2c.dropped.Load()
+}
+
+func (e2c *EventsToChannel) sendMessage(msg Message) {
+	if e2c.ctx.Err() != nil {
+		e2c.drop(msg.Id)
+		return
+	}
+
+	switch e2c.overflow {
+	case OverflowDropNewest:
+		select {
+		case e2c.messageChannel <- msg:
+		default:
+			e2c.drop(msg.Id)
+		}
+
+	case OverflowDropOldest:
+		e2c.pushRing(msg)
+
+	case OverflowTimeout:
+		timer := time.NewTimer(e2c.timeout)
+		defer timer.Stop()
+
+		select {
+		case e2c.messageChannel <- msg:
+		case <-timer.C:
+			e2c.drop(msg.Id)
+		case <-e2c.ctx.Done():
+			e2c.drop(msg.Id)
+		}
+
+	default:
+		select {
+		case e2c.messageChannel <- msg:
+		case <-e2c.ctx.Done():
+			e2c.drop(msg.Id)
+		}
+	}
+}
+
+func (e2c *EventsToChannel) sendEvent(evt Event) {
+	select {
+	case e2c.eventChannel <- evt:
+	case <-e2c.ctx.Done():
+		_ = log.Fine("evt2ch", "drop event %d of %d, context done", evt.EventType, evt.Id)
+	}
+}
+
+func (e2c *EventsToChannel) drop(id int) {
+	e2c.dropped.Add(1)
+	_ = log.Fine("evt2ch", "drop message of %d", id)
+}
+
+// startRing starts forwarding the ring buffer to the message channel, until
+// the context is done or the adapter closed.
+func (e2c *EventsToChannel) startRing() {
+	if e2c.ring == nil {
+		e2c.ring = make([]Message, defaultRingSize)
+	}
+	e2c.ringWake = make(chan struct{}, 1)
+
+	go func() {
+		for {
+			msg, ok := e2c.popRing()
+			if !ok {
+				select {
+				case <-e2c.ringWake:
+					continue
+				case <-e2c.ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case e2c.messageChannel <- msg:
+			case <-e2c.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (e2c *EventsToChannel) pushRing(msg Message) {
+	e2c.ringLock.Lock()
+	if e2c.ringLen == len(e2c.ring) {
+		e2c.drop(e2c.ring[e2c.ringHead].Id)
+		e2c.ringHead = (e2c.ringHead + 1) % len(e2c.ring)
+		e2c.ringLen--
+	}
+	e2c.ring[(e2c.ringHead+e2c.ringLen)%len(e2c.ring)] = msg
+	e2c.ringLen++
+	e2c.ringLock.Unlock()
+
+	select {
+	case e2c.ringWake <- struct{}{}:
+	default:
+	}
+}
+
+func (e2c *EventsToChannel) popRing() (msg Message, ok bool) {
+	e2c.ringLock.Lock()
+	defer e2c.ringLock.Unlock()
+
+	if e2c.ringLen == 0 {
+		return Message{}, false
+	}
+
+	msg = e2c.ring[e2c.ringHead]
+	e2c.ring[e2c.ringHead] = Message{}
+	e2c.ringHead = (e2c.ringHead + 1) % len(e2c.ring)
+	e2c.ringLen--
+	return msg, true
+}
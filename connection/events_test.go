@@ -0,0 +1,167 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package connection
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestOverflowDropNewest(t *testing.T) {
+	msgCh := make(chan Message, 1)
+	e2c := NewEventsToChannel(msgCh, nil, WithOverflow(OverflowDropNewest))
+
+	e2c.Received(1, []byte("first"))
+	e2c.Received(1, []byte("second"))
+
+	if msg := <-msgCh; string(msg.Content) != "first" {
+		t.Error("unexpected message: ", string(msg.Content))
+	}
+	if e2c.Dropped() != 1 {
+		t.Error("unexpected dropped: ", e2c.Dropped())
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgCh := make(chan Message)
+	e2c := NewEventsToChannel(msgCh, nil, WithOverflow(OverflowDropOldest),
+		WithRingSize(2), WithContext(ctx))
+
+	done := make(chan struct{})
+	go func() {
+		for _, msg := range []string{"1", "2", "3", "4"} {
+			e2c.Received(1, []byte(msg))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("received blocked")
+		t.FailNow()
+	}
+
+	// the forwarder may hold one message, the ring keeps the two newest
+	var received []string
+	for {
+		select {
+		case msg := <-msgCh:
+			received = append(received, string(msg.Content))
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		break
+	}
+	n := len(received)
+	if n < 2 || received[n-2] != "3" || received[n-1] != "4" ||
+		e2c.Dropped() != uint64(4-n) {
+
+		t.Error("unexpected messages: ", received, e2c.Dropped())
+	}
+}
+
+func TestOverflowTimeout(t *testing.T) {
+	msgCh := make(chan Message)
+	e2c := NewEventsToChannel(msgCh, nil, WithOverflowTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	e2c.Received(1, []byte("lost"))
+	if time.Since(start) < 20*time.Millisecond || e2c.Dropped() != 1 {
+		t.Error("message not dropped after timeout")
+	}
+
+	go func() {
+		<-msgCh
+	}()
+	e2c.Received(1, []byte("taken"))
+	if e2c.Dropped() != 1 {
+		t.Error("taken message dropped")
+	}
+}
+
+func TestEventsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e2c := NewEventsToChannel(make(chan Message), make(chan Event), WithContext(ctx))
+
+	done := make(chan struct{})
+	go func() {
+		e2c.Received(1, []byte("blocked"))
+		e2c.Disconnected(1)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("not shut down")
+		t.FailNow()
+	}
+
+	e2c.Received(1, []byte("late"))
+	if e2c.Dropped() != 2 {
+		t.Error("unexpected dropped: ", e2c.Dropped())
+	}
+}
+
+func TestEventsClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	msgCh := make(chan Message, 1)
+	e2c := NewEventsToChannel(msgCh, nil, WithOverflow(OverflowDropOldest))
+
+	// the content is copied, the socket reuses its buffer
+	buffer := []byte("first")
+	e2c.Received(1, buffer)
+	copy(buffer, "reuse")
+	select {
+	case msg := <-msgCh:
+		if string(msg.Content) != "first" {
+			t.Error("content not copied: ", string(msg.Content))
+		}
+	case <-time.After(time.Second):
+		t.Error("message not forwarded")
+	}
+
+	e2c.Close()
+	e2c.Received(1, []byte("late"))
+	if e2c.Dropped() != 1 {
+		t.Error("message after close not dropped")
+	}
+
+	for start := time.Now(); runtime.NumGoroutine() > before; {
+		if time.Since(start) > time.Second {
+			t.Error("ring forwarding not stopped")
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
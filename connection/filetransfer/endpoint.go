@@ -0,0 +1,317 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const (
+	DefaultChunkSize  = 64 * 1024
+	DefaultWindow     = 8
+	DefaultAckTimeout = 30 * time.Second
+
+	protocolVersion = 1
+)
+
+const (
+	opOffer    = "offer"
+	opAccept   = "accept"
+	opReject   = "reject"
+	opChunk    = "chunk"
+	opAck      = "ack"
+	opNack     = "nack"
+	opComplete = "complete"
+	opFailed   = "failed"
+	opCancel   = "cancel"
+)
+
+var (
+	ErrRejected     = errors.New("transfer rejected")
+	ErrFailed       = errors.New("transfer failed")
+	ErrTimeout      = errors.New("transfer timeout")
+	ErrDisconnected = errors.New("disconnected during transfer")
+	ErrNoTransport  = errors.New("no transport set")
+)
+
+// message of the transfer protocol. Messages are JSON objects starting with
+// the protocol version, which keeps them free of delimiters and tells them
+// apart from application messages on the same connection.
+type message struct {
+	Version int    `json:"ft"`
+	Op      string `json:"op"`
+	Tid     string `json:"tid"`
+	Name    string `json:"name,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Sha256  string `json:"sha256,omitempty"`
+	Offset  int64  `json:"offset"`
+	Data    []byte `json:"data,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+var messagePrefix = []byte(`{"ft":`)
+
+// Transport sends messages to a connection, socket.Server implements it.
+type Transport interface {
+	Send(id int, msg []byte) error
+}
+
+type clientTransport struct {
+	client interface{ Send(msg []byte) error }
+}
+
+// ClientTransport adapts a socket.Client, which has a single connection.
+func ClientTransport(client interface{ Send(msg []byte) error }) Transport {
+	return &clientTransport{client: client}
+}
+
+func (t *clientTransport) Send(id int, msg []byte) error {
+	return t.client.Send(msg)
+}
+
+type Offer struct {
+	TransferId string
+	Name       string
+	Size       int64
+	Sha256     string
+}
+
+type Direction string
+
+const (
+	Sending   Direction = "send"
+	Receiving Direction = "receive"
+)
+
+type Progress struct {
+	ConnId      int
+	TransferId  string
+	Name        string
+	Direction   Direction
+	Transferred int64
+	Size        int64
+}
+
+type Config struct {
+	// Directory for received files. Partial files are kept as name.part
+	// next to it until they are complete, which allows to resume.
+	Directory  string
+	ChunkSize  int
+	Window     int
+	AckTimeout time.Duration
+
+	// Accept decides about incoming offers, nil accepts all.
+	Accept func(id int, offer Offer) bool
+	// Progress is called after every acknowledged chunk.
+	Progress func(progress Progress)
+	// Received is called when an incoming transfer ended.
+	Received func(id int, path string, err error)
+	// Handler gets all connection events and non transfer messages.
+	Handler connection.Handler
+}
+
+func (c Config) withDefaults() Config {
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.AckTimeout <= 0 {
+		c.AckTimeout = DefaultAckTimeout
+	}
+	if c.Directory == "" {
+		c.Directory = "."
+	}
+	return c
+}
+
+type transferKey struct {
+	id  int
+	tid string
+}
+
+// Endpoint sends and receives files over the connections of a socket.Client
+// or socket.Server. It is the handler of the socket and can run any number of
+// transfers per connection in both directions.
+type Endpoint struct {
+	config    Config
+	transport Transport
+
+	lock     sync.Mutex
+	outgoing map[transferKey]*outgoing
+	incoming map[transferKey]*incoming
+}
+
+func NewEndpoint(config Config) *Endpoint {
+	return &Endpoint{
+		config:   config.withDefaults(),
+		outgoing: make(map[transferKey]*outgoing),
+		incoming: make(map[transferKey]*incoming),
+	}
+}
+
+// SetTransport sets the socket to send on. It is set after creation, as the
+// socket needs the endpoint as its handler.
+func (e *Endpoint) SetTransport(transport Transport) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.transport = transport
+}
+
+func (e *Endpoint) Connected(id int) {
+	if e.config.Handler != nil {
+		e.config.Handler.Connected(id)
+	}
+}
+
+func (e *Endpoint) Received(id int, msg []byte) {
+	if !bytes.HasPrefix(msg, messagePrefix) {
+		if e.config.Handler != nil {
+			e.config.Handler.Received(id, msg)
+		}
+		return
+	}
+
+	var m message
+	if err := json.Unmarshal(msg, &m); err != nil || m.Version != protocolVersion {
+		_ = log.Warn("filetransfer", "invalid message from %d: %v", id, err)
+		return
+	}
+
+	key := transferKey{id: id, tid: m.Tid}
+
+	switch m.Op {
+	case opOffer:
+		e.receiveOffer(id, m)
+	case opChunk:
+		e.receiveChunk(key, m)
+	case opCancel:
+		e.receiveCancel(key, m)
+	default:
+		e.lock.Lock()
+		transfer := e.outgoing[key]
+		e.lock.Unlock()
+
+		if transfer == nil {
+			_ = log.Debug("filetransfer", "%s for unknown transfer %s", m.Op, m.Tid)
+			return
+		}
+		transfer.notify(m)
+	}
+}
+
+func (e *Endpoint) Disconnected(id int) {
+	e.lock.Lock()
+	var lost []*outgoing
+	for key, transfer := range e.outgoing {
+		if key.id == id {
+			lost = append(lost, transfer)
+		}
+	}
+	var aborted []*incoming
+	for key, transfer := range e.incoming {
+		if key.id == id {
+			aborted = append(aborted, transfer)
+			delete(e.incoming, key)
+		}
+	}
+	e.lock.Unlock()
+
+	for _, transfer := range lost {
+		transfer.abort(ErrDisconnected)
+	}
+	for _, transfer := range aborted {
+		// the partial file is kept to resume
+		transfer.close()
+		e.received(id, transfer.path, ErrDisconnected)
+	}
+
+	if e.config.Handler != nil {
+		e.config.Handler.Disconnected(id)
+	}
+}
+
+// Error forwards connection errors to the handler, if it accepts them.
+func (e *Endpoint) Error(id int, category connection.ErrorCategory, err error) {
+	if errorHandler, ok := e.config.Handler.(connection.ErrorHandler); ok {
+		errorHandler.Error(id, category, err)
+	}
+}
+
+func (e *Endpoint) send(id int, m message) error {
+	e.lock.Lock()
+	transport := e.transport
+	e.lock.Unlock()
+
+	if transport == nil {
+		return ErrNoTransport
+	}
+
+	m.Version = protocolVersion
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return transport.Send(id, raw)
+}
+
+func (e *Endpoint) progress(progress Progress) {
+	if e.config.Progress != nil {
+		e.config.Progress(progress)
+	}
+}
+
+func (e *Endpoint) received(id int, path string, err error) {
+	if err != nil {
+		_ = log.Warn("filetransfer", "receive %s from %d: %v", path, id, err)
+	} else {
+		_ = log.Info("filetransfer", "received %s from %d", path, id)
+	}
+
+	if e.config.Received != nil {
+		e.config.Received(id, path, err)
+	}
+}
+
+func newTransferId() string {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(raw)
+}
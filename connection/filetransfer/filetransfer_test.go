@@ -0,0 +1,284 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package filetransfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/socket"
+)
+
+func writeTestFile(t *testing.T, size int) (path string, content []byte) {
+	content = make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+
+	path = filepath.Join(t.TempDir(), "firmware.bin")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return
+}
+
+func TestFileTransferSocket(t *testing.T) {
+	path, content := writeTestFile(t, 300*1024)
+	dir := t.TempDir()
+
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+	received := make(chan error, 1)
+
+	var progressLock sync.Mutex
+	var progress []Progress
+
+	receiver := NewEndpoint(Config{
+		Directory: dir,
+		Handler:   connection.NewEventsToChannel(sMsgCh, sEvtCh),
+		Received: func(id int, path string, err error) {
+			received <- err
+		},
+	})
+	s := socket.NewTcpServer("localhost", 0, receiver)
+	receiver.SetTransport(s)
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	sender := NewEndpoint(Config{
+		ChunkSize: 16 * 1024,
+		Progress: func(p Progress) {
+			progressLock.Lock()
+			progress = append(progress, p)
+			progressLock.Unlock()
+		},
+	})
+	port := uint16(s.Addr().(*net.TCPAddr).Port)
+	c := socket.NewTcpClient("localhost", port, sender)
+	sender.SetTransport(ClientTransport(c))
+
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	<-sEvtCh
+
+	// application messages pass through
+	if err := c.Send([]byte("hello server")); err != nil {
+		t.Error(err)
+	}
+	if sMsg := <-sMsgCh; string(sMsg.Content) != "hello server" {
+		t.Error("unexpected rx on server: ", string(sMsg.Content))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sender.Send(ctx, 1, path); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := <-received; err != nil {
+		t.Error(err)
+	}
+
+	written, err := os.ReadFile(filepath.Join(dir, "firmware.bin"))
+	if err != nil || !bytes.Equal(written, content) {
+		t.Error("received file differs: ", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "firmware.bin.part")); err == nil {
+		t.Error("part file left")
+	}
+
+	progressLock.Lock()
+	if len(progress) != 19 || progress[len(progress)-1].Transferred != int64(len(content)) {
+		t.Error("unexpected progress: ", len(progress))
+	}
+	progressLock.Unlock()
+
+	if err = c.Disconnect(); err != nil {
+		t.Error(err)
+	}
+}
+
+// link delivers messages in order to an endpoint and cuts the connection
+// after a number of chunks.
+type link struct {
+	lock    sync.Mutex
+	peer    *Endpoint
+	queue   chan []byte
+	chunks  int
+	cutAt   int
+	cut     bool
+	onCut   func()
+	stopped chan struct{}
+}
+
+func newLink(peer *Endpoint, cutAt int, onCut func()) *link {
+	l := &link{
+		peer:    peer,
+		queue:   make(chan []byte, 1024),
+		cutAt:   cutAt,
+		onCut:   onCut,
+		stopped: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.stopped)
+		for msg := range l.queue {
+			l.peer.Received(1, msg)
+		}
+	}()
+	return l
+}
+
+func (l *link) Send(id int, msg []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.cut {
+		return errors.New("link down")
+	}
+
+	var m message
+	_ = json.Unmarshal(msg, &m)
+	if m.Op == opChunk {
+		l.chunks++
+		if l.cutAt > 0 && l.chunks > l.cutAt {
+			l.cut = true
+			go l.onCut()
+			return errors.New("link down")
+		}
+	}
+
+	l.queue <- msg
+	return nil
+}
+
+func (l *link) close() {
+	close(l.queue)
+	<-l.stopped
+}
+
+func TestFileTransferResume(t *testing.T) {
+	path, content := writeTestFile(t, 100*1024)
+	dir := t.TempDir()
+	received := make(chan error, 2)
+
+	sender := NewEndpoint(Config{ChunkSize: 10 * 1024, Window: 1})
+	receiver := NewEndpoint(Config{
+		Directory: dir,
+		Received: func(id int, path string, err error) {
+			received <- err
+		},
+	})
+
+	disconnect := func() {
+		sender.Disconnected(1)
+		receiver.Disconnected(1)
+	}
+
+	toReceiver := newLink(receiver, 4, disconnect)
+	toSender := newLink(sender, 0, nil)
+	sender.SetTransport(toReceiver)
+	receiver.SetTransport(toSender)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := sender.Send(ctx, 1, path); err == nil {
+		t.Error("transfer survived the cut")
+	}
+	if err := <-received; !errors.Is(err, ErrDisconnected) {
+		t.Error("receiver not disconnected: ", err)
+	}
+	toReceiver.close()
+	toSender.close()
+
+	part, err := os.ReadFile(filepath.Join(dir, "firmware.bin.part"))
+	if err != nil || len(part) != 4*10*1024 || !bytes.Equal(part, content[:len(part)]) {
+		t.Error("unexpected part: ", len(part), err)
+	}
+
+	// reconnect and resume
+	toReceiver = newLink(receiver, 0, nil)
+	toSender = newLink(sender, 0, nil)
+	sender.SetTransport(toReceiver)
+	receiver.SetTransport(toSender)
+	defer toReceiver.close()
+	defer toSender.close()
+
+	if err = sender.Send(ctx, 1, path); err != nil {
+		t.Error(err)
+	}
+	if err = <-received; err != nil {
+		t.Error(err)
+	}
+
+	if toReceiver.chunks != 6 {
+		t.Error("not resumed, chunks sent again: ", toReceiver.chunks)
+	}
+
+	written, err := os.ReadFile(filepath.Join(dir, "firmware.bin"))
+	if err != nil || !bytes.Equal(written, content) {
+		t.Error("received file differs: ", err)
+	}
+}
+
+func TestFileTransferReject(t *testing.T) {
+	path, _ := writeTestFile(t, 1024)
+
+	sender := NewEndpoint(Config{})
+	receiver := NewEndpoint(Config{
+		Directory: t.TempDir(),
+		Accept: func(id int, offer Offer) bool {
+			return offer.Size < 100
+		},
+	})
+
+	toReceiver := newLink(receiver, 0, nil)
+	toSender := newLink(sender, 0, nil)
+	defer toReceiver.close()
+	defer toSender.close()
+	sender.SetTransport(toReceiver)
+	receiver.SetTransport(toSender)
+
+	if err := sender.Send(context.Background(), 1, path); !errors.Is(err, ErrRejected) {
+		t.Error("offer not rejected: ", err)
+	}
+}
@@ -0,0 +1,266 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package filetransfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+var ErrCanceled = errors.New("transfer canceled by sender")
+
+const (
+	partSuffix     = ".part"
+	checksumSuffix = ".sha256"
+)
+
+type incoming struct {
+	tid      string
+	name     string
+	path     string
+	size     int64
+	sha256   string
+	file     *os.File
+	offset   int64
+	checksum hash.Hash
+}
+
+func (t *incoming) partPath() string {
+	return t.path + partSuffix
+}
+
+func (t *incoming) checksumPath() string {
+	return t.partPath() + checksumSuffix
+}
+
+func (t *incoming) close() {
+	if err := t.file.Close(); err != nil {
+		_ = log.Warn("filetransfer", "close %s: %v", t.partPath(), err)
+	}
+}
+
+func (e *Endpoint) receiveOffer(id int, m message) {
+	reject := func(reason string) {
+		_ = log.Warn("filetransfer", "reject %s from %d: %s", m.Name, id, reason)
+		_ = e.send(id, message{Op: opReject, Tid: m.Tid, Reason: reason})
+	}
+
+	name := filepath.Base(filepath.Clean(string(filepath.Separator) + m.Name))
+	if name == string(filepath.Separator) || name == "." || m.Size < 0 {
+		reject("invalid name or size")
+		return
+	}
+
+	offer := Offer{TransferId: m.Tid, Name: name, Size: m.Size, Sha256: m.Sha256}
+	if e.config.Accept != nil && !e.config.Accept(id, offer) {
+		reject("declined")
+		return
+	}
+
+	transfer := &incoming{
+		tid:      m.Tid,
+		name:     name,
+		path:     filepath.Join(e.config.Directory, name),
+		size:     m.Size,
+		sha256:   m.Sha256,
+		checksum: sha256.New(),
+	}
+
+	e.lock.Lock()
+	for _, other := range e.incoming {
+		if other.path == transfer.path {
+			e.lock.Unlock()
+			reject("file busy")
+			return
+		}
+	}
+	e.incoming[transferKey{id: id, tid: m.Tid}] = transfer
+	e.lock.Unlock()
+
+	if err := e.openPart(transfer); err != nil {
+		e.lock.Lock()
+		delete(e.incoming, transferKey{id: id, tid: m.Tid})
+		e.lock.Unlock()
+
+		reject(err.Error())
+		return
+	}
+
+	_ = e.send(id, message{Op: opAccept, Tid: m.Tid, Offset: transfer.offset})
+
+	if transfer.offset == transfer.size {
+		e.finish(transferKey{id: id, tid: m.Tid}, transfer)
+	}
+}
+
+// openPart opens the partial file. A part of the same file (same checksum)
+// is resumed, anything else starts over.
+func (e *Endpoint) openPart(t *incoming) (err error) {
+	previous, _ := os.ReadFile(t.checksumPath())
+	resume := bytes.Equal(bytes.TrimSpace(previous), []byte(t.sha256))
+
+	flags := os.O_CREATE | os.O_RDWR
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+
+	t.file, err = os.OpenFile(t.partPath(), flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(t.checksumPath(), []byte(t.sha256), 0o644); err != nil {
+		t.close()
+		return err
+	}
+
+	// every byte in the part was verified by its chunk checksum
+	t.offset, err = io.Copy(t.checksum, io.LimitReader(t.file, t.size))
+	if err != nil {
+		t.close()
+		return err
+	}
+
+	if err = t.file.Truncate(t.offset); err != nil {
+		t.close()
+	}
+	return err
+}
+
+func (e *Endpoint) receiveChunk(key transferKey, m message) {
+	e.lock.Lock()
+	transfer := e.incoming[key]
+	e.lock.Unlock()
+
+	if transfer == nil {
+		_ = log.Debug("filetransfer", "chunk for unknown transfer %s", key.tid)
+		return
+	}
+
+	if m.Offset != transfer.offset {
+		// a duplicate is acked again, chunks after a gap are dropped
+		if m.Offset < transfer.offset {
+			_ = e.send(key.id, message{Op: opAck, Tid: key.tid, Offset: transfer.offset})
+		}
+		return
+	}
+
+	sum := sha256.Sum256(m.Data)
+	if hex.EncodeToString(sum[:]) != m.Sha256 ||
+		transfer.offset+int64(len(m.Data)) > transfer.size {
+
+		_ = e.send(key.id, message{
+			Op:     opNack,
+			Tid:    key.tid,
+			Offset: transfer.offset,
+			Reason: "chunk checksum mismatch",
+		})
+		return
+	}
+
+	if _, err := transfer.file.WriteAt(m.Data, transfer.offset); err != nil {
+		e.fail(key, transfer, err)
+		return
+	}
+	transfer.checksum.Write(m.Data)
+	transfer.offset += int64(len(m.Data))
+
+	_ = e.send(key.id, message{Op: opAck, Tid: key.tid, Offset: transfer.offset})
+
+	e.progress(Progress{
+		ConnId:      key.id,
+		TransferId:  key.tid,
+		Name:        transfer.name,
+		Direction:   Receiving,
+		Transferred: transfer.offset,
+		Size:        transfer.size,
+	})
+
+	if transfer.offset == transfer.size {
+		e.finish(key, transfer)
+	}
+}
+
+func (e *Endpoint) receiveCancel(key transferKey, m message) {
+	e.lock.Lock()
+	transfer := e.incoming[key]
+	delete(e.incoming, key)
+	e.lock.Unlock()
+
+	if transfer == nil {
+		return
+	}
+
+	// the partial file is kept to resume
+	transfer.close()
+	e.received(key.id, transfer.path, ErrCanceled)
+}
+
+// finish verifies the whole file and moves it in place.
+func (e *Endpoint) finish(key transferKey, t *incoming) {
+	if hex.EncodeToString(t.checksum.Sum(nil)) != t.sha256 {
+		e.fail(key, t, errors.New("file checksum mismatch"))
+		return
+	}
+
+	e.lock.Lock()
+	delete(e.incoming, key)
+	e.lock.Unlock()
+
+	t.close()
+
+	if err := os.Rename(t.partPath(), t.path); err != nil {
+		_ = e.send(key.id, message{Op: opFailed, Tid: key.tid, Reason: err.Error()})
+		e.received(key.id, t.path, err)
+		return
+	}
+	_ = os.Remove(t.checksumPath())
+
+	_ = e.send(key.id, message{Op: opComplete, Tid: key.tid, Offset: t.offset})
+	e.received(key.id, t.path, nil)
+}
+
+// fail drops the transfer and its partial file.
+func (e *Endpoint) fail(key transferKey, t *incoming, err error) {
+	e.lock.Lock()
+	delete(e.incoming, key)
+	e.lock.Unlock()
+
+	t.close()
+	_ = os.Remove(t.partPath())
+	_ = os.Remove(t.checksumPath())
+
+	_ = e.send(key.id, message{Op: opFailed, Tid: key.tid, Reason: err.Error()})
+	e.received(key.id, t.path, err)
+}
@@ -0,0 +1,227 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package filetransfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+type outgoing struct {
+	events chan message
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func (o *outgoing) notify(m message) {
+	select {
+	case o.events <- m:
+	case <-o.done:
+	}
+}
+
+func (o *outgoing) abort(err error) {
+	o.once.Do(func() {
+		o.err = err
+		close(o.done)
+	})
+}
+
+func (o *outgoing) wait(ctx context.Context, timeout time.Duration) (message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case m := <-o.events:
+		return m, nil
+	case <-o.done:
+		return message{}, o.err
+	case <-ctx.Done():
+		return message{}, ctx.Err()
+	case <-timer.C:
+		return message{}, ErrTimeout
+	}
+}
+
+// Send offers the file to connection id and transfers it once accepted. If
+// the receiver has a part of the file from an earlier attempt, the transfer
+// resumes from there. Send blocks until the receiver verified the file.
+//
+// The acknowledgements arrive on the reading goroutine of the connection,
+// which also runs the Config.Handler and the Received and Progress callbacks
+// of incoming files. Calling Send from one of these deadlocks the transfer,
+// run it on its own goroutine instead.
+func (e *Endpoint) Send(ctx context.Context, id int, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	checksum := sha256.New()
+	if _, err = io.Copy(checksum, file); err != nil {
+		return err
+	}
+
+	size := info.Size()
+	name := filepath.Base(path)
+	key := transferKey{id: id, tid: newTransferId()}
+	transfer := &outgoing{
+		events: make(chan message, e.config.Window+4),
+		done:   make(chan struct{}),
+	}
+
+	e.lock.Lock()
+	e.outgoing[key] = transfer
+	e.lock.Unlock()
+
+	defer func() {
+		e.lock.Lock()
+		delete(e.outgoing, key)
+		e.lock.Unlock()
+		transfer.abort(nil)
+	}()
+
+	err = e.send(id, message{
+		Op:     opOffer,
+		Tid:    key.tid,
+		Name:   name,
+		Size:   size,
+		Sha256: hex.EncodeToString(checksum.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+
+	m, err := transfer.wait(ctx, e.config.AckTimeout)
+	if err != nil {
+		return e.cancel(key, err)
+	}
+	switch m.Op {
+	case opAccept:
+	case opReject:
+		return fmt.Errorf("%w: %s", ErrRejected, m.Reason)
+	default:
+		return fmt.Errorf("unexpected %s on offer", m.Op)
+	}
+
+	if m.Offset > 0 {
+		_ = log.Info("filetransfer", "resume %s at %d of %d", name, m.Offset, size)
+	}
+
+	sent, acked := m.Offset, m.Offset
+	window := int64(e.config.ChunkSize * e.config.Window)
+	buffer := make([]byte, e.config.ChunkSize)
+
+	for {
+		for sent < size && sent-acked < window {
+			chunk := buffer
+			if rest := size - sent; rest < int64(len(chunk)) {
+				chunk = chunk[:rest]
+			}
+
+			n, err := file.ReadAt(chunk, sent)
+			if n < len(chunk) {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return e.cancel(key, err)
+			}
+
+			sum := sha256.Sum256(chunk)
+			err = e.send(id, message{
+				Op:     opChunk,
+				Tid:    key.tid,
+				Offset: sent,
+				Data:   chunk,
+				Sha256: hex.EncodeToString(sum[:]),
+			})
+			if err != nil {
+				return err
+			}
+			sent += int64(n)
+		}
+
+		m, err := transfer.wait(ctx, e.config.AckTimeout)
+		if err != nil {
+			return e.cancel(key, err)
+		}
+
+		switch m.Op {
+		case opAck:
+			if m.Offset > acked {
+				acked = m.Offset
+				e.progress(Progress{
+					ConnId:      id,
+					TransferId:  key.tid,
+					Name:        name,
+					Direction:   Sending,
+					Transferred: acked,
+					Size:        size,
+				})
+			}
+		case opNack:
+			_ = log.Warn("filetransfer", "chunk at %d of %s rejected: %s",
+				m.Offset, name, m.Reason)
+			sent, acked = m.Offset, m.Offset
+		case opComplete:
+			return nil
+		case opFailed, opCancel:
+			return fmt.Errorf("%w: %s", ErrFailed, m.Reason)
+		}
+	}
+}
+
+// cancel tells the receiver to stop and keep the part received so far.
+func (e *Endpoint) cancel(key transferKey, reason error) error {
+	if !errors.Is(reason, ErrDisconnected) {
+		_ = e.send(key.id, message{
+			Op:     opCancel,
+			Tid:    key.tid,
+			Reason: reason.Error(),
+		})
+	}
+	return reason
+}
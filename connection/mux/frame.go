@@ -0,0 +1,89 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Frame types. Every frame starts with a header, data frames carry their
+// payload behind it:
+//
+//	type uint8 | flags uint8 | stream id uint32 | window delta uint32
+const (
+	typeData   byte = 0x00
+	typeWindow byte = 0x01
+)
+
+// Frame flags. SYN opens a stream, FIN ends the direction of the sender and
+// RST aborts the stream.
+const (
+	flagSyn byte = 0x01
+	flagFin byte = 0x02
+	flagRst byte = 0x04
+)
+
+const headerSize = 10
+
+var errMalformedFrame = errors.New("mux: malformed frame")
+
+type frame struct {
+	kind    byte
+	flags   byte
+	stream  uint32
+	delta   uint32
+	payload []byte
+}
+
+func (f frame) encode() []byte {
+	buffer := make([]byte, headerSize, headerSize+len(f.payload))
+	buffer[0] = f.kind
+	buffer[1] = f.flags
+	binary.BigEndian.PutUint32(buffer[2:], f.stream)
+	binary.BigEndian.PutUint32(buffer[6:], f.delta)
+	return append(buffer, f.payload...)
+}
+
+func decodeFrame(buffer []byte) (f frame, err error) {
+	if len(buffer) < headerSize {
+		return f, errMalformedFrame
+	}
+
+	f = frame{
+		kind:    buffer[0],
+		flags:   buffer[1],
+		stream:  binary.BigEndian.Uint32(buffer[2:]),
+		delta:   binary.BigEndian.Uint32(buffer[6:]),
+		payload: buffer[headerSize:],
+	}
+	if f.stream == 0 || (f.kind != typeData && f.kind != typeWindow) ||
+		(f.kind == typeWindow && len(f.payload) > 0) {
+
+		return f, errMalformedFrame
+	}
+	return f, nil
+}
@@ -0,0 +1,159 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mux
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+var errNotBound = errors.New("mux: handler not bound")
+
+// ErrNoSession is returned by Handler.Open for a connection that was not
+// reported connected yet, or that was disconnected.
+var ErrNoSession = errors.New("mux: no session")
+
+// Handler runs a Session on every connection of a socket.Client or
+// socket.Server. Frames are cobs encoded, so any framer keeps them apart.
+//
+//	handler := mux.NewHandler(true, mux.Config{}, accept)
+//	server := socket.NewTlsServer(host, port, handler, cert, key)
+//	handler.Bind(server.Send)
+type Handler struct {
+	server bool
+	config Config
+	accept func(id int, stream *Stream)
+
+	lock     sync.RWMutex
+	send     func(id int, msg []byte) error
+	sessions map[int]*Session
+}
+
+// NewHandler creates the handler of a server or a client. accept is called
+// in its own goroutine for every stream opened by a peer, if nil the streams
+// are taken with Session.AcceptStream.
+func NewHandler(server bool, config Config, accept func(id int, stream *Stream)) *Handler {
+	return &Handler{
+		server:   server,
+		config:   config,
+		accept:   accept,
+		sessions: make(map[int]*Session),
+	}
+}
+
+// Bind sets the function sending the frames of connection id, e.g.
+// socket.Server.Send.
+func (h *Handler) Bind(send func(id int, msg []byte) error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.send = send
+}
+
+// Session returns the session of connection id.
+func (h *Handler) Session(id int) (*Session, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	session, ok := h.sessions[id]
+	return session, ok
+}
+
+// Open opens a stream on connection id. The session starts with Connected,
+// before that Open fails with ErrNoSession.
+func (h *Handler) Open(id int) (*Stream, error) {
+	session, ok := h.Session(id)
+	if !ok {
+		return nil, ErrNoSession
+	}
+	return session.OpenStream()
+}
+
+func (h *Handler) Connected(id int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.sessions[id]; !ok {
+		h.sessions[id] = h.newSession(id)
+	}
+}
+
+func (h *Handler) Received(id int, message []byte) {
+	session, ok := h.Session(id)
+	if !ok {
+		_ = log.Warn("mux", "input from %d: %v", id, ErrNoSession)
+		return
+	}
+
+	frame, err := connection.CobsDecode(message)
+	if err == nil {
+		err = session.Input(frame)
+	}
+	if err != nil {
+		_ = log.Warn("mux", "input from %d: %v", id, err)
+	}
+}
+
+func (h *Handler) Disconnected(id int) {
+	h.lock.Lock()
+	session, ok := h.sessions[id]
+	delete(h.sessions, id)
+	h.lock.Unlock()
+
+	if ok {
+		_ = session.Close()
+	}
+}
+
+// newSession creates the session of id and its accept loop.
+func (h *Handler) newSession(id int) *Session {
+	session := NewSession(func(frame []byte) error {
+		h.lock.RLock()
+		send := h.send
+		h.lock.RUnlock()
+
+		if send == nil {
+			return errNotBound
+		}
+		return send(id, connection.CobsEncode(frame))
+	}, h.server, h.config)
+
+	if h.accept != nil {
+		go func() {
+			for {
+				stream, err := session.AcceptStream()
+				if err != nil {
+					return
+				}
+				go h.accept(id, stream)
+			}
+		}()
+	}
+	return session
+}
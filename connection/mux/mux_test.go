@@ -0,0 +1,313 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection/socket"
+)
+
+// pair connects two sessions through buffered channels.
+func pair(t *testing.T, config Config) (client *Session, server *Session) {
+	toServer := make(chan []byte, 1024)
+	toClient := make(chan []byte, 1024)
+	done := make(chan struct{})
+	var forwarders sync.WaitGroup
+	t.Cleanup(func() {
+		close(done)
+		forwarders.Wait()
+	})
+
+	transport := func(ch chan []byte) func(frame []byte) error {
+		return func(frame []byte) error {
+			select {
+			case ch <- frame:
+				return nil
+			case <-done:
+				return io.ErrClosedPipe
+			}
+		}
+	}
+	client = NewSession(transport(toServer), false, config)
+	server = NewSession(transport(toClient), true, config)
+
+	forward := func(ch chan []byte, session *Session) {
+		defer forwarders.Done()
+		for {
+			select {
+			case frame := <-ch:
+				if err := session.Input(frame); err != nil {
+					select {
+					case <-done:
+						return
+					default:
+						t.Error(err)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}
+	forwarders.Add(2)
+	go forward(toServer, server)
+	go forward(toClient, client)
+
+	return client, server
+}
+
+func TestStreams(t *testing.T) {
+	client, server := pair(t, Config{})
+
+	a, err := client.OpenStream()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	b, _ := client.OpenStream()
+	if a.ID() != 1 || b.ID() != 3 {
+		t.Error("unexpected ids: ", a.ID(), b.ID())
+	}
+
+	peerA, err := server.AcceptStream()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	peerB, _ := server.AcceptStream()
+
+	_, _ = b.Write([]byte("telemetry"))
+	_, _ = a.Write([]byte("control"))
+
+	buffer := make([]byte, 16)
+	if n, _ := peerA.Read(buffer); string(buffer[:n]) != "control" {
+		t.Error("unexpected data: ", string(buffer[:n]))
+	}
+	if n, _ := peerB.Read(buffer); string(buffer[:n]) != "telemetry" {
+		t.Error("unexpected data: ", string(buffer[:n]))
+	}
+
+	// half close, the peer reads eof and may still answer
+	_ = a.CloseWrite()
+	if _, err = peerA.Read(buffer); err != io.EOF {
+		t.Error("expected eof: ", err)
+	}
+	_, _ = peerA.Write([]byte("ack"))
+	if n, _ := a.Read(buffer); string(buffer[:n]) != "ack" {
+		t.Error("unexpected data: ", string(buffer[:n]))
+	}
+	_ = peerA.Close()
+	if _, err = a.Read(buffer); err != io.EOF {
+		t.Error("expected eof: ", err)
+	}
+
+	_ = peerB.Reset()
+	if _, err = b.Read(buffer); !errors.Is(err, ErrStreamReset) {
+		t.Error("expected reset: ", err)
+	}
+	if _, err = b.Write([]byte("x")); !errors.Is(err, ErrStreamReset) {
+		t.Error("expected reset: ", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if client.NumStreams() != 0 || server.NumStreams() != 0 {
+		t.Error("streams not removed: ", client.NumStreams(), server.NumStreams())
+	}
+
+	_ = b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	c, _ := server.OpenStream()
+	if c.ID() != 2 {
+		t.Error("unexpected server id: ", c.ID())
+	}
+	peerC, _ := client.AcceptStream()
+	_ = peerC.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err = peerC.Read(buffer); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("expected timeout: ", err)
+	}
+
+	_ = client.Close()
+	if _, err = peerC.Read(buffer); !errors.Is(err, ErrSessionClosed) {
+		t.Error("expected closed session: ", err)
+	}
+	if _, err = client.Accept(); !errors.Is(err, ErrSessionClosed) {
+		t.Error("expected closed session: ", err)
+	}
+}
+
+func TestFlowControl(t *testing.T) {
+	client, server := pair(t, Config{Window: 2 * initialWindow})
+
+	stream, _ := client.OpenStream()
+	peer, _ := server.AcceptStream()
+
+	data := make([]byte, 3*2*initialWindow)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := stream.Write(data)
+		written <- err
+	}()
+
+	select {
+	case err := <-written:
+		t.Error("write beyond the window: ", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	received, err := io.ReadAll(io.LimitReader(peer, int64(len(data))))
+	if err != nil || !bytes.Equal(received, data) {
+		t.Error("unexpected data: ", len(received), err)
+	}
+	if err = <-written; err != nil {
+		t.Error(err)
+	}
+
+	_ = stream.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err = stream.Write(data); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Error("expected timeout: ", err)
+	}
+}
+
+func TestCloseUnread(t *testing.T) {
+	client, server := pair(t, Config{})
+
+	for _, unread := range []bool{false, true} {
+		stream, _ := client.OpenStream()
+		peer, _ := server.AcceptStream()
+
+		if unread {
+			if _, err := stream.Write([]byte("unread")); err != nil {
+				t.Error(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		_ = peer.Close()
+
+		// the writer learns nobody reads instead of exhausting the window
+		written := make(chan error, 1)
+		go func() {
+			_, err := stream.Write(make([]byte, 2*initialWindow))
+			written <- err
+		}()
+
+		select {
+		case err := <-written:
+			if !errors.Is(err, ErrStreamReset) {
+				t.Error("expected reset: ", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("write to closed peer blocks, unread ", unread)
+			_ = stream.Reset()
+		}
+		if _, err := peer.Read(make([]byte, 1)); !errors.Is(err, ErrStreamClosed) {
+			t.Error("expected closed: ", err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	echo := func(id int, stream *Stream) {
+		defer stream.Close()
+		_, _ = io.Copy(stream, stream)
+	}
+
+	serverHandler := NewHandler(true, Config{}, echo)
+	s := socket.NewTcpServer("127.0.0.1", 0, serverHandler)
+	serverHandler.Bind(s.Send)
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	clientHandler := NewHandler(false, Config{}, nil)
+	c := socket.NewTcpClient("127.0.0.1", uint16(s.Addr().(*net.TCPAddr).Port), clientHandler)
+	clientHandler.Bind(func(_ int, msg []byte) error {
+		return c.Send(msg)
+	})
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	// the session starts with Connected, which the client reports from its
+	// reader
+	if _, err := clientHandler.Open(2); !errors.Is(err, ErrNoSession) {
+		t.Error("expected no session: ", err)
+	}
+	serverHandler.Received(99, []byte{0x01, 0x01})
+	if _, ok := serverHandler.Session(99); ok {
+		t.Error("session created by input")
+	}
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		if _, ok := clientHandler.Session(1); ok {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Error("client not connected")
+			t.FailNow()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, channel := range []string{"control", "telemetry", "logs"} {
+		wg.Add(1)
+		go func(channel string) {
+			defer wg.Done()
+
+			stream, err := clientHandler.Open(1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer stream.Close()
+
+			msg := bytes.Repeat([]byte(channel), 10000)
+			go func() {
+				_, _ = stream.Write(msg)
+				_ = stream.CloseWrite()
+			}()
+
+			received, err := io.ReadAll(stream)
+			if err != nil || !bytes.Equal(received, msg) {
+				t.Error(channel, ": unexpected echo ", len(received), err)
+			}
+		}(channel)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,287 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package mux runs independent logical streams over one connection, similar
+// to yamux. Frames are sent as messages, so a Session runs on top of a
+// socket.Client or socket.Server, see Handler. Every stream has its own flow
+// control window and is a net.Conn.
+package mux
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+const (
+	initialWindow  = 256 * 1024
+	maxPayload     = 16 * 1024
+	defaultBacklog = 64
+)
+
+var (
+	ErrSessionClosed = errors.New("mux: session closed")
+	ErrStreamClosed  = errors.New("mux: stream closed")
+	ErrStreamReset   = errors.New("mux: stream reset")
+)
+
+type Config struct {
+	// Window is the receive window per stream, at least and by default 256
+	// KiB. A writer blocks once it sent a full window not read yet.
+	Window uint32
+	// AcceptBacklog limits the streams opened by the peer and not accepted
+	// yet, 64 if not set. Further streams are reset.
+	AcceptBacklog int
+}
+
+// Session multiplexes the streams of one connection. Streams opened by the
+// client side have odd ids, the ones of the server side even ids.
+type Session struct {
+	config Config
+	send   func(frame []byte) error
+
+	lock    sync.Mutex
+	streams map[uint32]*Stream
+	nextId  uint32
+	closed  bool
+	accept  chan *Stream
+	done    chan struct{}
+}
+
+// NewSession starts a session, which sends its frames with send. Frames
+// received from the peer are passed to Input.
+func NewSession(send func(frame []byte) error, server bool, config Config) *Session {
+	if config.Window < initialWindow {
+		config.Window = initialWindow
+	}
+	if config.AcceptBacklog <= 0 {
+		config.AcceptBacklog = defaultBacklog
+	}
+
+	s := &Session{
+		config:  config,
+		send:    send,
+		streams: make(map[uint32]*Stream),
+		nextId:  1,
+		accept:  make(chan *Stream, config.AcceptBacklog),
+		done:    make(chan struct{}),
+	}
+	if server {
+		s.nextId = 2
+	}
+	return s
+}
+
+// OpenStream opens a new stream, the peer gets it from AcceptStream.
+func (s *Session) OpenStream() (*Stream, error) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil, ErrSessionClosed
+	}
+	stream := newStream(s, s.nextId)
+	s.streams[stream.id] = stream
+	s.nextId += 2
+	s.lock.Unlock()
+
+	err := s.write(frame{
+		kind:   typeWindow,
+		flags:  flagSyn,
+		stream: stream.id,
+		delta:  s.config.Window - initialWindow,
+	})
+	if err != nil {
+		s.remove(stream.id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Open opens a new stream as net.Conn.
+func (s *Session) Open() (net.Conn, error) {
+	return s.OpenStream()
+}
+
+// AcceptStream waits for the next stream opened by the peer.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.accept:
+		return stream, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Accept waits for the next stream opened by the peer, a Session is a
+// net.Listener.
+func (s *Session) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+// Addr returns the address of the session, see Stream.LocalAddr.
+func (s *Session) Addr() net.Addr {
+	return Addr(0)
+}
+
+// NumStreams returns the number of open streams.
+func (s *Session) NumStreams() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.streams)
+}
+
+// Close fails all streams with ErrSessionClosed. It does not notify the
+// peer, its session ends with the connection.
+func (s *Session) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+
+	streams := s.streams
+	s.streams = make(map[uint32]*Stream)
+	s.lock.Unlock()
+
+	for _, stream := range streams {
+		stream.abort(ErrSessionClosed)
+	}
+	return nil
+}
+
+// Input processes a frame received from the peer.
+func (s *Session) Input(buffer []byte) error {
+	f, err := decodeFrame(buffer)
+	if err != nil {
+		return err
+	}
+
+	if f.flags&flagSyn != 0 {
+		if err = s.incoming(f); err != nil {
+			return err
+		}
+	}
+
+	stream := s.get(f.stream)
+	if stream == nil {
+		if f.flags&(flagRst|flagSyn) == 0 {
+			return s.write(frame{kind: typeWindow, flags: flagRst, stream: f.stream})
+		}
+		return nil
+	}
+
+	switch f.kind {
+	case typeData:
+		if !stream.push(f.payload) {
+			stream.abort(ErrStreamReset)
+			s.remove(stream.id)
+			return errors.Join(fmt.Errorf("mux: stream %d exceeds its window", stream.id),
+				s.write(frame{kind: typeWindow, flags: flagRst, stream: stream.id}))
+		}
+		if len(f.payload) > 0 && stream.discards() {
+			return stream.Reset()
+		}
+	case typeWindow:
+		stream.grant(f.delta)
+	}
+
+	if f.flags&flagRst != 0 {
+		stream.abort(ErrStreamReset)
+		s.remove(stream.id)
+	} else if f.flags&flagFin != 0 && stream.finish() {
+		s.remove(stream.id)
+	}
+	return nil
+}
+
+// incoming registers a stream opened by the peer.
+func (s *Session) incoming(f frame) error {
+	if f.stream%2 == s.nextId%2 {
+		return fmt.Errorf("mux: peer opened stream %d of the wrong side", f.stream)
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return ErrSessionClosed
+	}
+	if _, ok := s.streams[f.stream]; ok {
+		s.lock.Unlock()
+		return fmt.Errorf("mux: stream %d opened twice", f.stream)
+	}
+
+	stream := newStream(s, f.stream)
+	select {
+	case s.accept <- stream:
+		s.streams[f.stream] = stream
+	default:
+		s.lock.Unlock()
+		return s.write(frame{kind: typeWindow, flags: flagRst, stream: f.stream})
+	}
+	s.lock.Unlock()
+
+	if delta := s.config.Window - initialWindow; delta > 0 {
+		return s.write(frame{kind: typeWindow, stream: f.stream, delta: delta})
+	}
+	return nil
+}
+
+func (s *Session) get(id uint32) *Stream {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.streams[id]
+}
+
+func (s *Session) remove(id uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.streams, id)
+}
+
+func (s *Session) write(f frame) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+	return s.send(f.encode())
+}
+
+// Addr is the address of a stream, its id.
+type Addr uint32
+
+func (a Addr) Network() string {
+	return "mux"
+}
+
+func (a Addr) String() string {
+	return fmt.Sprintf("mux:%d", uint32(a))
+}
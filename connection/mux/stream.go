@@ -0,0 +1,326 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Stream is a logical connection within a Session.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	lock          sync.Mutex
+	buffer        bytes.Buffer
+	recvWindow    uint32
+	consumed      uint32
+	sendWindow    uint32
+	closed        bool
+	writeClosed   bool
+	readClosed    bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readReady     chan struct{}
+	writeReady    chan struct{}
+}
+
+func newStream(session *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    session,
+		recvWindow: session.config.Window,
+		sendWindow: initialWindow,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+	}
+}
+
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Read reads the data received, io.EOF once the peer closed the stream.
+func (s *Stream) Read(p []byte) (int, error) {
+	for {
+		s.lock.Lock()
+		if s.buffer.Len() > 0 {
+			n, _ := s.buffer.Read(p)
+
+			var delta uint32
+			s.consumed += uint32(n)
+			if s.consumed >= s.session.config.Window/2 && !s.readClosed {
+				delta = s.consumed
+				s.consumed = 0
+				s.recvWindow += delta
+			}
+			s.lock.Unlock()
+
+			if delta > 0 {
+				_ = s.session.write(frame{kind: typeWindow, stream: s.id, delta: delta})
+			}
+			return n, nil
+		}
+
+		err := s.err
+		if s.closed {
+			err = ErrStreamClosed
+		} else if err == nil && s.readClosed {
+			err = io.EOF
+		}
+		deadline := s.readDeadline
+		s.lock.Unlock()
+
+		if err != nil {
+			return 0, err
+		}
+		if err = wait(s.readReady, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write blocks while the window of the peer is exhausted.
+func (s *Stream) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		s.lock.Lock()
+		err = s.err
+		if s.closed || (err == nil && s.writeClosed) {
+			err = ErrStreamClosed
+		}
+		if err != nil {
+			s.lock.Unlock()
+			return n, err
+		}
+
+		if s.sendWindow == 0 {
+			deadline := s.writeDeadline
+			s.lock.Unlock()
+
+			if err = wait(s.writeReady, deadline); err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		chunk := len(p) - n
+		if chunk > maxPayload {
+			chunk = maxPayload
+		}
+		if uint32(chunk) > s.sendWindow {
+			chunk = int(s.sendWindow)
+		}
+		s.sendWindow -= uint32(chunk)
+		s.lock.Unlock()
+
+		err = s.session.write(frame{kind: typeData, stream: s.id, payload: p[n : n+chunk]})
+		if err != nil {
+			return n, err
+		}
+		n += chunk
+	}
+	return n, nil
+}
+
+// CloseWrite ends the direction to the peer, it reads io.EOF. Reading goes
+// on until the peer closes its direction as well.
+func (s *Stream) CloseWrite() error {
+	s.lock.Lock()
+	if s.err != nil || s.writeClosed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	done := s.readClosed
+	s.lock.Unlock()
+
+	notify(s.writeReady)
+	if done {
+		s.session.remove(s.id)
+	}
+	return s.session.write(frame{kind: typeWindow, flags: flagFin, stream: s.id})
+}
+
+// Close closes both directions. If data is unread or received later, the
+// stream is reset, so the peer stops writing.
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.closed = true
+	unread := s.buffer.Len() > 0
+	s.buffer.Reset()
+	s.lock.Unlock()
+
+	notify(s.readReady)
+	if unread {
+		return s.Reset()
+	}
+	return s.CloseWrite()
+}
+
+// Reset aborts the stream on both sides, pending operations fail with
+// ErrStreamReset.
+func (s *Stream) Reset() error {
+	s.lock.Lock()
+	if s.err != nil {
+		s.lock.Unlock()
+		return nil
+	}
+	s.lock.Unlock()
+
+	s.abort(ErrStreamReset)
+	s.session.remove(s.id)
+	return s.session.write(frame{kind: typeWindow, flags: flagRst, stream: s.id})
+}
+
+func (s *Stream) LocalAddr() net.Addr {
+	return Addr(s.id)
+}
+
+func (s *Stream) RemoteAddr() net.Addr {
+	return Addr(s.id)
+}
+
+func (s *Stream) SetDeadline(t time.Time) error {
+	_ = s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+func (s *Stream) SetReadDeadline(t time.Time) error {
+	s.lock.Lock()
+	s.readDeadline = t
+	s.lock.Unlock()
+
+	notify(s.readReady)
+	return nil
+}
+
+func (s *Stream) SetWriteDeadline(t time.Time) error {
+	s.lock.Lock()
+	s.writeDeadline = t
+	s.lock.Unlock()
+
+	notify(s.writeReady)
+	return nil
+}
+
+// push buffers data received, it returns false if the peer exceeded the
+// window.
+func (s *Stream) push(data []byte) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if uint32(len(data)) > s.recvWindow {
+		return false
+	}
+	s.recvWindow -= uint32(len(data))
+
+	if s.err == nil && !s.closed && len(data) > 0 {
+		s.buffer.Write(data)
+		notify(s.readReady)
+	}
+	return true
+}
+
+// discards returns true, if the stream is closed locally and drops data.
+func (s *Stream) discards() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.closed && s.err == nil
+}
+
+func (s *Stream) grant(delta uint32) {
+	if delta == 0 {
+		return
+	}
+
+	s.lock.Lock()
+	s.sendWindow += delta
+	s.lock.Unlock()
+
+	notify(s.writeReady)
+}
+
+// finish marks the direction of the peer ended, it returns true once both
+// directions are.
+func (s *Stream) finish() bool {
+	s.lock.Lock()
+	s.readClosed = true
+	done := s.writeClosed
+	s.lock.Unlock()
+
+	notify(s.readReady)
+	return done
+}
+
+func (s *Stream) abort(err error) {
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+
+	notify(s.readReady)
+	notify(s.writeReady)
+}
+
+func notify(ready chan struct{}) {
+	select {
+	case ready <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until ready is notified or the deadline passed.
+func wait(ready <-chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(remaining)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+}
@@ -0,0 +1,137 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Environment holds the proxy settings of the ALL_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables or their lower case variants.
+type Environment struct {
+	AllProxy   *url.URL
+	HttpsProxy *url.URL
+	NoProxy    string
+}
+
+// FromEnvironment reads the proxy settings of the process.
+func FromEnvironment() (*Environment, error) {
+	env := &Environment{NoProxy: getEnv("NO_PROXY", "no_proxy")}
+
+	var err error
+	if value := getEnv("ALL_PROXY", "all_proxy"); value != "" {
+		if env.AllProxy, err = Parse(value); err != nil {
+			return nil, err
+		}
+	}
+	if value := getEnv("HTTPS_PROXY", "https_proxy"); value != "" {
+		if env.HttpsProxy, err = Parse(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+// ProxyFor returns the proxy for address, nil for a direct connection. TLS
+// connections prefer HTTPS_PROXY over ALL_PROXY.
+func (e *Environment) ProxyFor(address string, secure bool) *url.URL {
+	proxyURL := e.AllProxy
+	if secure && e.HttpsProxy != nil {
+		proxyURL = e.HttpsProxy
+	}
+
+	if proxyURL == nil || e.bypass(address) {
+		return nil
+	}
+	return proxyURL
+}
+
+// bypass matches address against the NO_PROXY entries: "*", host names with
+// their sub domains, ".domain" for sub domains only, IPs and CIDR ranges,
+// each with an optional port.
+func (e *Environment) bypass(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(e.NoProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			entryHost, entryPort = strings.Trim(entry, "[]"), ""
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		if entryIp := net.ParseIP(entryHost); entryIp != nil {
+			if ip != nil && entryIp.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(host, entryHost) {
+				return true
+			}
+		} else if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,343 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// echoServer returns the address of a server echoing every connection.
+func echoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// socks5Server is a minimal SOCKS5 proxy resolving names to target. It
+// reports the requested host.
+func socks5Server(t *testing.T, username, password, target string,
+	requested chan<- string) string {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSocks5(conn, username, password, target, requested)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveSocks5(conn net.Conn, username, password, target string,
+	requested chan<- string) {
+
+	defer conn.Close()
+
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	if username != "" {
+		_, _ = conn.Write([]byte{socks5Version, socks5UserPassword})
+
+		r := bufio.NewReader(conn)
+		readString := func() string {
+			size, _ := r.ReadByte()
+			value := make([]byte, size)
+			_, _ = io.ReadFull(r, value)
+			return string(value)
+		}
+		_, _ = r.ReadByte()
+		if readString() != username || readString() != password {
+			_, _ = conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		_, _ = conn.Write([]byte{0x01, 0x00})
+	} else {
+		_, _ = conn.Write([]byte{socks5Version, socks5NoAuth})
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	var host string
+	switch header[3] {
+	case socks5Domain:
+		size := make([]byte, 1)
+		_, _ = io.ReadFull(conn, size)
+		name := make([]byte, size[0])
+		_, _ = io.ReadFull(conn, name)
+		host = string(name)
+	case socks5IPv4:
+		ip := make([]byte, net.IPv4len)
+		_, _ = io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	}
+	_, _ = io.ReadFull(conn, make([]byte, 2))
+	requested <- host
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		_, _ = conn.Write([]byte{socks5Version, 0x05, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+
+	_, _ = conn.Write([]byte{socks5Version, 0, 0, socks5IPv4, 127, 0, 0, 1, 0, 0})
+	go func() { _, _ = io.Copy(upstream, conn) }()
+	_, _ = io.Copy(conn, upstream)
+}
+
+// connectServer is a minimal HTTP CONNECT proxy with basic authentication.
+// It sends greeting right after the response to test read ahead data.
+func connectServer(t *testing.T, username, password, greeting string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				request, err := http.ReadRequest(r)
+				if err != nil || request.Method != http.MethodConnect {
+					return
+				}
+
+				credentials := base64.StdEncoding.EncodeToString(
+					[]byte(username + ":" + password))
+				if request.Header.Get("Proxy-Authorization") != "Basic "+credentials {
+					_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+					return
+				}
+
+				upstream, err := net.Dial("tcp", request.Host)
+				if err != nil {
+					_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer upstream.Close()
+
+				_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n" + greeting))
+				go func() { _, _ = io.Copy(upstream, r) }()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func expectEcho(t *testing.T, conn net.Conn, prefix string) {
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Error(err)
+		return
+	}
+
+	buffer := make([]byte, len(prefix)+4)
+	if _, err := io.ReadFull(conn, buffer); err != nil {
+		t.Error(err)
+		return
+	}
+	if string(buffer) != prefix+"ping" {
+		t.Error("unexpected echo: ", string(buffer))
+	}
+}
+
+func TestSocks5(t *testing.T) {
+	target := echoServer(t)
+	_, port, _ := net.SplitHostPort(target)
+	requested := make(chan string, 2)
+	proxyAddr := socks5Server(t, "user", "secret", target, requested)
+
+	proxyURL, err := Parse("socks5://user:secret@" + proxyAddr)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the name is resolved by the proxy
+	conn, err := Dial(ctx, nil, proxyURL, "tcp", net.JoinHostPort("echo.internal", port))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	if host := <-requested; host != "echo.internal" {
+		t.Error("unexpected requested host: ", host)
+	}
+	expectEcho(t, conn, "")
+
+	proxyURL, _ = Parse("socks5://user:wrong@" + proxyAddr)
+	if _, err = Dial(ctx, nil, proxyURL, "tcp", target); !errors.Is(err, ErrAuthFailed) {
+		t.Error("expected authentication failure: ", err)
+	}
+}
+
+func TestHttpConnect(t *testing.T) {
+	target := echoServer(t)
+	proxyURL, err := Parse("http://user:secret@" + connectServer(t, "user", "secret", "hi"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	conn, err := Dial(context.Background(), nil, proxyURL, "tcp", target)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	expectEcho(t, conn, "hi")
+
+	proxyURL.User = nil
+	if _, err = Dial(context.Background(), nil, proxyURL, "tcp", target); !errors.Is(err, ErrAuthFailed) {
+		t.Error("expected authentication failure: ", err)
+	}
+	if _, err = Dial(context.Background(), nil, proxyURL, "udp", target); err == nil {
+		t.Error("udp accepted")
+	}
+}
+
+func TestParse(t *testing.T) {
+	proxyURL, err := Parse("proxy.internal:3128")
+	if err != nil || proxyURL.Scheme != "http" || proxyAddress(proxyURL) != "proxy.internal:3128" {
+		t.Error("unexpected proxy: ", proxyURL, err)
+	}
+	if proxyURL, _ = Parse("socks5h://proxy.internal"); proxyAddress(proxyURL) != "proxy.internal:1080" {
+		t.Error("unexpected default port: ", proxyAddress(proxyURL))
+	}
+	if _, err = Parse("ftp://proxy.internal"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Error("ftp accepted: ", err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("ALL_PROXY", "socks5://all.internal:1080")
+	t.Setenv("HTTPS_PROXY", "")
+	t.Setenv("https_proxy", "http://https.internal:3128")
+	t.Setenv("NO_PROXY", "example.com, .local, 10.0.0.0/8, 192.168.1.1, db.internal:5432")
+
+	env, err := FromEnvironment()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	expected := map[string]string{
+		"server.internal:80":  "all.internal:1080",
+		"example.com:80":      "",
+		"api.example.com:80":  "",
+		"notexample.com:80":   "all.internal:1080",
+		"printer.local:80":    "",
+		"local:80":            "all.internal:1080",
+		"10.1.2.3:22":         "",
+		"192.168.1.1:22":      "",
+		"192.168.1.2:22":      "all.internal:1080",
+		"db.internal:5432":    "",
+		"db.internal:5433":    "all.internal:1080",
+		"[2001:db8::1]:443":   "all.internal:1080",
+		"EXAMPLE.COM.:443":    "",
+		"unresolved.internal": "all.internal:1080",
+	}
+	for address, proxyHost := range expected {
+		host := ""
+		if proxyURL := env.ProxyFor(address, false); proxyURL != nil {
+			host = proxyURL.Host
+		}
+		if host != proxyHost {
+			t.Errorf("%s: unexpected proxy %q", address, host)
+		}
+	}
+
+	if proxyURL := env.ProxyFor("server.internal:443", true); proxyURL == nil ||
+		proxyURL.Host != "https.internal:3128" {
+
+		t.Error("unexpected tls proxy: ", proxyURL)
+	}
+
+	t.Setenv("NO_PROXY", "*")
+	if env, _ = FromEnvironment(); env.ProxyFor("server.internal:80", false) != nil {
+		t.Error("wildcard not bypassed")
+	}
+}
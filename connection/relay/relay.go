@@ -0,0 +1,282 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package relay forwards the connections of a socket.Server each to its own
+// socket.Client connection to an upstream, e.g. to terminate TLS in front of
+// a plain TCP service.
+package relay
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/socket"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// Endpoint is the listening or the upstream side of a relay.
+type Endpoint struct {
+	Protocol connection.Protocol
+	Host     string
+	Port     uint16
+	// Options of the server or client, e.g. socket.WithCertificate
+	Options []socket.Option
+}
+
+type Config struct {
+	Listen   Endpoint
+	Upstream Endpoint
+	// Raw pipes the byte stream of tcp, tls and unix sides unchanged.
+	// Otherwise messages are relayed, each side framed with its own framer,
+	// which bridges e.g. udp datagrams to framed tcp messages.
+	Raw bool
+	// IdleTimeout closes both sides of a connection, which relayed nothing
+	// in either direction for this duration. Zero disables it.
+	IdleTimeout time.Duration
+}
+
+// Stats counts the relayed payload bytes.
+type Stats struct {
+	// Upstream counts the bytes from the clients to the upstream
+	Upstream uint64
+	// Downstream counts the bytes from the upstream to the clients
+	Downstream uint64
+}
+
+type Relay struct {
+	config Config
+	server *socket.Server
+
+	lock  sync.Mutex
+	pairs map[int]*pair
+
+	upstream   atomic.Uint64
+	downstream atomic.Uint64
+}
+
+// pair is a client connection with its upstream connection.
+type pair struct {
+	id       int
+	upstream *socket.Client
+	idle     *time.Timer
+	// closed is set, once the upstream disconnected
+	closed atomic.Bool
+
+	upstreamBytes   atomic.Uint64
+	downstreamBytes atomic.Uint64
+}
+
+func New(config Config) (*Relay, error) {
+	if config.IdleTimeout < 0 {
+		return nil, errors.New("relay: negative idle timeout")
+	}
+
+	r := &Relay{
+		config: config,
+		pairs:  make(map[int]*pair),
+	}
+
+	server, err := socket.NewServerWithOptions(config.Listen.Host, config.Listen.Port,
+		r, config.Listen.Protocol, r.options(config.Listen)...)
+	if err != nil {
+		return nil, err
+	}
+	r.server = server
+
+	// validate the upstream once, it is dialed per connection
+	if _, err = r.newUpstream(&pair{}); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Relay) Start() error {
+	return r.server.ListenAndServe()
+}
+
+// Stop closes the listener and all connections on both sides.
+func (r *Relay) Stop() {
+	r.server.Stop()
+}
+
+// Addr returns the listening address, see socket.Server.Addr.
+func (r *Relay) Addr() net.Addr {
+	return r.server.Addr()
+}
+
+// Stats returns the bytes relayed over all connections.
+func (r *Relay) Stats() Stats {
+	return Stats{
+		Upstream:   r.upstream.Load(),
+		Downstream: r.downstream.Load(),
+	}
+}
+
+// ConnStats returns the bytes relayed for a connected client.
+func (r *Relay) ConnStats(id int) (Stats, bool) {
+	p := r.pair(id)
+	if p == nil {
+		return Stats{}, false
+	}
+
+	return Stats{
+		Upstream:   p.upstreamBytes.Load(),
+		Downstream: p.downstreamBytes.Load(),
+	}, true
+}
+
+// Connected dials the upstream for a new client. It blocks the reading of the
+// client, so nothing is received before the upstream is connected.
+func (r *Relay) Connected(id int) {
+	// a plain udp peer connects again with every datagram
+	r.lock.Lock()
+	_, paired := r.pairs[id]
+	r.lock.Unlock()
+	if paired {
+		return
+	}
+
+	p := &pair{id: id}
+
+	if r.config.IdleTimeout > 0 {
+		p.idle = time.AfterFunc(r.config.IdleTimeout, func() {
+			_ = log.Debug("relay", "connection %d idle", id)
+			_ = r.server.Disconnect(id)
+		})
+	}
+
+	upstream, err := r.newUpstream(p)
+	if err == nil {
+		err = upstream.Connect()
+	}
+	if err != nil {
+		_ = log.Warn("relay", "connect upstream for %d: %v", id, err)
+		if p.idle != nil {
+			p.idle.Stop()
+		}
+		_ = r.server.Disconnect(id)
+		return
+	}
+	p.upstream = upstream
+
+	r.lock.Lock()
+	r.pairs[id] = p
+	r.lock.Unlock()
+
+	_ = log.Debug("relay", "relay %d to %s", id, upstream.RemoteAddr())
+}
+
+func (r *Relay) Disconnected(id int) {
+	r.lock.Lock()
+	p := r.pairs[id]
+	delete(r.pairs, id)
+	r.lock.Unlock()
+
+	if p == nil {
+		return
+	}
+	if p.idle != nil {
+		p.idle.Stop()
+	}
+	if !p.closed.Load() {
+		_ = p.upstream.Disconnect()
+	}
+}
+
+// Received forwards a message of a client to its upstream.
+func (r *Relay) Received(id int, msg []byte) {
+	p := r.pair(id)
+	if p == nil {
+		return
+	}
+
+	if err := p.upstream.Send(msg); err != nil {
+		_ = log.Warn("relay", "send upstream for %d: %v", id, err)
+		_ = r.server.Disconnect(id)
+		return
+	}
+	p.active(r.config.IdleTimeout)
+	p.upstreamBytes.Add(uint64(len(msg)))
+	r.upstream.Add(uint64(len(msg)))
+}
+
+func (r *Relay) pair(id int) *pair {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.pairs[id]
+}
+
+func (r *Relay) newUpstream(p *pair) (*socket.Client, error) {
+	upstream := r.config.Upstream
+
+	return socket.NewClientWithOptions(upstream.Host, upstream.Port,
+		&upstreamHandler{relay: r, pair: p}, upstream.Protocol,
+		r.options(upstream)...)
+}
+
+func (r *Relay) options(endpoint Endpoint) []socket.Option {
+	options := append([]socket.Option{}, endpoint.Options...)
+	if r.config.Raw && endpoint.Protocol != connection.Udp {
+		options = append(options, socket.WithFramer(socket.RawFramer{}))
+	}
+	return options
+}
+
+func (p *pair) active(idleTimeout time.Duration) {
+	if p.idle != nil {
+		p.idle.Reset(idleTimeout)
+	}
+}
+
+// upstreamHandler forwards the messages of an upstream connection to its
+// client.
+type upstreamHandler struct {
+	relay *Relay
+	pair  *pair
+}
+
+func (h *upstreamHandler) Connected(int) {}
+
+func (h *upstreamHandler) Disconnected(int) {
+	h.pair.closed.Store(true)
+	_ = h.relay.server.Disconnect(h.pair.id)
+}
+
+func (h *upstreamHandler) Received(_ int, msg []byte) {
+	if err := h.relay.server.Send(h.pair.id, msg); err != nil {
+		_ = log.Warn("relay", "send to %d: %v", h.pair.id, err)
+		_ = h.relay.server.Disconnect(h.pair.id)
+		return
+	}
+	h.pair.active(h.relay.config.IdleTimeout)
+	h.pair.downstreamBytes.Add(uint64(len(msg)))
+	h.relay.downstream.Add(uint64(len(msg)))
+}
@@ -0,0 +1,282 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package relay
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/socket"
+	"github.com/ChrIgiSta/go-utils/crypto"
+)
+
+// echoHandler sends every message back to its sender.
+type echoHandler struct {
+	*connection.EventsToChannel
+	server *socket.Server
+}
+
+func (h *echoHandler) Received(id int, msg []byte) {
+	_ = h.server.Send(id, msg)
+}
+
+func echoServer(t *testing.T, proto connection.Protocol, host string,
+	events chan connection.Event) *socket.Server {
+
+	handler := &echoHandler{EventsToChannel: connection.NewEventsToChannel(nil, events)}
+	s := socket.NewServer(host, 0, handler, proto)
+	handler.server = s
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func port(addr net.Addr) uint16 {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return uint16(addr.Port)
+	case *net.UDPAddr:
+		return uint16(addr.Port)
+	}
+	return 0
+}
+
+func startRelay(t *testing.T, config Config) *Relay {
+	r, err := New(config)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = r.Start(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	t.Cleanup(r.Stop)
+	return r
+}
+
+func TestRawTlsToTcp(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err == nil {
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+
+	cert, privKey, err := crypto.CreateSelfsignedX509Certificate(big.NewInt(4001),
+		10, crypto.KeyLength2048Bit, crypto.CertificateSubject{
+			Organisation: "myOrg",
+			Country:      "CH",
+			CommonName:   "localhost",
+		})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r := startRelay(t, Config{
+		Listen: Endpoint{Protocol: connection.Tls, Host: "127.0.0.1",
+			Options: []socket.Option{socket.WithCertificate(cert, privKey)}},
+		Upstream: Endpoint{Protocol: connection.Tcp, Host: "127.0.0.1",
+			Port: port(upstream.Addr())},
+		Raw: true,
+	})
+
+	conn, err := tls.Dial("tcp", r.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// any byte passes in raw mode
+	payload := []byte{0, 1, 2, 0, 'r', 'a', 'w', 0}
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Write(payload); err != nil {
+		t.Error(err)
+	}
+	echo := make([]byte, len(payload))
+	if _, err = io.ReadFull(conn, echo); err != nil || !bytes.Equal(echo, payload) {
+		t.Error("unexpected echo: ", echo, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if stats := r.Stats(); stats.Upstream != uint64(len(payload)) ||
+		stats.Downstream != uint64(len(payload)) {
+
+		t.Error("unexpected stats: ", stats)
+	}
+}
+
+func TestUdpToTcpFraming(t *testing.T) {
+	upstream := echoServer(t, connection.Tcp, "127.0.0.1", make(chan connection.Event, 4))
+
+	r := startRelay(t, Config{
+		Listen:   Endpoint{Protocol: connection.Udp, Host: "127.0.0.1"},
+		Upstream: Endpoint{Protocol: connection.Tcp, Host: "127.0.0.1", Port: port(upstream.Addr())},
+	})
+
+	msgCh := make(chan connection.Message, 2)
+	c := socket.NewUdpClient("127.0.0.1", port(r.Addr()), connection.NewEventsToChannel(
+		msgCh, make(chan connection.Event, 2)))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	for _, msg := range []string{"first", "second"} {
+		if err := c.Send([]byte(msg)); err != nil {
+			t.Error(err)
+		}
+		select {
+		case echo := <-msgCh:
+			if string(echo.Content) != msg {
+				t.Error("unexpected echo: ", string(echo.Content))
+			}
+		case <-time.After(time.Second):
+			t.Error("no echo for ", msg)
+		}
+	}
+
+	if stats := r.Stats(); stats.Upstream != 11 || stats.Downstream != 11 {
+		t.Error("unexpected stats: ", stats)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	upstreamEvents := make(chan connection.Event, 4)
+	upstream := echoServer(t, connection.Unix, "/tmp/go-utils-relay.sock", upstreamEvents)
+
+	r := startRelay(t, Config{
+		Listen:      Endpoint{Protocol: connection.Tcp, Host: "127.0.0.1"},
+		Upstream:    Endpoint{Protocol: connection.Unix, Host: "/tmp/go-utils-relay.sock"},
+		IdleTimeout: 200 * time.Millisecond,
+	})
+
+	msgCh := make(chan connection.Message, 1)
+	evtCh := make(chan connection.Event, 2)
+	c := socket.NewTcpClient("127.0.0.1", port(r.Addr()), connection.NewEventsToChannel(
+		msgCh, evtCh))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+	<-evtCh
+
+	if err := c.Send([]byte("hello")); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-msgCh:
+	case <-time.After(time.Second):
+		t.Error("no echo")
+	}
+
+	id := 0
+	for evt := range upstreamEvents {
+		if evt.EventType == connection.CONNECTED {
+			id = evt.Id
+			break
+		}
+	}
+	if _, ok := upstream.Session(id); !ok {
+		t.Error("upstream not connected")
+	}
+
+	select {
+	case evt := <-evtCh:
+		if evt.EventType != connection.DISCONNECTED {
+			t.Error("client event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("idle connection not closed")
+	}
+
+	select {
+	case evt := <-upstreamEvents:
+		if evt.EventType != connection.DISCONNECTED {
+			t.Error("upstream event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("idle upstream not closed")
+	}
+}
+
+func TestUpstreamUnreachable(t *testing.T) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := port(listener.Addr())
+	listener.Close()
+
+	r := startRelay(t, Config{
+		Listen:   Endpoint{Protocol: connection.Tcp, Host: "127.0.0.1"},
+		Upstream: Endpoint{Protocol: connection.Tcp, Host: "127.0.0.1", Port: closedPort},
+	})
+
+	evtCh := make(chan connection.Event, 2)
+	c := socket.NewTcpClient("127.0.0.1", port(r.Addr()), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), evtCh))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+	<-evtCh
+
+	select {
+	case evt := <-evtCh:
+		if evt.EventType != connection.DISCONNECTED {
+			t.Error("client event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("client not disconnected")
+	}
+
+	if _, err := New(Config{
+		Listen:   Endpoint{Protocol: connection.Tcp},
+		Upstream: Endpoint{Protocol: connection.Udp, Options: []socket.Option{socket.WithStreams()}},
+	}); err == nil {
+		t.Error("invalid upstream accepted")
+	}
+}
@@ -0,0 +1,633 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package reliable
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+const (
+	DefaultWindow         = 64
+	DefaultInitialRTO     = 200 * time.Millisecond
+	DefaultMinRTO         = 20 * time.Millisecond
+	DefaultMaxRTO         = 5 * time.Second
+	DefaultMaxRetransmits = 8
+	DefaultMaxQueue       = 1024
+)
+
+const (
+	typeData    byte = 0xD1
+	typeAck     byte = 0xA1
+	typeForward byte = 0xF1
+
+	dataHeaderLen = 9
+	ackHeaderLen  = 9
+
+	// maxRetired epochs of a restarted peer are remembered
+	maxRetired = 4
+)
+
+var (
+	ErrClosed    = errors.New("reliable: session closed")
+	ErrQueueFull = errors.New("reliable: send queue full")
+	ErrMalformed = errors.New("reliable: malformed datagram")
+)
+
+type Config struct {
+	// Window is the maximum of unacknowledged messages in flight and the
+	// size of the reorder buffer of the receiver.
+	Window int
+	// MaxQueue limits the messages waiting for space in the window.
+	MaxQueue       int
+	InitialRTO     time.Duration
+	MinRTO         time.Duration
+	MaxRTO         time.Duration
+	MaxRetransmits int
+	// OnDeliveryFailed is called with messages which were not acknowledged
+	// after MaxRetransmits or were still in flight on Close.
+	OnDeliveryFailed func(id int, msg []byte)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.InitialRTO <= 0 {
+		c.InitialRTO = DefaultInitialRTO
+	}
+	if c.MinRTO <= 0 {
+		c.MinRTO = DefaultMinRTO
+	}
+	if c.MaxRTO <= 0 {
+		c.MaxRTO = DefaultMaxRTO
+	}
+	if c.MaxRetransmits <= 0 {
+		c.MaxRetransmits = DefaultMaxRetransmits
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = DefaultMaxQueue
+	}
+	return c
+}
+
+type pending struct {
+	seq         uint32
+	datagram    []byte
+	sent        time.Time
+	retransmits int
+}
+
+// Session provides ordered, reliable delivery between two peers on top of
+// an unreliable datagram transport. Every message is sent as a data datagram
+// with a sequence number and retransmitted until the peer acknowledges it.
+// The peer acknowledges cumulatively plus a bitmap of the messages received
+// out of order (selective ack).
+//
+// Datagram layout (big endian):
+//
+//	data:    0xD1 | epoch uint32 | sequence uint32 | payload
+//	ack:     0xA1 | epoch uint32 | next expected uint32 | bitmap
+//	forward: 0xF1 | epoch uint32 | next sequence uint32
+//
+// The epoch is chosen randomly per session, so a restarted peer is detected
+// and its sequence numbers start over. A new epoch is taken from the first
+// data datagram or a forward, delayed datagrams of earlier epochs are
+// ignored. When messages are given up, forward datagrams tell the peer to
+// skip them instead of waiting forever. Sequence numbers wrap around.
+type Session struct {
+	id      int
+	config  Config
+	output  func(datagram []byte) error
+	deliver func(msg []byte)
+
+	lock     sync.Mutex
+	closed   bool
+	timer    *time.Timer
+	epoch    uint32
+	nextSeq  uint32
+	inflight map[uint32]*pending
+	queue    [][]byte
+
+	ackedNext      uint32
+	abandoned      uint32
+	hasAbandoned   bool
+	forwardSent    time.Time
+	forwardRetries int
+
+	rto    time.Duration
+	srtt   time.Duration
+	rttvar time.Duration
+	hasRtt bool
+
+	rxLock    sync.Mutex
+	peerEpoch uint32
+	retired   []uint32
+	expected  uint32
+	reorder   map[uint32][]byte
+}
+
+// NewSession creates a session for peer id. output writes a datagram to the
+// peer, deliver is called in order with every received message.
+func NewSession(id int, config Config, output func(datagram []byte) error,
+	deliver func(msg []byte)) *Session {
+
+	config = config.withDefaults()
+
+	s := &Session{
+		id:        id,
+		config:    config,
+		output:    output,
+		deliver:   deliver,
+		epoch:     randomEpoch(),
+		nextSeq:   1,
+		inflight:  make(map[uint32]*pending),
+		ackedNext: 1,
+		rto:       config.InitialRTO,
+		expected:  1,
+		reorder:   make(map[uint32][]byte),
+	}
+	s.timer = time.AfterFunc(time.Hour, s.retransmit)
+	s.timer.Stop()
+
+	return s
+}
+
+// Send queues msg for reliable delivery. It does not block, messages beyond
+// the window wait in a queue of up to MaxQueue messages. Blocking would stall
+// handlers answering from within Received, as acks are processed by the same
+// reader.
+func (s *Session) Send(msg []byte) error {
+	s.lock.Lock()
+
+	if s.closed {
+		s.lock.Unlock()
+		return ErrClosed
+	}
+	if len(s.queue) >= s.config.MaxQueue {
+		s.lock.Unlock()
+		return ErrQueueFull
+	}
+
+	datagram := make([]byte, dataHeaderLen+len(msg))
+	datagram[0] = typeData
+	binary.BigEndian.PutUint32(datagram[1:], s.epoch)
+	copy(datagram[dataHeaderLen:], msg)
+
+	s.queue = append(s.queue, datagram)
+	send := s.fill()
+	s.lock.Unlock()
+
+	s.transmit(send)
+
+	return nil
+}
+
+// Input processes a datagram received from the peer.
+func (s *Session) Input(datagram []byte) error {
+	if len(datagram) < dataHeaderLen {
+		return ErrMalformed
+	}
+
+	switch datagram[0] {
+	case typeData, typeForward:
+		return s.inputData(datagram)
+	case typeAck:
+		s.inputAck(datagram)
+		return nil
+	}
+
+	return ErrMalformed
+}
+
+// InFlight returns the number of messages waiting for an acknowledgement.
+func (s *Session) InFlight() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.inflight)
+}
+
+// Queued returns the number of messages waiting for space in the window.
+func (s *Session) Queued() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.queue)
+}
+
+// RTO returns the current retransmission timeout.
+func (s *Session) RTO() time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.rto
+}
+
+// Close stops retransmissions. Messages still in flight are reported to
+// OnDeliveryFailed.
+func (s *Session) Close() {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	s.timer.Stop()
+
+	failed := make([]*pending, 0, len(s.inflight))
+	for seq, p := range s.inflight {
+		failed = append(failed, p)
+		delete(s.inflight, seq)
+	}
+	for _, datagram := range s.queue {
+		failed = append(failed, &pending{seq: s.nextSeq, datagram: datagram})
+		s.nextSeq++
+	}
+	s.queue = nil
+	s.lock.Unlock()
+
+	s.failed(failed)
+}
+
+func (s *Session) inputData(datagram []byte) error {
+	epoch := binary.BigEndian.Uint32(datagram[1:])
+	seq := binary.BigEndian.Uint32(datagram[5:])
+
+	s.rxLock.Lock()
+	defer s.rxLock.Unlock()
+
+	if epoch != s.peerEpoch {
+		if !s.restarted(epoch, datagram[0] == typeForward || seq == 1) {
+			return nil
+		}
+	}
+
+	if datagram[0] == typeForward {
+		// the peer gave up everything below seq, deliver what arrived
+		if before(s.expected, seq) {
+			var skipped []uint32
+			for buffered := range s.reorder {
+				if before(buffered, seq) {
+					skipped = append(skipped, buffered)
+				}
+			}
+			sort.Slice(skipped, func(i, j int) bool {
+				return before(skipped[i], skipped[j])
+			})
+
+			for _, buffered := range skipped {
+				msg := s.reorder[buffered]
+				delete(s.reorder, buffered)
+				s.deliver(msg)
+			}
+			s.expected = seq
+		}
+		return s.deliverInOrder()
+	}
+
+	window := uint32(s.config.Window)
+
+	if seq-s.expected < window {
+		if _, dup := s.reorder[seq]; !dup {
+			msg := make([]byte, len(datagram)-dataHeaderLen)
+			copy(msg, datagram[dataHeaderLen:])
+			s.reorder[seq] = msg
+		}
+	}
+
+	return s.deliverInOrder()
+}
+
+// restarted switches to the epoch of a restarted peer, if the datagram starts
+// its session. Earlier epochs stay ignored, the caller holds the rx lock.
+func (s *Session) restarted(epoch uint32, starts bool) bool {
+	for _, retired := range s.retired {
+		if retired == epoch {
+			return false
+		}
+	}
+	if s.peerEpoch != 0 && !starts {
+		return false
+	}
+
+	if s.peerEpoch != 0 {
+		_ = log.Debug("reliable", "peer %d restarted", s.id)
+		s.retired = append(s.retired, s.peerEpoch)
+		if len(s.retired) > maxRetired {
+			s.retired = s.retired[1:]
+		}
+	}
+	s.peerEpoch = epoch
+	s.expected = 1
+	s.reorder = make(map[uint32][]byte)
+	return true
+}
+
+// deliverInOrder delivers buffered messages and acks, the caller holds the
+// rx lock, which keeps deliveries sequential.
+func (s *Session) deliverInOrder() error {
+	for {
+		msg, ok := s.reorder[s.expected]
+		if !ok {
+			break
+		}
+		delete(s.reorder, s.expected)
+		s.expected++
+		s.deliver(msg)
+	}
+
+	return s.output(s.ack())
+}
+
+// ack builds an ack datagram, the caller holds the rx lock.
+func (s *Session) ack() []byte {
+	bitmap := make([]byte, (s.config.Window+7)/8)
+
+	for seq := range s.reorder {
+		bit := seq - s.expected - 1
+		if int(bit) < len(bitmap)*8 {
+			bitmap[bit/8] |= 1 << (bit % 8)
+		}
+	}
+
+	datagram := make([]byte, ackHeaderLen+len(bitmap))
+	datagram[0] = typeAck
+	binary.BigEndian.PutUint32(datagram[1:], s.peerEpoch)
+	binary.BigEndian.PutUint32(datagram[5:], s.expected)
+	copy(datagram[ackHeaderLen:], bitmap)
+
+	return datagram
+}
+
+func (s *Session) inputAck(datagram []byte) {
+	epoch := binary.BigEndian.Uint32(datagram[1:])
+	next := binary.BigEndian.Uint32(datagram[5:])
+	bitmap := datagram[ackHeaderLen:]
+
+	s.lock.Lock()
+
+	if epoch != s.epoch || s.closed {
+		s.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+
+	if before(s.ackedNext, next) {
+		s.ackedNext = next
+	}
+
+	for seq, p := range s.inflight {
+		isAcked := before(seq, next)
+
+		if !isAcked && before(next, seq) {
+			bit := seq - next - 1
+			isAcked = int(bit) < len(bitmap)*8 &&
+				bitmap[bit/8]&(1<<(bit%8)) != 0
+		}
+		if !isAcked {
+			continue
+		}
+
+		// Karn: no samples from retransmitted messages
+		if p.retransmits == 0 {
+			s.sampleRtt(now.Sub(p.sent))
+		}
+		delete(s.inflight, seq)
+	}
+
+	send := s.fill()
+	s.armTimer()
+	s.lock.Unlock()
+
+	s.transmit(send)
+}
+
+// sampleRtt updates the rto as described in RFC 6298.
+func (s *Session) sampleRtt(rtt time.Duration) {
+	if !s.hasRtt {
+		s.srtt = rtt
+		s.rttvar = rtt / 2
+		s.hasRtt = true
+	} else {
+		delta := s.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		s.rttvar = (3*s.rttvar + delta) / 4
+		s.srtt = (7*s.srtt + rtt) / 8
+	}
+
+	s.rto = s.srtt + 4*s.rttvar
+	if s.rto < s.config.MinRTO {
+		s.rto = s.config.MinRTO
+	}
+	if s.rto > s.config.MaxRTO {
+		s.rto = s.config.MaxRTO
+	}
+}
+
+// deadline of a message, backed off exponentially per retransmission.
+func (s *Session) deadline(p *pending) time.Time {
+	timeout := s.rto << uint(p.retransmits)
+	if timeout > s.config.MaxRTO || timeout <= 0 {
+		timeout = s.config.MaxRTO
+	}
+	return p.sent.Add(timeout)
+}
+
+// armTimer schedules the next retransmission check, the caller holds the lock.
+func (s *Session) armTimer() {
+	var earliest time.Time
+
+	for _, p := range s.inflight {
+		if d := s.deadline(p); earliest.IsZero() || d.Before(earliest) {
+			earliest = d
+		}
+	}
+	if s.forwardPending() {
+		d := s.forwardSent.Add(s.rto << uint(s.forwardRetries))
+		if earliest.IsZero() || d.Before(earliest) {
+			earliest = d
+		}
+	}
+
+	if earliest.IsZero() {
+		s.timer.Stop()
+		return
+	}
+	s.timer.Reset(time.Until(earliest))
+}
+
+// fill moves queued messages into the window and returns the datagrams to
+// transmit, the caller holds the lock.
+func (s *Session) fill() (send [][]byte) {
+	now := time.Now()
+
+	for len(s.queue) > 0 && len(s.inflight) < s.config.Window {
+		datagram := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+
+		seq := s.nextSeq
+		s.nextSeq++
+		binary.BigEndian.PutUint32(datagram[5:], seq)
+
+		s.inflight[seq] = &pending{seq: seq, datagram: datagram, sent: now}
+		send = append(send, datagram)
+	}
+
+	if len(send) > 0 {
+		s.armTimer()
+	}
+	return
+}
+
+func (s *Session) transmit(datagrams [][]byte) {
+	for _, datagram := range datagrams {
+		if err := s.output(datagram); err != nil {
+			_ = log.Warn("reliable", "send to %d: %v", s.id, err)
+		}
+	}
+}
+
+func (s *Session) retransmit() {
+	var (
+		resend [][]byte
+		failed []*pending
+	)
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	for seq, p := range s.inflight {
+		if now.Before(s.deadline(p)) {
+			continue
+		}
+		if p.retransmits >= s.config.MaxRetransmits {
+			failed = append(failed, p)
+			delete(s.inflight, seq)
+			if !s.hasAbandoned || before(s.abandoned, seq) {
+				s.abandoned = seq
+				s.hasAbandoned = true
+			}
+			s.forwardSent = time.Time{}
+			s.forwardRetries = 0
+			continue
+		}
+		p.retransmits++
+		p.sent = now
+		resend = append(resend, p.datagram)
+	}
+
+	resend = append(resend, s.fill()...)
+
+	if s.forwardPending() && !now.Before(
+		s.forwardSent.Add(s.rto<<uint(s.forwardRetries))) {
+
+		if s.forwardRetries >= s.config.MaxRetransmits {
+			s.hasAbandoned = false
+		} else {
+			if !s.forwardSent.IsZero() {
+				s.forwardRetries++
+			}
+			s.forwardSent = now
+			resend = append(resend, s.forward())
+		}
+	}
+	s.armTimer()
+	s.lock.Unlock()
+
+	s.transmit(resend)
+	s.failed(failed)
+}
+
+// forwardPending tells if the peer has not yet skipped abandoned messages,
+// the caller holds the lock.
+func (s *Session) forwardPending() bool {
+	return s.hasAbandoned && !before(s.abandoned, s.ackedNext)
+}
+
+// forward builds a datagram telling the peer to skip everything below the
+// oldest message still in flight, the caller holds the lock.
+func (s *Session) forward() []byte {
+	base := s.nextSeq
+	for seq := range s.inflight {
+		if before(seq, base) {
+			base = seq
+		}
+	}
+
+	datagram := make([]byte, dataHeaderLen)
+	datagram[0] = typeForward
+	binary.BigEndian.PutUint32(datagram[1:], s.epoch)
+	binary.BigEndian.PutUint32(datagram[5:], base)
+
+	return datagram
+}
+
+// failed reports undelivered messages in the order they were sent.
+func (s *Session) failed(msgs []*pending) {
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].seq < msgs[j].seq
+	})
+
+	for _, p := range msgs {
+		_ = log.Warn("reliable", "delivery of %d to %d failed", p.seq, s.id)
+		if s.config.OnDeliveryFailed != nil {
+			s.config.OnDeliveryFailed(s.id, p.datagram[dataHeaderLen:])
+		}
+	}
+}
+
+// before compares sequence numbers, which wrap around (RFC 1982).
+func before(a uint32, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+func randomEpoch() uint32 {
+	var raw [4]byte
+
+	for {
+		if _, err := rand.Read(raw[:]); err != nil {
+			return uint32(time.Now().UnixNano()) | 1
+		}
+		if epoch := binary.BigEndian.Uint32(raw[:]); epoch != 0 {
+			return epoch
+		}
+	}
+}
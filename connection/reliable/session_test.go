@@ -0,0 +1,354 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package reliable
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyLink connects two sessions, drops and reorders datagrams.
+type lossyLink struct {
+	lock sync.Mutex
+	rng  *rand.Rand
+	loss float64
+	peer *Session
+}
+
+func (l *lossyLink) output(datagram []byte) error {
+	l.lock.Lock()
+	drop := l.rng.Float64() < l.loss
+	delay := time.Duration(l.rng.Intn(5)) * time.Millisecond
+	l.lock.Unlock()
+
+	if drop {
+		return nil
+	}
+
+	copied := make([]byte, len(datagram))
+	copy(copied, datagram)
+	time.AfterFunc(delay, func() {
+		_ = l.peer.Input(copied)
+	})
+	return nil
+}
+
+func TestReliableLossyInOrder(t *testing.T) {
+	const count = 200
+
+	received := make(chan string, count)
+	config := Config{Window: 16, MinRTO: 5 * time.Millisecond,
+		MaxRTO: 100 * time.Millisecond, MaxRetransmits: 50}
+
+	aToB := &lossyLink{rng: rand.New(rand.NewSource(1)), loss: 0.3}
+	bToA := &lossyLink{rng: rand.New(rand.NewSource(2)), loss: 0.3}
+
+	a := NewSession(1, config, aToB.output, func(msg []byte) {})
+	b := NewSession(2, config, bToA.output, func(msg []byte) {
+		received <- string(msg)
+	})
+	aToB.peer = b
+	bToA.peer = a
+
+	for i := 0; i < count; i++ {
+		if err := a.Send([]byte(fmt.Sprintf("msg %d", i))); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case msg := <-received:
+			if msg != fmt.Sprintf("msg %d", i) {
+				t.Error("out of order: ", msg, " expected ", i)
+				t.FailNow()
+			}
+		case <-time.After(10 * time.Second):
+			t.Error("timeout waiting for message ", i)
+			t.FailNow()
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for a.InFlight() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.InFlight() != 0 || a.Queued() != 0 {
+		t.Error("messages left: ", a.InFlight(), a.Queued())
+	}
+
+	select {
+	case msg := <-received:
+		t.Error("duplicate delivery: ", msg)
+	default:
+	}
+
+	a.Close()
+	b.Close()
+}
+
+func TestReliableDuplicateSuppression(t *testing.T) {
+	var datagrams [][]byte
+	delivered := 0
+
+	sender := NewSession(1, Config{}, func(datagram []byte) error {
+		datagrams = append(datagrams, datagram)
+		return nil
+	}, func(msg []byte) {})
+	receiver := NewSession(2, Config{}, func(datagram []byte) error {
+		return nil
+	}, func(msg []byte) {
+		delivered++
+	})
+
+	if err := sender.Send([]byte("once")); err != nil {
+		t.Error(err)
+	}
+	sender.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := receiver.Input(datagrams[0]); err != nil {
+			t.Error(err)
+		}
+	}
+	if delivered != 1 {
+		t.Error("delivered ", delivered, " times")
+	}
+
+	if err := receiver.Input([]byte{0x00, 0x01}); err != ErrMalformed {
+		t.Error("malformed datagram accepted")
+	}
+	receiver.Close()
+}
+
+func TestReliableDeliveryFailed(t *testing.T) {
+	failed := make(chan string, 2)
+
+	s := NewSession(1, Config{
+		InitialRTO:     5 * time.Millisecond,
+		MaxRetransmits: 2,
+		OnDeliveryFailed: func(id int, msg []byte) {
+			failed <- fmt.Sprintf("%d:%s", id, string(msg))
+		},
+	}, func(datagram []byte) error {
+		return nil
+	}, func(msg []byte) {})
+	defer s.Close()
+
+	if err := s.Send([]byte("lost")); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-failed:
+		if msg != "1:lost" {
+			t.Error("unexpected failed message: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("delivery failed not reported")
+	}
+
+	if s.InFlight() != 0 {
+		t.Error("failed message still in flight")
+	}
+}
+
+func TestReliableForwardAbandoned(t *testing.T) {
+	received := make(chan string, 2)
+
+	var receiver *Session
+
+	sender := NewSession(1, Config{
+		InitialRTO:     5 * time.Millisecond,
+		MaxRetransmits: 1,
+	}, func(datagram []byte) error {
+		// the first message never arrives
+		if datagram[0] == typeData && datagram[8] == 1 {
+			return nil
+		}
+		return receiver.Input(datagram)
+	}, func(msg []byte) {})
+	defer sender.Close()
+
+	receiver = NewSession(2, Config{}, func(datagram []byte) error {
+		return sender.Input(datagram)
+	}, func(msg []byte) {
+		received <- string(msg)
+	})
+	defer receiver.Close()
+
+	if err := sender.Send([]byte("lost")); err != nil {
+		t.Error(err)
+	}
+	if err := sender.Send([]byte("behind the gap")); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg != "behind the gap" {
+			t.Error("unexpected message: ", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("receiver stuck behind abandoned message")
+	}
+}
+
+func TestReliablePeerRestart(t *testing.T) {
+	var delivered []string
+
+	receiver := NewSession(2, Config{}, func(datagram []byte) error {
+		return nil
+	}, func(msg []byte) {
+		delivered = append(delivered, string(msg))
+	})
+	defer receiver.Close()
+
+	for _, text := range []string{"before", "after"} {
+		sender := NewSession(1, Config{}, func(datagram []byte) error {
+			return receiver.Input(datagram)
+		}, func(msg []byte) {})
+
+		if err := sender.Send([]byte(text)); err != nil {
+			t.Error(err)
+		}
+		sender.Close()
+	}
+
+	if len(delivered) != 2 || delivered[1] != "after" {
+		t.Error("restarted peer not delivered: ", delivered)
+	}
+}
+
+func TestReliableStaleEpoch(t *testing.T) {
+	delivered := make(chan string, 8)
+
+	receiver := NewSession(2, Config{}, func(datagram []byte) error {
+		return nil
+	}, func(msg []byte) {
+		delivered <- string(msg)
+	})
+	defer receiver.Close()
+
+	var datagrams [][]byte
+	old := NewSession(1, Config{}, func(datagram []byte) error {
+		datagrams = append(datagrams, append([]byte(nil), datagram...))
+		return nil
+	}, func(msg []byte) {})
+	for _, text := range []string{"old 1", "old 2"} {
+		if err := old.Send([]byte(text)); err != nil {
+			t.Error(err)
+		}
+	}
+	old.Close()
+	_ = receiver.Input(datagrams[0])
+
+	var lock sync.Mutex
+	var late []byte
+	restarted := NewSession(1, Config{}, func(datagram []byte) error {
+		lock.Lock()
+		if late == nil {
+			late = append([]byte(nil), datagram...)
+			lock.Unlock()
+			return nil
+		}
+		lock.Unlock()
+		return receiver.Input(datagram)
+	}, func(msg []byte) {})
+	defer restarted.Close()
+
+	// the first message of the new epoch is late, the second one does not
+	// restart the session and is retransmitted
+	for _, text := range []string{"new 1", "new 2"} {
+		if err := restarted.Send([]byte(text)); err != nil {
+			t.Error(err)
+		}
+	}
+	lock.Lock()
+	_ = receiver.Input(late)
+	lock.Unlock()
+
+	// a delayed datagram of the old epoch is ignored
+	_ = receiver.Input(datagrams[1])
+
+	if err := restarted.Send([]byte("new 3")); err != nil {
+		t.Error(err)
+	}
+
+	for _, expected := range []string{"old 1", "new 1", "new 2", "new 3"} {
+		select {
+		case msg := <-delivered:
+			if msg != expected {
+				t.Error("unexpected delivery: ", msg, ", expected ", expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("not delivered: ", expected)
+			t.FailNow()
+		}
+	}
+}
+
+func TestReliableSequenceWrap(t *testing.T) {
+	var delivered []string
+
+	receiver := NewSession(2, Config{}, func(datagram []byte) error {
+		return nil
+	}, func(msg []byte) {
+		delivered = append(delivered, string(msg))
+	})
+	defer receiver.Close()
+
+	var sender *Session
+	sender = NewSession(1, Config{}, func(datagram []byte) error {
+		return receiver.Input(datagram)
+	}, func(msg []byte) {})
+	defer sender.Close()
+
+	// both sides just before the wrap
+	sender.nextSeq, sender.ackedNext = 0xFFFFFFFE, 0xFFFFFFFE
+	receiver.peerEpoch, receiver.expected = sender.epoch, 0xFFFFFFFE
+
+	receiver.output = func(datagram []byte) error {
+		return sender.Input(datagram)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := sender.Send([]byte(fmt.Sprint(i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if fmt.Sprint(delivered) != "[0 1 2 3]" {
+		t.Error("unexpected deliveries: ", delivered)
+	}
+	if sender.InFlight() != 0 {
+		t.Error("acks across the wrap not accepted: ", sender.InFlight())
+	}
+}
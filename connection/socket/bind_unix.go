@@ -0,0 +1,96 @@
+//go:build unix
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// bindPrivate binds a unix socket in a private directory next to its path,
+// applies the options and moves it into place, so nobody connects before.
+func bindPrivate(addr *net.UnixAddr, options UnixOptions,
+	listen func(path string) (net.Listener, error)) (net.Listener, error) {
+
+	dir, err := os.MkdirTemp(filepath.Dir(addr.Name), ".s")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(addr.Name))
+	listener, err := listen(path)
+	if err != nil {
+		return nil, err
+	}
+	unixListener, ok := listener.(*net.UnixListener)
+	if !ok {
+		listener.Close()
+		return nil, errors.New("unexpected unix listener")
+	}
+	unixListener.SetUnlinkOnClose(false)
+
+	if err = applyUnixOptions(path, options); err == nil {
+		err = os.Rename(path, addr.Name)
+	}
+	if err != nil {
+		unixListener.Close()
+		return nil, err
+	}
+
+	moved := &movedUnixListener{UnixListener: unixListener, addr: addr}
+	moved.unlink.Store(true)
+	return moved, nil
+}
+
+// movedUnixListener is a unix listener, whose socket file was moved after
+// binding. It reports and removes the moved file.
+type movedUnixListener struct {
+	*net.UnixListener
+	addr   *net.UnixAddr
+	unlink atomic.Bool
+}
+
+func (l *movedUnixListener) Addr() net.Addr {
+	return l.addr
+}
+
+func (l *movedUnixListener) SetUnlinkOnClose(unlink bool) {
+	l.unlink.Store(unlink)
+}
+
+func (l *movedUnixListener) Close() error {
+	err := l.UnixListener.Close()
+	if l.unlink.Swap(false) {
+		_ = os.Remove(l.addr.Name)
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/capture"
+)
+
+func TestCaptureClientServer(t *testing.T) {
+	cMsgCh := make(chan connection.Message, 1)
+	cEvtCh := make(chan connection.Event, 1)
+
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	buffer := new(bytes.Buffer)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTcpServer("localhost", 0, sCh)
+	s.SetRecorder(capture.NewJsonWriter(buffer))
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTcpClient("localhost", boundPort(t, s), cCh)
+
+	err = c.Connect()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	<-cEvtCh
+	sEvt := <-sEvtCh
+
+	if err = c.Send([]byte("hello server")); err != nil {
+		t.Error(err)
+	}
+	<-sMsgCh
+
+	if err = s.Send(sEvt.Id, []byte("hello client")); err != nil {
+		t.Error(err)
+	}
+	<-cMsgCh
+
+	if err = c.Disconnect(); err != nil {
+		t.Error(err)
+	}
+	s.Stop()
+
+	records, err := capture.NewJsonReader(buffer).ReadAll()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if len(records) != 2 {
+		t.Error("unexpected record count: ", len(records))
+		t.FailNow()
+	}
+
+	if records[0].Direction != capture.Rx ||
+		string(records[0].Payload) != "hello server" ||
+		records[0].Id != sEvt.Id || records[0].Remote == "" {
+
+		t.Error("unexpected rx record: ", records[0])
+	}
+	if records[1].Direction != capture.Tx ||
+		string(records[1].Payload) != "hello client" ||
+		records[1].Time.Before(records[0].Time) {
+
+		t.Error("unexpected tx record: ", records[1])
+	}
+
+	if time.Since(records[0].Time) > time.Minute {
+		t.Error("unexpected timestamp: ", records[0].Time)
+	}
+}
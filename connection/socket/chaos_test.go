@@ -0,0 +1,121 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/chaos"
+)
+
+func TestChaosClientServer(t *testing.T) {
+	cMsgCh := make(chan connection.Message, 1)
+	cEvtCh := make(chan connection.Event, 4)
+
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTcpServer("localhost", 0, sCh)
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTcpClient("localhost", boundPort(t, s), cCh)
+	c.SetConnWrapper(chaos.NewInjector(chaos.Config{
+		Seed:            1,
+		DisconnectAfter: 8,
+	}))
+
+	err = c.Connect()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if cEvt := <-cEvtCh; cEvt.EventType != connection.CONNECTED {
+		t.Error("client event is not connected")
+		t.FailNow()
+	}
+	if sEvt := <-sEvtCh; sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+		t.FailNow()
+	}
+
+	if err = c.Send([]byte("hi")); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case sMsg := <-sMsgCh:
+		if string(sMsg.Content) != "hi" {
+			t.Error("unexpected rx on server: ", string(sMsg.Content))
+		}
+	default:
+		t.Error("server no rx")
+	}
+
+	if err = c.Send([]byte("cut off")); err == nil {
+		t.Error("expected injected disconnect")
+	}
+
+	// the injected disconnect closes the connection before Send returns, so
+	// the reader may report it first
+	writeError, disconnected := false, false
+	for !writeError || !disconnected {
+		select {
+		case cEvt := <-cEvtCh:
+			switch cEvt.EventType {
+			case connection.ERROR:
+				writeError = writeError || cEvt.Category == connection.WriteError
+			case connection.DISCONNECTED:
+				disconnected = true
+			default:
+				t.Error("unexpected client event: ", cEvt.EventType)
+			}
+		case <-time.After(time.Second):
+			t.Error("client not disconnected or no write error")
+			writeError, disconnected = true, true
+		}
+	}
+
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.DISCONNECTED {
+			t.Error("server event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("server not disconnected")
+	}
+}
@@ -27,13 +27,24 @@ package socket
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/capture"
+	"github.com/ChrIgiSta/go-utils/connection/diskqueue"
+	"github.com/ChrIgiSta/go-utils/connection/proxy"
+	"github.com/ChrIgiSta/go-utils/connection/reliable"
+	"github.com/ChrIgiSta/go-utils/connection/trace"
 	log "github.com/ChrIgiSta/go-utils/logger"
 )
 
@@ -41,25 +52,53 @@ type Client struct {
 	host        string
 	port        uint16
 	conn        net.Conn
-	connected   bool
+	connected   atomic.Bool
 	wg          sync.WaitGroup
-	interrupted bool
+	interrupted atomic.Bool
 	handler     connection.Handler
 	proto       connection.Protocol
 	tlsConfig   *tls.Config
+	framer      Framer
+	timeouts    Timeouts
+	logger      log.LoggingInteface
+	wrapper     connection.ConnWrapper
+	recorder    capture.Recorder
+	options     SocketOptions
+	proxy       proxySelector
+	handshake   time.Duration
+
+	reliableConfig *reliable.Config
+	session        *reliable.Session
+
+	streams   bool
+	streamIds atomic.Uint32
+	outgoing  outgoingStreams
+
+	// writeLock serializes the frames written to the connection
+	writeLock sync.Mutex
+
+	priorities *PriorityConfig
+	queueLock  sync.Mutex
+	queue      *priorityQueue
+
+	offline     *diskqueue.Queue
+	offlineLock sync.Mutex
+	replaying   bool
+
+	oversized atomic.Uint64
+
+	tracing     tracing
+	connectedAt time.Time
+	span        trace.SpanContext
 }
 
 func NewClient(host string, port uint16, handler connection.Handler, protocol connection.Protocol) *Client {
-
-	return &Client{
-		host:        host,
-		port:        port,
-		connected:   false,
-		wg:          sync.WaitGroup{},
-		interrupted: false,
-		handler:     handler,
-		proto:       protocol,
+	client, err := newClient(host, port, handler, protocol)
+	if err != nil {
+		_ = log.Error("socket", "setup client: %v", err)
 	}
+
+	return client
 }
 
 func NewTcpClient(host string, port uint16, handler connection.Handler) *Client {
@@ -71,8 +110,9 @@ func NewUdpClient(host string, port uint16, handler connection.Handler) *Client
 }
 
 func NewTlsClient(host string, port uint16, handle connection.Handler, caCert []byte, verifyServer bool) *Client {
-	client := NewClient(host, port, handle, connection.Tls)
-	if err := client.TlsConfig(caCert, verifyServer); err != nil {
+	client, err := newClient(host, port, handle, connection.Tls,
+		WithRootCA(caCert, verifyServer))
+	if err != nil {
 		_ = log.Error("socket", "setup tls client: %v", err)
 	}
 
@@ -87,7 +127,7 @@ func (c *Client) TlsConfig(caCertificates []byte, verifyCert bool) error {
 	caCertPool := x509.NewCertPool()
 	ok := caCertPool.AppendCertsFromPEM(caCertificates)
 	if !ok {
-		_ = log.Error("socket", "load ca cert: \r\n%v\r\n", string(caCertificates))
+		_ = c.logger.Error("socket", "load ca cert: \r\n%v\r\n", string(caCertificates))
 		return errors.New("cannot load ca certs")
 	}
 	c.tlsConfig = &tls.Config{RootCAs: caCertPool, InsecureSkipVerify: !verifyCert}
@@ -95,49 +135,187 @@ func (c *Client) TlsConfig(caCertificates []byte, verifyCert bool) error {
 	return nil
 }
 
+// SetConnWrapper decorates the connections opened on Connect. On TLS the
+// wrapper sees the raw TCP connection underneath the TLS layer.
+func (c *Client) SetConnWrapper(wrapper connection.ConnWrapper) {
+	c.wrapper = wrapper
+}
+
+// SetRecorder records every framed message sent and received.
+func (c *Client) SetRecorder(recorder capture.Recorder) {
+	c.recorder = recorder
+}
+
 func (c *Client) Connect() (err error) {
-	c.interrupted = false
+	c.interrupted.Store(false)
+	start := time.Now()
+	c.span = c.tracing.connection()
 
+	var conn net.Conn
 	switch c.proto {
 	case connection.Tcp:
-		c.conn, err = c.dailTcp()
+		conn, err = c.dailTcp()
 	case connection.Udp:
-		c.conn, err = c.dailUdp()
+		conn, err = c.dailUdp()
 	case connection.Tls:
-		c.conn, err = c.dailTls()
+		conn, err = c.dailTls()
 	case connection.Unix:
-		c.conn, err = c.dailUnix()
+		conn, err = c.dailUnix()
 	default:
 		err = errors.New("unknown protocol")
 	}
 
-	if err != nil || c.conn == nil {
-		if err == nil {
-			err = errors.New("connection nil")
-		}
+	if err == nil && conn == nil {
+		err = errors.New("connection nil")
+	}
+	c.tracing.lifecycle(trace.Dial, 1, start, err, c.span,
+		trace.AttrProtocol, string(c.proto), trace.AttrPeer, connection.Address(c.host, c.port))
+	if err != nil {
+		c.tracing.emit(trace.Close, 1, start, err, c.span, trace.SpanContext{})
 		return err
 	}
+	c.connectedAt = start
+
+	// the replay of the offline queue sends under this lock
+	c.offlineLock.Lock()
+	c.conn = conn
+	c.offlineLock.Unlock()
+
+	if c.reliableConfig != nil {
+		c.session = c.newReliableSession()
+	}
+
+	c.startQueue()
+
+	if c.streams {
+		c.outgoing.connect(1)
+	}
 
 	c.wg.Add(1)
-	c.connected = true
+	c.connected.Store(true)
 	go c.reader(&c.wg)
 
+	if c.offline != nil {
+		c.offlineLock.Lock()
+		c.startReplay()
+		c.offlineLock.Unlock()
+	}
+
 	return
 }
 
 func (c *Client) Send(msg []byte) error {
+	return c.SendContext(context.Background(), msg)
+}
+
+// SendContext sends msg within the trace carried by ctx, see WithTracer and
+// WithTraceparent.
+func (c *Client) SendContext(ctx context.Context, msg []byte) (err error) {
+	start := time.Now()
+	msg, span, parent := c.tracing.inject(ctx, msg)
+
+	if c.offline != nil {
+		err = c.sendOffline(msg)
+	} else {
+		err = c.transmit(msg)
+	}
+
+	c.tracing.emit(trace.Send, 1, start, err, span, parent,
+		trace.AttrSize, strconv.Itoa(len(msg)))
+	return err
+}
+
+// transmit sends msg on the current connection.
+func (c *Client) transmit(msg []byte) error {
 	if c.conn == nil {
 		return errors.New("not connected")
 	}
 
-	_, err := c.conn.Write(connection.AppendDelimeter(msg))
+	if c.priorities != nil {
+		return c.enqueue(msg, PriorityNormal)
+	}
+	return c.send(msg)
+}
+
+func (c *Client) send(msg []byte) error {
+	if c.session != nil {
+		err := c.session.Send(msg)
+		if err == nil {
+			c.record(capture.Tx, msg)
+		}
+		return err
+	}
+
+	frame := msg
+	if c.streams {
+		frame = messageFrame(msg)
+	}
+
+	err := writeFrame(c.conn, &c.writeLock, c.framer, c.timeouts.Write, frame)
+	if err == nil {
+		c.record(capture.Tx, msg)
+	} else {
+		notifyError(c.handler, 1, connection.WriteError, err)
+	}
 	return err
 }
 
+// LocalAddr returns the local address of the connection, nil if the client
+// never connected.
+func (c *Client) LocalAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.LocalAddr()
+}
+
+// TLS returns the state of a TLS connection, e.g. the negotiated ALPN
+// protocol. It is nil on other protocols.
+func (c *Client) TLS() *tls.ConnectionState {
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// HandshakeDuration returns how long the last TLS handshake took.
+func (c *Client) HandshakeDuration() time.Duration {
+	return c.handshake
+}
+
+// Resumed reports, if the TLS session was resumed without full handshake,
+// see WithSessionCache.
+func (c *Client) Resumed() bool {
+	state := c.TLS()
+	return state != nil && state.DidResume
+}
+
+// OversizedFrames returns the number of received messages, which exceeded
+// the max frame size.
+func (c *Client) OversizedFrames() uint64 {
+	return c.oversized.Load()
+}
+
+// RemoteAddr returns the address of the server, nil if the client never
+// connected.
+func (c *Client) RemoteAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.RemoteAddr()
+}
+
 func (c *Client) Disconnect() (err error) {
 	defer c.wg.Wait()
 
-	c.interrupted = true
+	c.interrupted.Store(true)
+
+	if c.session != nil {
+		c.session.Close()
+	}
 
 	err = c.conn.Close()
 	return
@@ -147,50 +325,169 @@ func (c *Client) reader(wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer c.conn.Close()
 	defer c.handler.Disconnected(1)
+	defer func() {
+		if queue := c.currentQueue(); queue != nil {
+			queue.close()
+		}
+	}()
 
 	c.handler.Connected(1)
 
-	bufReader := bufio.NewReader(c.conn)
+	_ = c.logger.Debug("socket", "client: connected")
+
+	if c.session != nil {
+		c.readReliable()
+	} else {
+		c.readFrames()
+	}
+
+	_ = c.logger.Debug("socket", "client: disconnected")
+	c.tracing.emit(trace.Close, 1, c.connectedAt, nil, c.span, trace.SpanContext{})
 
-	_ = log.Debug("socket", "client: connected")
+	c.connected.Store(false)
+}
 
-	for !c.interrupted {
-		msg, err := bufReader.ReadBytes(connection.DefaultDelimiter)
+func (c *Client) readFrames() {
+	var bufReader *bufio.Reader
 
+	fds := newFdReader(c.conn, c.logger)
+	if fds != nil {
+		bufReader = getReader(fds)
+		defer fds.close()
+	} else {
+		bufReader = getReader(c.conn)
+	}
+	defer putReader(bufReader)
+
+	received := func(msg []byte) {
+		c.record(capture.Rx, msg)
+		c.tracing.deliver(c.handler, 1, msg)
+	}
+
+	var demux *streamDemux
+	if c.streams {
+		demux = newStreamDemux(1, c.handler, c.logger, received, func(frame []byte) error {
+			return writeFrame(c.conn, &c.writeLock, c.framer, c.timeouts.Write, frame)
+		}, &c.outgoing)
+		defer demux.close()
+	}
+
+	for !c.interrupted.Load() {
+		if c.timeouts.Read > 0 {
+			_ = c.conn.SetReadDeadline(time.Now().Add(c.timeouts.Read))
+		}
+		msg, err := c.framer.ReadFrame(bufReader)
+
+		if errors.Is(err, ErrFrameSize) {
+			c.oversized.Add(1)
+			_ = c.logger.Warn("socket", "client frame: %v", err)
+			notifyError(c.handler, 1, connection.FramingError, err)
+			if errors.Is(err, ErrFrameDiscarded) {
+				continue
+			}
+			break
+		}
 		if err != nil {
-			_ = log.Warn("socket", "client read: %v", err)
+			_ = c.logger.Warn("socket", "client read: %v", err)
+			if !c.interrupted.Load() && !isClosed(err) {
+				notifyError(c.handler, 1, connection.ReadError, err)
+			}
 			break
 		}
-		msg = connection.TruncateDelimeter(msg)
-		_ = log.Fine("socket", "client rx: %v", string(msg[:len(msg)-1]))
-		c.handler.Received(1, msg)
+		_ = c.logger.Fine("socket", "client rx: %v", string(msg))
+		if files := fds.take(bufReader.Buffered()); len(files) > 0 {
+			if demux != nil && len(msg) > 0 {
+				msg = msg[1:]
+			}
+			c.record(capture.Rx, msg)
+			deliverFiles(c.handler, c.logger, 1, msg, files)
+		} else if demux != nil {
+			demux.input(msg)
+		} else {
+			received(msg)
+		}
 	}
+}
 
-	_ = log.Debug("socket", "client: disconnected")
+func (c *Client) record(direction capture.Direction, msg []byte) {
+	if c.recorder == nil {
+		return
+	}
 
-	c.connected = false
+	err := c.recorder.Record(capture.Record{
+		Time:      time.Now(),
+		Direction: direction,
+		Id:        1,
+		Protocol:  c.proto,
+		Local:     addrString(c.conn.LocalAddr()),
+		Remote:    addrString(c.conn.RemoteAddr()),
+		Payload:   msg,
+	})
+	if err != nil {
+		_ = c.logger.Warn("socket", "client record: %v", err)
+	}
 }
 
 func (c *Client) dailTcp() (conn net.Conn, err error) {
+	if proxyURL := c.proxyFor(false); proxyURL != nil {
+		return c.wrap(c.dialProxy(proxyURL))
+	}
+
 	remoteAddr, err := connection.GetTcpAddress(c.host, c.port)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err = net.DialTCP(string(c.proto), nil, remoteAddr)
+	conn, err = c.dial(string(c.proto), remoteAddr.String())
 
-	return
+	return c.wrap(conn, err)
 }
 
 func (c *Client) dailTls() (conn net.Conn, err error) {
-	remoteAddr, err := connection.GetTcpAddress(c.host, c.port)
+	var serverName string
+
+	if proxyURL := c.proxyFor(true); proxyURL != nil {
+		conn, err = c.wrap(c.dialProxy(proxyURL))
+		serverName = strings.Trim(c.host, "[]")
+	} else {
+		var remoteAddr *net.TCPAddr
+
+		remoteAddr, err = connection.GetTcpAddress(c.host, c.port)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = c.wrap(c.dial(string(connection.Tcp), remoteAddr.String()))
+		serverName = remoteAddr.IP.String()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err = tls.Dial(string(connection.Tcp), remoteAddr.String(), c.tlsConfig)
+	config := c.tlsConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
 
-	return
+	tlsConn := tls.Client(conn, config)
+	if c.timeouts.Handshake > 0 {
+		_ = conn.SetDeadline(time.Now().Add(c.timeouts.Handshake))
+	}
+	start := time.Now()
+	if err = tlsConn.Handshake(); err != nil {
+		c.tracing.lifecycle(trace.Handshake, 1, start, err, c.span)
+		conn.Close()
+		notifyError(c.handler, 0, connection.HandshakeError, err)
+		return nil, err
+	}
+	c.handshake = time.Since(start)
+	c.tracing.lifecycle(trace.Handshake, 1, start, nil, c.span,
+		trace.AttrResumed, strconv.FormatBool(tlsConn.ConnectionState().DidResume))
+	_ = conn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
 }
 
 func (c *Client) dailUnix() (conn net.Conn, err error) {
@@ -199,9 +496,9 @@ func (c *Client) dailUnix() (conn net.Conn, err error) {
 		return nil, err
 	}
 
-	conn, err = net.DialUnix(string(connection.Unix), nil, remoteAddr)
+	conn, err = c.dial(string(connection.Unix), remoteAddr.String())
 
-	return
+	return c.wrap(conn, err)
 }
 
 func (c *Client) dailUdp() (conn net.Conn, err error) {
@@ -210,6 +507,45 @@ func (c *Client) dailUdp() (conn net.Conn, err error) {
 		return nil, err
 	}
 
-	conn, err = net.DialUDP(string(c.proto), nil, remoteAddr)
-	return
+	conn, err = c.dial(string(c.proto), remoteAddr.String())
+	return c.wrap(conn, err)
+}
+
+func (c *Client) proxyFor(secure bool) *url.URL {
+	if c.proxy == nil {
+		return nil
+	}
+	return c.proxy(connection.Address(c.host, c.port), secure)
+}
+
+// dialProxy connects through the proxy, which resolves the host name.
+func (c *Client) dialProxy(proxyURL *url.URL) (net.Conn, error) {
+	ctx := context.Background()
+	if c.timeouts.Dial > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeouts.Dial)
+		defer cancel()
+	}
+
+	conn, err := proxy.Dial(ctx, c.dialer(), proxyURL, string(connection.Tcp),
+		connection.Address(c.host, c.port))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applySocketOptions(conn, c.options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *Client) wrap(conn net.Conn, err error) (net.Conn, error) {
+	if err != nil {
+		return nil, err
+	}
+	if c.wrapper != nil {
+		conn = c.wrapper.WrapConn(conn)
+	}
+	return conn, nil
 }
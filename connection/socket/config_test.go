@@ -0,0 +1,236 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/reliable"
+)
+
+type recordingLogger struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) log(level, logText string, args ...interface{}) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lines = append(l.lines, level+": "+fmt.Sprintf(logText, args...))
+	return nil
+}
+
+func (l *recordingLogger) Fine(module, logText string, args ...interface{}) error {
+	return l.log("fine", logText, args...)
+}
+
+func (l *recordingLogger) Debug(module, logText string, args ...interface{}) error {
+	return l.log("debug", logText, args...)
+}
+
+func (l *recordingLogger) Info(module, logText string, args ...interface{}) error {
+	return l.log("info", logText, args...)
+}
+
+func (l *recordingLogger) Warn(module, logText string, args ...interface{}) error {
+	return l.log("warn", logText, args...)
+}
+
+func (l *recordingLogger) Error(module, logText string, args ...interface{}) error {
+	return l.log("error", logText, args...)
+}
+
+func (l *recordingLogger) count() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return len(l.lines)
+}
+
+func TestOptionsValidation(t *testing.T) {
+	handler := connection.NewEventsToChannel(nil, nil)
+
+	invalid := map[string]func() error{
+		"tls server without certificate": func() error {
+			_, err := NewServerWithOptions("localhost", 0, handler, connection.Tls)
+			return err
+		},
+		"tls on tcp": func() error {
+			_, err := NewClientWithOptions("localhost", 0, handler, connection.Tcp,
+				WithRootCA(nil, true))
+			return err
+		},
+		"max connections on client": func() error {
+			_, err := NewClientWithOptions("localhost", 0, handler, connection.Tcp,
+				WithMaxConns(3))
+			return err
+		},
+		"framer on udp": func() error {
+			_, err := NewServerWithOptions("localhost", 0, handler, connection.Udp,
+				WithFramer(LengthFramer{}))
+			return err
+		},
+		"streams on udp": func() error {
+			_, err := NewServerWithOptions("localhost", 0, handler, connection.Udp,
+				WithStreams())
+			return err
+		},
+		"reliable on tcp": func() error {
+			_, err := NewClientWithOptions("localhost", 0, handler, connection.Tcp,
+				WithReliable(reliable.Config{}))
+			return err
+		},
+		"negative timeout": func() error {
+			_, err := NewClientWithOptions("localhost", 0, handler, connection.Tcp,
+				WithTimeouts(Timeouts{Read: -1}))
+			return err
+		},
+		"unknown protocol": func() error {
+			_, err := NewServerWithOptions("localhost", 0, handler, "sctp")
+			return err
+		},
+		"nil handler": func() error {
+			_, err := NewServerWithOptions("localhost", 0, nil, connection.Tcp)
+			return err
+		},
+	}
+
+	for name, create := range invalid {
+		if err := create(); err == nil {
+			t.Error("accepted: ", name)
+		}
+	}
+
+	_, err := NewServerWithOptions("localhost", 0, handler, connection.Udp,
+		WithMaxConns(0), WithStreams())
+	if !errors.Is(err, ErrStreamsUdp) {
+		t.Error("not all errors reported: ", err)
+	}
+
+	cert, privKey := createTestCertificate(t, 3456)
+	s, err := NewServerWithOptions("localhost", 0, handler, connection.Tls,
+		WithCertificate(cert, privKey), WithMaxConns(10),
+		WithTimeouts(Timeouts{Handshake: time.Second}))
+	if err != nil || s == nil {
+		t.Error("valid options rejected: ", err)
+	}
+
+	// the legacy constructor gets its certificate with TlsConfig later
+	if _, err = newServer("localhost", 0, handler, connection.Tls, certificateLater()); err != nil {
+		t.Error("legacy tls server rejected: ", err)
+	}
+}
+
+func TestOptionsClientServer(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 4)
+	logger := &recordingLogger{}
+
+	s, err := NewServerWithOptions("localhost", 0,
+		connection.NewEventsToChannel(sMsgCh, sEvtCh), connection.Tcp,
+		WithFramer(LengthFramer{}),
+		WithMaxConns(1),
+		WithTimeouts(Timeouts{Read: 300 * time.Millisecond}),
+		WithLogger(logger))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c, err := NewClientWithOptions("localhost", boundPort(t, s),
+		connection.NewEventsToChannel(make(chan connection.Message, 1),
+			make(chan connection.Event, 2)), connection.Tcp,
+		WithFramer(LengthFramer{}),
+		WithTimeouts(Timeouts{Dial: time.Second, Write: time.Second}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	if sEvt := <-sEvtCh; sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+		t.FailNow()
+	}
+
+	// the delimiter of the default framer within a message
+	binary := []byte{1, 0, 2, 0}
+	if err = c.Send(binary); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case msg := <-sMsgCh:
+		if !bytes.Equal(msg.Content, binary) {
+			t.Error("unexpected rx: ", msg.Content)
+		}
+	case <-time.After(time.Second):
+		t.Error("server no rx")
+	}
+
+	// a second client exceeds the limit
+	other := NewTcpClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err = other.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer other.Disconnect()
+	expectError(t, sEvtCh, connection.AcceptError)
+
+	// the idle client runs into the read timeout
+	expectError(t, sEvtCh, connection.TimeoutError)
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.DISCONNECTED {
+			t.Error("server event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("server not disconnected")
+	}
+
+	if logger.count() == 0 {
+		t.Error("logger not used")
+	}
+}
@@ -0,0 +1,228 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/crypto"
+)
+
+func createTestCertificate(t *testing.T, serial int64) (cert []byte, privKey []byte) {
+	cert, privKey, err := crypto.CreateSelfsignedX509Certificate(big.NewInt(serial),
+		10, crypto.KeyLength2048Bit, crypto.CertificateSubject{
+			Organisation: "myOrg",
+			Country:      "CH",
+			Province:     "Zurich",
+			Locality:     "Nirgendswo",
+			CommonName:   "localhost",
+		})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return
+}
+
+func expectError(t *testing.T, evtCh chan connection.Event,
+	category connection.ErrorCategory) (evt connection.Event) {
+
+	select {
+	case evt = <-evtCh:
+		if evt.EventType != connection.ERROR {
+			t.Error("event is not an error: ", evt.EventType)
+			return
+		}
+		if evt.Category != category {
+			t.Error("unexpected error category: ", evt.Category)
+		}
+		if evt.Err == nil {
+			t.Error("error event without error")
+		}
+	case <-time.After(time.Second):
+		t.Error("no error event")
+	}
+	return
+}
+
+func TestTlsHandshakeError(t *testing.T) {
+	cMsgCh := make(chan connection.Message, 1)
+	cEvtCh := make(chan connection.Event, 1)
+
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	cert, privKey := createTestCertificate(t, 3453)
+	otherCert, _ := createTestCertificate(t, 3454)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTlsServer("localhost", 0, sCh, cert, privKey)
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTlsClient("localhost", boundPort(t, s), cCh, otherCert, true)
+
+	if err = c.Connect(); err == nil {
+		t.Error("expected handshake failure")
+		t.FailNow()
+	}
+
+	// neither side ever got connected
+	if evt := expectError(t, cEvtCh, connection.HandshakeError); evt.Id != 0 {
+		t.Error("client handshake error with id ", evt.Id)
+	}
+	if evt := expectError(t, sEvtCh, connection.HandshakeError); evt.Id != 0 {
+		t.Error("server handshake error with id ", evt.Id)
+	}
+
+	// plain tcp against tls
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	_, _ = conn.Write(connection.AppendDelimeter([]byte("hello there, this is not tls")))
+
+	expectError(t, sEvtCh, connection.HandshakeError)
+	conn.Close()
+
+	select {
+	case evt := <-sEvtCh:
+		t.Error("unexpected server event: ", evt.EventType)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestFramingError(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTcpServer("localhost", 0, sCh)
+	if err := s.EnableStreams(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	// a client without streams sends frames without kind
+	c := NewTcpClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	if sEvt := <-sEvtCh; sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+		t.FailNow()
+	}
+
+	if err = c.Send([]byte("hi")); err != nil {
+		t.Error(err)
+	}
+
+	expectError(t, sEvtCh, connection.FramingError)
+}
+
+func TestUdpFramingError(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 4)
+
+	s := NewUdpServer("127.0.0.1", 0, connection.NewEventsToChannel(sMsgCh, sEvtCh))
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// datagrams without delimiter, an empty one included
+	for _, datagram := range []string{"", "hi"} {
+		if _, err = conn.Write([]byte(datagram)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// plain udp peers are connected with every datagram
+	for i := 0; i < 2; i++ {
+		if sEvt := <-sEvtCh; sEvt.EventType != connection.CONNECTED {
+			t.Error("server event is not connected")
+			t.FailNow()
+		}
+		expectError(t, sEvtCh, connection.FramingError)
+	}
+
+	if _, err = conn.Write(connection.AppendDelimeter([]byte("hi"))); err != nil {
+		t.Error(err)
+	}
+	select {
+	case msg := <-sMsgCh:
+		if string(msg.Content) != "hi" {
+			t.Error("unexpected message: ", string(msg.Content))
+		}
+	case <-time.After(time.Second):
+		t.Error("message not received")
+	}
+}
+
+func TestCategorizeError(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now())
+	_, err := conn.Read(make([]byte, 1))
+
+	if category := connection.CategorizeError(err, connection.ReadError); category != connection.TimeoutError {
+		t.Error("deadline not categorized as timeout: ", category)
+	}
+	if category := connection.CategorizeError(net.ErrClosed, connection.ReadError); category != connection.ReadError {
+		t.Error("unexpected category: ", category)
+	}
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"net"
+	"os"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/capture"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+var (
+	ErrFilesUnsupported = errors.New("file passing requires an unwrapped unix connection")
+	ErrTooManyFiles     = errors.New("too many files for one message")
+)
+
+// SendFiles sends msg together with the file descriptors of files. The
+// receiving handler gets them in ReceivedFiles. The files stay open on the
+// sending side.
+func (c *Client) SendFiles(msg []byte, files ...*os.File) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	if c.session != nil {
+		return ErrFilesUnsupported
+	}
+
+	frame := msg
+	if c.streams {
+		frame = messageFrame(msg)
+	}
+
+	err := writeFrame(c.conn, &c.writeLock, c.framer, c.timeouts.Write, frame, files...)
+	if err == nil {
+		c.record(capture.Tx, msg)
+	} else if !errors.Is(err, ErrFilesUnsupported) && !errors.Is(err, ErrTooManyFiles) {
+		notifyError(c.handler, 1, connection.WriteError, err)
+	}
+	return err
+}
+
+// SendFiles sends msg together with the file descriptors of files to a unix
+// connection.
+func (s *Server) SendFiles(id int, msg []byte, files ...*os.File) error {
+	conn, err := s.getConnFromId(id)
+	if err != nil {
+		return errors.New("no connection with given id")
+	}
+
+	frame := msg
+	if s.streams {
+		frame = messageFrame(msg)
+	}
+
+	err = writeFrame(conn, s.writeLock(id), s.framer, s.timeouts.Write, frame, files...)
+	if err == nil {
+		s.record(capture.Tx, id, conn.RemoteAddr(), msg)
+	} else if !errors.Is(err, ErrFilesUnsupported) && !errors.Is(err, ErrTooManyFiles) {
+		notifyError(s.handler, id, connection.WriteError, err)
+	}
+	return err
+}
+
+// deliverFiles passes a message with files to the handler, or closes the
+// files, if the handler does not take them.
+func deliverFiles(handler connection.Handler, logger log.LoggingInteface,
+	id int, msg []byte, files []*os.File) {
+
+	if fileHandler, ok := handler.(connection.FileHandler); ok {
+		fileHandler.ReceivedFiles(id, msg, files)
+		return
+	}
+
+	_ = logger.Warn("socket", "handler does not accept files, close %d", len(files))
+	closeFiles(files)
+	handler.Received(id, msg)
+}
+
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// ListenerFile returns a duplicate of the listening socket to hand over to a
+// successor process, e.g. with SendFiles. A unix socket file is no longer
+// removed, when this server stops.
+func (s *Server) ListenerFile() (*os.File, error) {
+	primary := s.primary()
+	if primary == nil {
+		return nil, errors.New("not listening")
+	}
+
+	filer, ok := primary.netListener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errors.New("listener has no file")
+	}
+	if unixListener, ok := primary.netListener.(interface{ SetUnlinkOnClose(bool) }); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+	return filer.File()
+}
+
+// FileListener creates a listener from a file received with ListenerFile and
+// closes the file. Run a server on it with Serve.
+func FileListener(file *os.File) (net.Listener, error) {
+	defer file.Close()
+	return net.FileListener(file)
+}
@@ -0,0 +1,308 @@
+//go:build unix
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+type fileMessage struct {
+	id    int
+	msg   []byte
+	files []*os.File
+}
+
+type filesToChannel struct {
+	*connection.EventsToChannel
+	files chan fileMessage
+}
+
+func (f *filesToChannel) ReceivedFiles(id int, msg []byte, files []*os.File) {
+	f.files <- fileMessage{id: id, msg: msg, files: files}
+}
+
+func TestUnixFilePassing(t *testing.T) {
+	const path = "/tmp/go-utils-files.sock"
+
+	for _, streams := range []bool{false, true} {
+		sMsgCh := make(chan connection.Message, 2)
+		sEvtCh := make(chan connection.Event, 2)
+		sCh := &filesToChannel{
+			EventsToChannel: connection.NewEventsToChannel(sMsgCh, sEvtCh),
+			files:           make(chan fileMessage, 1),
+		}
+
+		s := NewUnixServer(path, 0, sCh)
+		c := NewUnixClient(path, 0, connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)))
+		if streams {
+			_ = s.EnableStreams()
+			_ = c.EnableStreams()
+		}
+
+		if err := s.ListenAndServe(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if err := c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		if err = c.Send([]byte("before")); err != nil {
+			t.Error(err)
+		}
+		if err = c.SendFiles([]byte("pipe"), w); err != nil {
+			t.Error(err)
+		}
+		if err = c.Send([]byte("after")); err != nil {
+			t.Error(err)
+		}
+		w.Close()
+
+		select {
+		case m := <-sCh.files:
+			if string(m.msg) != "pipe" || len(m.files) != 1 {
+				t.Error("unexpected file message: ", string(m.msg), len(m.files))
+				break
+			}
+			if _, err = m.files[0].Write([]byte("through the pipe")); err != nil {
+				t.Error(err)
+			}
+			m.files[0].Close()
+
+			content, err := io.ReadAll(r)
+			if err != nil || string(content) != "through the pipe" {
+				t.Error("unexpected pipe content: ", string(content), err)
+			}
+		case <-time.After(time.Second):
+			t.Error("no files received")
+		}
+		r.Close()
+
+		for _, expected := range []string{"before", "after"} {
+			select {
+			case msg := <-sMsgCh:
+				if string(msg.Content) != expected {
+					t.Error("unexpected rx: ", string(msg.Content))
+				}
+			case <-time.After(time.Second):
+				t.Error("no rx: ", expected)
+			}
+		}
+
+		_ = c.Disconnect()
+		s.Stop()
+	}
+}
+
+func TestListenerHandover(t *testing.T) {
+	const path = "/tmp/go-utils-handover.sock"
+
+	predecessor := NewTcpServer("localhost", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 1)))
+	if err := predecessor.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// the successor receives the listener over a unix socket
+	handover := &filesToChannel{
+		EventsToChannel: connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)),
+		files: make(chan fileMessage, 1),
+	}
+	s := NewUnixServer(path, 0, handover)
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c := NewUnixClient(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	file, err := predecessor.ListenerFile()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = c.SendFiles([]byte("listener"), file); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	file.Close()
+
+	var listener net.Listener
+	select {
+	case m := <-handover.files:
+		if listener, err = FileListener(m.files[0]); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+	case <-time.After(time.Second):
+		t.Error("no listener received")
+		t.FailNow()
+	}
+
+	sEvtCh := make(chan connection.Event, 1)
+	successor := NewTcpServer("localhost", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh))
+	if err = successor.Serve(listener); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer successor.Stop()
+
+	predecessor.Stop()
+
+	client := NewTcpClient("localhost", boundPort(t, successor), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err = client.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer client.Disconnect()
+
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.CONNECTED {
+			t.Error("successor event is not connected")
+		}
+	case <-time.After(time.Second):
+		t.Error("successor not connected")
+	}
+}
+
+func TestUnixFilesConcurrentSend(t *testing.T) {
+	const path = "/tmp/go-utils-files-concurrent.sock"
+
+	sMsgCh := make(chan connection.Message, 1024)
+	sCh := &filesToChannel{
+		EventsToChannel: connection.NewEventsToChannel(sMsgCh, make(chan connection.Event, 2)),
+		files:           make(chan fileMessage, 1),
+	}
+
+	s := NewUnixServer(path, 0, sCh)
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c := NewUnixClient(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// larger than the socket buffer, so the frame takes several writes
+	large := bytes.Repeat([]byte("x"), 4*1024*1024)
+
+	const senders = 8
+	stop := make(chan struct{})
+	sent := make(chan int, senders)
+	for i := 0; i < senders; i++ {
+		go func() {
+			n := 0
+			defer func() { sent <- n }()
+			for n < cap(sMsgCh)/senders {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if c.Send([]byte("small")) != nil {
+					return
+				}
+				n++
+			}
+		}()
+	}
+	if err = c.SendFiles(large, w); err != nil {
+		t.Error(err)
+	}
+	close(stop)
+	small := 0
+	for i := 0; i < senders; i++ {
+		small += <-sent
+	}
+
+	select {
+	case m := <-sCh.files:
+		if !bytes.Equal(m.msg, large) || len(m.files) != 1 {
+			t.Error("file message interleaved, len ", len(m.msg))
+		}
+		for _, file := range m.files {
+			file.Close()
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no files received")
+	}
+
+	for i := 0; i < small; i++ {
+		select {
+		case msg := <-sMsgCh:
+			if string(msg.Content) != "small" {
+				t.Error("unexpected rx, len ", len(msg.Content))
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("no rx ", i)
+			return
+		}
+	}
+}
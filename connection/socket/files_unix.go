@@ -0,0 +1,167 @@
+//go:build unix
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// MaxFiles is the number of file descriptors, which can be sent with one
+// message.
+const MaxFiles = 64
+
+// fdReader reads a unix connection and collects the file descriptors sent
+// along with the data.
+type fdReader struct {
+	conn    *net.UnixConn
+	logger  log.LoggingInteface
+	oob     []byte
+	read    int64
+	pending []pendingFiles
+}
+
+// pendingFiles arrived with the data read up to offset.
+type pendingFiles struct {
+	offset int64
+	files  []*os.File
+}
+
+func newFdReader(conn net.Conn, logger log.LoggingInteface) *fdReader {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+
+	return &fdReader{
+		conn:   unixConn,
+		logger: logger,
+		oob:    make([]byte, syscall.CmsgSpace(MaxFiles*4)),
+	}
+}
+
+func (r *fdReader) Read(p []byte) (int, error) {
+	n, oobn, _, _, err := r.conn.ReadMsgUnix(p, r.oob)
+	if n < 0 {
+		n = 0
+	}
+	r.read += int64(n)
+
+	if oobn > 0 {
+		if files := r.parseRights(r.oob[:oobn]); len(files) > 0 {
+			r.pending = append(r.pending, pendingFiles{offset: r.read, files: files})
+		}
+	}
+
+	return n, err
+}
+
+// take returns the files of the frame just read, with buffered bytes left
+// in the reading buffer. It returns nil without a reader. The kernel attaches
+// the files to the first part of the message written with sendmsg, so they
+// belong to the first frame reaching that part.
+func (r *fdReader) take(buffered int) (files []*os.File) {
+	if r == nil {
+		return nil
+	}
+
+	end := r.read - int64(buffered)
+	for len(r.pending) > 0 && r.pending[0].offset <= end {
+		files = append(files, r.pending[0].files...)
+		r.pending = r.pending[1:]
+	}
+	return
+}
+
+func (r *fdReader) close() {
+	for _, pending := range r.pending {
+		closeFiles(pending.files)
+	}
+	r.pending = nil
+}
+
+func (r *fdReader) parseRights(oob []byte) (files []*os.File) {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		_ = r.logger.Warn("socket", "parse control message: %v", err)
+		return
+	}
+
+	for _, message := range messages {
+		fds, err := syscall.ParseUnixRights(&message)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+			files = append(files, os.NewFile(uintptr(fd), "fd"))
+		}
+	}
+	return
+}
+
+func writeFiles(conn net.Conn, frame []byte, files []*os.File) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ErrFilesUnsupported
+	}
+	if len(files) > MaxFiles {
+		return ErrTooManyFiles
+	}
+
+	// Fd would switch the files to blocking mode, which stalls e.g. a
+	// listener still served by this process
+	fds := make([]int, len(files))
+	for i, file := range files {
+		raw, err := file.SyscallConn()
+		if err != nil {
+			return err
+		}
+		err = raw.Control(func(fd uintptr) {
+			fds[i] = int(fd)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	n, _, err := unixConn.WriteMsgUnix(frame, syscall.UnixRights(fds...), nil)
+	if err != nil {
+		return err
+	}
+
+	// the rights went with the first part, a stream socket may take the
+	// rest of the frame only in further writes
+	if n < len(frame) {
+		_, err = unixConn.Write(frame[n:])
+	}
+	return err
+}
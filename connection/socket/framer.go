@@ -0,0 +1,261 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+var (
+	ErrFrameSize = errors.New("frame exceeds the maximum size")
+	// ErrFrameDiscarded is returned for an oversized frame, which was skipped
+	// up to the next one.
+	ErrFrameDiscarded = fmt.Errorf("%w, discarded", ErrFrameSize)
+
+	errNoDelimiter = errors.New("datagram without delimiter")
+)
+
+const (
+	readBufferSize = 4096
+	// maxPreallocSize limits the buffer allocated for a length prefix
+	maxPreallocSize = 64 * 1024
+)
+
+var readerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewReaderSize(nil, readBufferSize)
+	},
+}
+
+// Framer splits the byte stream of tcp, tls and unix connections into
+// messages.
+type Framer interface {
+	// Frame encodes msg, the result is written with a single write
+	Frame(msg []byte) ([]byte, error)
+	// ReadFrame returns the next message
+	ReadFrame(r *bufio.Reader) ([]byte, error)
+}
+
+// DelimiterFramer ends every message with Delimiter, which must not appear
+// within messages. It is the default with connection.DefaultDelimiter.
+type DelimiterFramer struct {
+	Delimiter byte
+	// MaxSize limits received messages, 0 is unlimited. An oversized message
+	// fails with ErrFrameSize, with Discard it is skipped.
+	MaxSize int
+	Discard bool
+}
+
+func (f DelimiterFramer) Frame(msg []byte) ([]byte, error) {
+	frame := make([]byte, len(msg), len(msg)+1)
+	copy(frame, msg)
+	return append(frame, f.Delimiter), nil
+}
+
+func (f DelimiterFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	if f.MaxSize <= 0 {
+		msg, err := r.ReadBytes(f.Delimiter)
+		if err != nil {
+			return nil, err
+		}
+		return msg[:len(msg)-1], nil
+	}
+
+	var msg []byte
+	for {
+		chunk, err := r.ReadSlice(f.Delimiter)
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+
+		size := len(msg) + len(chunk)
+		if err == nil {
+			size--
+		}
+		if size > f.MaxSize {
+			if !f.Discard {
+				return nil, ErrFrameSize
+			}
+			return nil, f.skip(r, err == nil)
+		}
+
+		msg = append(msg, chunk...)
+		if err == nil {
+			return msg[:len(msg)-1], nil
+		}
+	}
+}
+
+// skip reads up to the next delimiter, unless it was read already.
+func (f DelimiterFramer) skip(r *bufio.Reader, done bool) error {
+	for !done {
+		_, err := r.ReadSlice(f.Delimiter)
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+		done = err == nil
+	}
+	return ErrFrameDiscarded
+}
+
+// LengthFramer prefixes every message with its length as big endian uint32,
+// so messages may contain any byte.
+type LengthFramer struct {
+	// MaxSize limits received messages, see DelimiterFramer.
+	MaxSize int
+	Discard bool
+}
+
+func (f LengthFramer) Frame(msg []byte) ([]byte, error) {
+	if uint64(len(msg)) > uint64(^uint32(0)) {
+		return nil, ErrFrameSize
+	}
+
+	frame := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+	return frame, nil
+}
+
+func (f LengthFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if f.MaxSize > 0 && uint64(size) > uint64(f.MaxSize) {
+		if !f.Discard {
+			return nil, ErrFrameSize
+		}
+		// int(size) may be negative on 32 bit platforms
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, ErrFrameDiscarded
+	}
+
+	// the size is sent by the peer, larger messages grow as their bytes arrive
+	msg := bytes.NewBuffer(make([]byte, 0, min(int64(size), maxPreallocSize)))
+	if _, err := io.CopyN(msg, r, int64(size)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return msg.Bytes(), nil
+}
+
+// RawFramer passes the byte stream through in the chunks it arrives in,
+// without message boundaries, e.g. to relay other protocols.
+type RawFramer struct{}
+
+func (f RawFramer) Frame(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+func (f RawFramer) ReadFrame(r *bufio.Reader) ([]byte, error) {
+	if _, err := r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, r.Buffered())
+	_, err := r.Read(msg)
+	return msg, err
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeFrame frames payload and writes it with the files, if any, within the
+// write timeout. The lock of the connection keeps frames, which take several
+// writes, from interleaving.
+func writeFrame(conn net.Conn, lock sync.Locker, framer Framer,
+	timeout time.Duration, payload []byte, files ...*os.File) error {
+
+	frame, err := framer.Frame(payload)
+	if err != nil {
+		return err
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if timeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+
+	if files != nil {
+		return writeFiles(conn, frame, files)
+	}
+	_, err = conn.Write(frame)
+	return err
+}
+
+// limitFramer sets the maximum message size of the built-in framers.
+func limitFramer(framer Framer, maxSize int, discard bool) (Framer, error) {
+	switch f := framer.(type) {
+	case DelimiterFramer:
+		f.MaxSize, f.Discard = maxSize, discard
+		return f, nil
+	case LengthFramer:
+		f.MaxSize, f.Discard = maxSize, discard
+		return f, nil
+	case RawFramer:
+		// chunks never exceed the read buffer
+		return f, nil
+	}
+	return nil, errors.New("max frame size needs a built-in framer")
+}
+
+// getReader returns a pooled reader, putReader returns it once the
+// connection is done.
+func getReader(r io.Reader) *bufio.Reader {
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(r)
+	return reader
+}
+
+func putReader(reader *bufio.Reader) {
+	reader.Reset(nil)
+	readerPool.Put(reader)
+}
+
+func defaultFramer() Framer {
+	return DelimiterFramer{Delimiter: connection.DefaultDelimiter}
+}
@@ -0,0 +1,223 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestFramers(t *testing.T) {
+	messages := [][]byte{[]byte("hello"), {}, []byte("world")}
+
+	for _, framer := range []Framer{DelimiterFramer{Delimiter: '\n'}, LengthFramer{}} {
+		var stream bytes.Buffer
+		for _, msg := range messages {
+			frame, err := framer.Frame(msg)
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+			stream.Write(frame)
+		}
+
+		r := bufio.NewReader(&stream)
+		for _, expected := range messages {
+			msg, err := framer.ReadFrame(r)
+			if err != nil || !bytes.Equal(msg, expected) {
+				t.Errorf("%T: unexpected frame %q: %v", framer, msg, err)
+			}
+		}
+		if _, err := framer.ReadFrame(r); err != io.EOF {
+			t.Errorf("%T: expected eof: %v", framer, err)
+		}
+	}
+
+	// raw chunks keep the bytes, not the boundaries
+	frame, _ := RawFramer{}.Frame([]byte("raw"))
+	r := bufio.NewReader(io.MultiReader(bytes.NewReader(frame), bytes.NewReader([]byte{0, 1})))
+	var raw []byte
+	for {
+		chunk, err := RawFramer{}.ReadFrame(r)
+		if err != nil {
+			break
+		}
+		raw = append(raw, chunk...)
+	}
+	if !bytes.Equal(raw, []byte{'r', 'a', 'w', 0, 1}) {
+		t.Error("unexpected raw bytes: ", raw)
+	}
+
+	// binary content and a truncated frame
+	frame, _ = LengthFramer{}.Frame([]byte{0, 1, 0})
+	r = bufio.NewReader(bytes.NewReader(frame[:len(frame)-1]))
+	if _, err := (LengthFramer{}).ReadFrame(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("truncated frame: ", err)
+	}
+}
+
+func TestFrameSizeLimit(t *testing.T) {
+	// larger than the read buffer, so the delimiter framer reads in slices
+	long := []byte(strings.Repeat("x", 2*readBufferSize))
+
+	framers := []Framer{
+		DelimiterFramer{Delimiter: '\n', MaxSize: 8},
+		LengthFramer{MaxSize: 8},
+		DelimiterFramer{Delimiter: '\n', MaxSize: 8, Discard: true},
+		LengthFramer{MaxSize: 8, Discard: true},
+	}
+	for i, framer := range framers {
+		var stream bytes.Buffer
+		for _, msg := range [][]byte{[]byte("short"), long, []byte("9 bytes !"), []byte("8 bytes!")} {
+			frame, _ := framer.Frame(msg)
+			stream.Write(frame)
+		}
+
+		r := bufio.NewReaderSize(&stream, readBufferSize)
+		if msg, err := framer.ReadFrame(r); err != nil || string(msg) != "short" {
+			t.Errorf("%T: unexpected frame %q: %v", framer, msg, err)
+		}
+		if _, err := framer.ReadFrame(r); !errors.Is(err, ErrFrameSize) {
+			t.Errorf("%T: expected frame size error: %v", framer, err)
+		}
+		if i < 2 {
+			continue
+		}
+
+		if _, err := framer.ReadFrame(r); !errors.Is(err, ErrFrameDiscarded) {
+			t.Errorf("%T: expected discarded frame: %v", framer, err)
+		}
+		if msg, err := framer.ReadFrame(r); err != nil || string(msg) != "8 bytes!" {
+			t.Errorf("%T: unexpected frame %q: %v", framer, msg, err)
+		}
+	}
+
+	// a length beyond math.MaxInt32 is discarded on 32 bit platforms as well
+	r := bufio.NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xf0, 'x'}))
+	framer := LengthFramer{MaxSize: 8, Discard: true}
+	if _, err := framer.ReadFrame(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expected unexpected eof: ", err)
+	}
+
+	// without limit, a forged length does not allocate the announced size
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	r = bufio.NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xf0, 'x'}))
+	if _, err := (LengthFramer{}).ReadFrame(r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("expected unexpected eof: ", err)
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Error("allocated the announced size: ", allocated)
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	for _, discard := range []bool{true, false} {
+		sMsgCh := make(chan connection.Message, 2)
+		sEvtCh := make(chan connection.Event, 4)
+		s, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(
+			sMsgCh, sEvtCh), connection.Tcp, WithMaxFrameSize(16, discard))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if err = s.ListenAndServe(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if evt := <-sEvtCh; evt.EventType != connection.CONNECTED {
+			t.Error("unexpected event: ", evt)
+		}
+
+		// no delimiter for far longer than allowed, then a valid message
+		_, _ = conn.Write(bytes.Repeat([]byte("x"), 64*1024))
+		_, _ = conn.Write([]byte{0})
+		_, _ = conn.Write(append([]byte("valid"), 0))
+
+		select {
+		case evt := <-sEvtCh:
+			if evt.EventType != connection.ERROR || evt.Category != connection.FramingError ||
+				!errors.Is(evt.Err, ErrFrameSize) {
+
+				t.Error("unexpected event: ", evt)
+			}
+		case <-time.After(time.Second):
+			t.Error("no framing error")
+		}
+
+		if discard {
+			select {
+			case msg := <-sMsgCh:
+				if string(msg.Content) != "valid" {
+					t.Error("unexpected message: ", string(msg.Content))
+				}
+			case <-time.After(time.Second):
+				t.Error("message after discarded frame lost")
+			}
+		} else {
+			select {
+			case evt := <-sEvtCh:
+				if evt.EventType != connection.DISCONNECTED {
+					t.Error("unexpected event: ", evt)
+				}
+			case <-time.After(time.Second):
+				t.Error("connection not dropped")
+			}
+		}
+		if s.OversizedFrames() != 1 {
+			t.Error("unexpected count: ", s.OversizedFrames())
+		}
+
+		conn.Close()
+		s.Stop()
+	}
+
+	if _, err := NewClientWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tcp, WithFramer(customFramer{}), WithMaxFrameSize(16, false)); err == nil {
+
+		t.Error("max frame size accepted on custom framer")
+	}
+}
+
+type customFramer struct {
+	DelimiterFramer
+}
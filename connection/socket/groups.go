@@ -0,0 +1,83 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Join adds the connection to the named group. Connections leave all their
+// groups when they disconnect.
+func (s *Server) Join(id int, group string) error {
+	if !s.clients.Exist(id) {
+		return errors.New("no connection with given id")
+	}
+
+	s.groups.Add(group, id)
+
+	// the connection may have left its groups between both steps
+	if !s.clients.Exist(id) {
+		s.groups.Remove(group, id)
+		return errors.New("no connection with given id")
+	}
+	return nil
+}
+
+// Leave removes the connection from the named group. It returns false, if
+// the connection was not a member.
+func (s *Server) Leave(id int, group string) bool {
+	return s.groups.Remove(group, id)
+}
+
+// SendToGroup sends msg to every member of the group. All members are tried,
+// the failed ones are reported in the joined error.
+func (s *Server) SendToGroup(group string, msg []byte) error {
+	var errs []error
+
+	for _, id := range s.groups.Ids(group) {
+		if err := s.Send(id, msg); err != nil {
+			errs = append(errs, fmt.Errorf("send to %d: %w", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Members returns the ids of the connections in the group.
+func (s *Server) Members(group string) []int {
+	return s.groups.Ids(group)
+}
+
+// Groups returns the groups the connection is member of.
+func (s *Server) Groups(id int) []string {
+	return s.groups.Keys(id)
+}
+
+// GroupNames returns all groups with at least one member.
+func (s *Server) GroupNames() []string {
+	return s.groups.AllKeys()
+}
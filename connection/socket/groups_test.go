@@ -0,0 +1,140 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestServerGroups(t *testing.T) {
+	const count = 3
+
+	sMsgCh := make(chan connection.Message, count)
+	sEvtCh := make(chan connection.Event, count)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTcpServer("localhost", 0, sCh)
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	var clients []*Client
+	var msgChs []chan connection.Message
+	var ids []int
+
+	for i := 0; i < count; i++ {
+		msgCh := make(chan connection.Message, count)
+		c := NewTcpClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+			msgCh, make(chan connection.Event, 2)))
+		if err = c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer c.Disconnect()
+
+		sEvt := <-sEvtCh
+		if sEvt.EventType != connection.CONNECTED {
+			t.Error("server event is not connected")
+			t.FailNow()
+		}
+
+		clients = append(clients, c)
+		msgChs = append(msgChs, msgCh)
+		ids = append(ids, sEvt.Id)
+	}
+
+	if err = s.Join(ids[0], "tenant-a"); err != nil {
+		t.Error(err)
+	}
+	if err = s.Join(ids[1], "tenant-a"); err != nil {
+		t.Error(err)
+	}
+	if err = s.Join(ids[1], "building-3"); err != nil {
+		t.Error(err)
+	}
+	if err = s.Join(4711, "tenant-a"); err == nil {
+		t.Error("unknown connection joined")
+	}
+
+	if groups := s.Groups(ids[1]); !reflect.DeepEqual(groups, []string{"building-3", "tenant-a"}) {
+		t.Error("unexpected groups: ", groups)
+	}
+	if names := s.GroupNames(); !reflect.DeepEqual(names, []string{"building-3", "tenant-a"}) {
+		t.Error("unexpected group names: ", names)
+	}
+
+	if err = s.SendToGroup("tenant-a", []byte("hello tenant")); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for i, msgCh := range msgChs {
+		select {
+		case msg := <-msgCh:
+			if i == 2 {
+				t.Error("message to non member")
+			} else if string(msg.Content) != "hello tenant" {
+				t.Error("unexpected rx: ", string(msg.Content))
+			}
+		default:
+			if i != 2 {
+				t.Error("member no rx: ", i)
+			}
+		}
+	}
+
+	if !s.Leave(ids[1], "building-3") || s.Leave(ids[1], "building-3") {
+		t.Error("unexpected leave result")
+	}
+
+	if err = clients[0].Disconnect(); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.DISCONNECTED || sEvt.Id != ids[0] {
+			t.Error("unexpected server event: ", sEvt)
+		}
+	case <-time.After(time.Second):
+		t.Error("server not disconnected")
+	}
+
+	if members := s.Members("tenant-a"); !reflect.DeepEqual(members, []int{ids[1]}) {
+		t.Error("disconnected client not removed: ", members)
+	}
+	if groups := s.Groups(ids[0]); len(groups) != 0 {
+		t.Error("disconnected client still in groups: ", groups)
+	}
+}
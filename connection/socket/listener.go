@@ -0,0 +1,270 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+// Listener is an additional address a server accepts clients on. All
+// listeners of a server share its handler and connection ids.
+type Listener struct {
+	Protocol connection.Protocol
+	// Host is an IP, a hostname or a unix path. An empty host listens on all
+	// interfaces of both IP versions.
+	Host string
+	Port uint16
+	// TLS replaces the TLS configuration of the server on this listener
+	TLS *tls.Config
+	// UnixOptions replaces the unix options of the server on this listener
+	UnixOptions *UnixOptions
+}
+
+// WithListener binds an additional listener on ListenAndServe.
+func WithListener(listener Listener) Option {
+	return func(c *config) error {
+		if !c.server {
+			return errors.New("listener is a server option")
+		}
+		c.listeners = append(c.listeners, listener)
+		return nil
+	}
+}
+
+// serverListener is a bound listener of a server.
+type serverListener struct {
+	proto connection.Protocol
+	// listener accepts the clients, on TLS it does the handshake
+	listener    net.Listener
+	netListener net.Listener
+	packetConn  net.PacketConn
+	tlsConfig   *tls.Config
+}
+
+func (l *serverListener) addr() net.Addr {
+	if l.packetConn != nil {
+		return l.packetConn.LocalAddr()
+	}
+	return l.netListener.Addr()
+}
+
+func (l *serverListener) close() error {
+	if l.packetConn != nil {
+		return l.packetConn.Close()
+	}
+	return l.listener.Close()
+}
+
+// AddListener binds and serves an additional listener on a running server.
+func (s *Server) AddListener(listener Listener) error {
+	if s.primary() == nil {
+		return errors.New("server not listening")
+	}
+
+	bound, err := s.bind(listener)
+	if err != nil {
+		return err
+	}
+
+	s.serve(bound)
+	return nil
+}
+
+// bind creates the listener, it is not accepting yet.
+func (s *Server) bind(listener Listener) (*serverListener, error) {
+	bound := &serverListener{proto: listener.Protocol}
+
+	switch listener.Protocol {
+	case connection.Tcp, connection.Tls:
+		tcpListener, err := s.listenConfig().Listen(context.Background(),
+			string(connection.Tcp), connection.Address(listener.Host, listener.Port))
+		if err != nil {
+			return nil, err
+		}
+		if err = s.accept(bound, tcpListener, listener.TLS); err != nil {
+			tcpListener.Close()
+			return nil, err
+		}
+		return bound, nil
+
+	case connection.Udp:
+		udpAddr, err := connection.GetUdpAddress(listener.Host, listener.Port)
+		if err != nil {
+			return nil, err
+		}
+		bound.packetConn, err = s.listenConfig().ListenPacket(context.Background(),
+			string(connection.Udp), udpAddr.String())
+		if err != nil {
+			return nil, err
+		}
+		if s.wrapper != nil {
+			bound.packetConn = s.wrapper.WrapPacketConn(bound.packetConn)
+		}
+		return bound, nil
+
+	case connection.Unix:
+		lAddr, err := connection.GetUnixAddress(listener.Host, listener.Port)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.removeStaleSocket(lAddr); err != nil {
+			return nil, err
+		}
+
+		options := s.unixOptions
+		if listener.UnixOptions != nil {
+			options = *listener.UnixOptions
+		}
+
+		listen := func(path string) (net.Listener, error) {
+			return s.listenConfig().Listen(context.Background(),
+				string(connection.Unix), path)
+		}
+
+		var unixListener net.Listener
+		if options.isSet() {
+			if isAbstract(lAddr.Name) {
+				return nil, errors.New("abstract socket has no file to apply options")
+			}
+			unixListener, err = bindPrivate(lAddr, options, listen)
+		} else {
+			unixListener, err = listen(lAddr.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err = s.accept(bound, unixListener, nil); err != nil {
+			unixListener.Close()
+			return nil, err
+		}
+		return bound, nil
+	}
+
+	return nil, fmt.Errorf("unknown protocol: %s", listener.Protocol)
+}
+
+// accept sets up accepting on a stream listener.
+func (s *Server) accept(bound *serverListener, listener net.Listener,
+	tlsConfig *tls.Config) error {
+
+	bound.netListener = listener
+
+	switch bound.proto {
+	case connection.Tcp, connection.Unix:
+		bound.listener = s.wrapListener(listener)
+	case connection.Tls:
+		if tlsConfig != nil {
+			// the ticket keys must not change a config shared with the caller
+			tlsConfig = tlsConfig.Clone()
+		} else if s.tlsConfig != nil {
+			tlsConfig = s.tlsConfig
+		} else {
+			return errors.New("tls listener without tls config")
+		}
+
+		s.ticketLock.Lock()
+		if len(s.ticketKeys) > 0 {
+			tlsConfig.SetSessionTicketKeys(s.ticketKeys)
+		}
+		s.ticketLock.Unlock()
+
+		bound.tlsConfig = tlsConfig
+		bound.listener = tls.NewListener(s.wrapListener(listener), tlsConfig)
+	default:
+		return fmt.Errorf("serve on listener not supported by %s", bound.proto)
+	}
+
+	return nil
+}
+
+// serve starts accepting clients or reading datagrams.
+func (s *Server) serve(bound *serverListener) {
+	s.listenerLock.Lock()
+	s.listeners = append(s.listeners, bound)
+	s.listenerLock.Unlock()
+
+	_ = s.logger.Debug("socket", "server listen on %s %v", bound.proto, bound.addr())
+
+	s.wg.Add(1)
+	if bound.packetConn != nil {
+		go s.listenUdp(&s.wg, bound)
+	} else {
+		go s.listenTcp(&s.wg, bound)
+	}
+}
+
+// Addr returns the address the server is bound to, with the actual port, if
+// it listens on port 0. It is nil, if the server is not listening.
+func (s *Server) Addr() net.Addr {
+	primary := s.primary()
+	if primary == nil {
+		return nil
+	}
+	return primary.addr()
+}
+
+// Addrs returns the addresses of all listeners, the server's own first.
+func (s *Server) Addrs() []net.Addr {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, listener := range s.listeners {
+		addrs = append(addrs, listener.addr())
+	}
+	return addrs
+}
+
+// primary is the listener of the server's own protocol and address.
+func (s *Server) primary() *serverListener {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	return s.listeners[0]
+}
+
+func (s *Server) closeListeners() {
+	s.listenerLock.Lock()
+	listeners := s.listeners
+	s.listeners = nil
+	s.listenerLock.Unlock()
+
+	for _, listener := range listeners {
+		if err := listener.close(); err != nil {
+			_ = s.logger.Warn("socket", "close listener %v: %v", listener.addr(), err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestMultiListenerServer(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 4)
+	sEvtCh := make(chan connection.Event, 8)
+	socketPath := "/tmp/go-utils-multi.sock"
+
+	cert, privKey := createTestCertificate(t, 3457)
+
+	s, err := NewServerWithOptions("localhost", 0,
+		connection.NewEventsToChannel(sMsgCh, sEvtCh), connection.Tcp,
+		WithCertificate(cert, privKey),
+		WithListener(Listener{Protocol: connection.Tls, Host: "localhost"}),
+		WithListener(Listener{Protocol: connection.Udp, Host: "localhost"}),
+		WithListener(Listener{Protocol: connection.Unix, Host: socketPath,
+			UnixOptions: &UnixOptions{Mode: 0600}}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	addrs := s.Addrs()
+	if len(addrs) != 4 {
+		t.Error("unexpected listeners: ", addrs)
+		t.FailNow()
+	}
+
+	if info, err := os.Stat(socketPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("unix options not applied: ", err)
+	}
+
+	newEvents := func() (chan connection.Message, chan connection.Event, connection.Handler) {
+		msgCh := make(chan connection.Message, 1)
+		evtCh := make(chan connection.Event, 2)
+		return msgCh, evtCh, connection.NewEventsToChannel(msgCh, evtCh)
+	}
+
+	tcpMsgCh, tcpEvtCh, tcpHandler := newEvents()
+	tlsMsgCh, tlsEvtCh, tlsHandler := newEvents()
+	udpMsgCh, _, udpHandler := newEvents()
+	unixMsgCh, unixEvtCh, unixHandler := newEvents()
+
+	clients := []*Client{
+		NewTcpClient("localhost", addrPort(t, addrs[0]), tcpHandler),
+		NewTlsClient("localhost", addrPort(t, addrs[1]), tlsHandler, cert, true),
+		NewUdpClient("localhost", addrPort(t, addrs[2]), udpHandler),
+		NewUnixClient(socketPath, 0, unixHandler),
+	}
+	protocols := map[connection.Protocol]int{}
+
+	for _, c := range clients {
+		if err = c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer c.Disconnect()
+
+		// udp peers are known to the server after their first datagram
+		if err = c.Send([]byte("hello")); err != nil {
+			t.Error(err)
+		}
+
+		select {
+		case sEvt := <-sEvtCh:
+			if sEvt.EventType != connection.CONNECTED {
+				t.Error("server event is not connected")
+				t.FailNow()
+			}
+			session, ok := s.Session(sEvt.Id)
+			if !ok {
+				t.Error("no session for ", sEvt.Id)
+				t.FailNow()
+			}
+			if _, exists := protocols[session.Protocol()]; exists {
+				t.Error("protocol connected twice: ", session.Protocol())
+			}
+			protocols[session.Protocol()] = sEvt.Id
+		case <-time.After(time.Second):
+			t.Error("server not connected")
+			t.FailNow()
+		}
+
+		select {
+		case <-sMsgCh:
+		case <-time.After(time.Second):
+			t.Error("server no rx")
+		}
+	}
+
+	if len(protocols) != 4 {
+		t.Error("unexpected protocols: ", protocols)
+	}
+
+	if err = s.Broadcast([]byte("to all")); err != nil {
+		t.Error(err)
+	}
+	for _, msgCh := range []chan connection.Message{tcpMsgCh, tlsMsgCh, udpMsgCh, unixMsgCh} {
+		select {
+		case msg := <-msgCh:
+			if string(msg.Content) != "to all" {
+				t.Error("unexpected rx: ", string(msg.Content))
+			}
+		case <-time.After(time.Second):
+			t.Error("client no rx")
+		}
+	}
+
+	// one stop tears down all listeners and connections
+	s.Stop()
+	for _, evtCh := range []chan connection.Event{tcpEvtCh, tlsEvtCh, unixEvtCh} {
+		<-evtCh
+		select {
+		case evt := <-evtCh:
+			if evt.EventType != connection.DISCONNECTED {
+				t.Error("client event is not disconnected")
+			}
+		case <-time.After(time.Second):
+			t.Error("client not disconnected")
+		}
+	}
+	if _, err = os.Stat(socketPath); err == nil {
+		t.Error("unix socket not removed")
+	}
+}
+
+func TestAddListenerDualStack(t *testing.T) {
+	sEvtCh := make(chan connection.Event, 2)
+
+	s := NewTcpServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh))
+
+	if err := s.AddListener(Listener{Protocol: connection.Tcp, Host: "::1"}); err == nil {
+		t.Error("listener added to stopped server")
+	}
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	if err := s.AddListener(Listener{Protocol: connection.Tls, Host: "127.0.0.1"}); err == nil {
+		t.Error("tls listener added without tls config")
+	}
+
+	// the same port on both ip versions
+	port := boundPort(t, s)
+	if err := s.AddListener(Listener{Protocol: connection.Tcp, Host: "::1", Port: port}); err != nil {
+		t.Skip("no ipv6 loopback: ", err)
+	}
+
+	for _, host := range []string{"127.0.0.1", "::1"} {
+		c := NewTcpClient(host, port, connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)))
+		if err := c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer c.Disconnect()
+
+		select {
+		case sEvt := <-sEvtCh:
+			session, _ := s.Session(sEvt.Id)
+			if sEvt.EventType != connection.CONNECTED || session == nil {
+				t.Error("server event is not connected")
+			} else if ip, _ := s.ClientIp(sEvt.Id); ip != session.RemoteAddr().String() {
+				t.Error("unexpected client ip: ", ip)
+			}
+		case <-time.After(time.Second):
+			t.Error("server not connected on ", host)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ChrIgiSta/go-utils/connection/diskqueue"
+)
+
+// WithOfflineQueue keeps the messages sent while the client is disconnected
+// in queue and sends them in order after the next Connect. A message is
+// removed once written, so it may be sent twice after a crash. The caller
+// opens and closes the queue.
+func WithOfflineQueue(queue *diskqueue.Queue) Option {
+	return func(c *config) error {
+		if c.server {
+			return errors.New("offline queue is a client option")
+		}
+		if queue == nil {
+			return errors.New("offline queue is nil")
+		}
+		c.offline = queue
+		return nil
+	}
+}
+
+// OfflineDepth returns the number of messages waiting for a connection.
+func (c *Client) OfflineDepth() int {
+	if c.offline == nil {
+		return 0
+	}
+	return c.offline.Len()
+}
+
+// sendOffline sends msg directly, if connected and nothing is queued before.
+// Otherwise, or if the write fails, it is queued.
+func (c *Client) sendOffline(msg []byte) error {
+	c.offlineLock.Lock()
+	defer c.offlineLock.Unlock()
+
+	if c.connected.Load() && c.offline.Len() == 0 {
+		if err := c.transmit(msg); err == nil {
+			return nil
+		}
+	}
+
+	if err := c.offline.Append(msg); err != nil {
+		return err
+	}
+
+	// a failed write stops the replay, while the client stays connected
+	if c.connected.Load() && !c.interrupted.Load() {
+		c.startReplay()
+	}
+	return nil
+}
+
+// startReplay sends the queued messages in the background, if it is not
+// running already. The caller holds offlineLock.
+func (c *Client) startReplay() {
+	if c.replaying {
+		return
+	}
+	c.replaying = true
+
+	c.wg.Add(1)
+	go c.replayOffline(&c.wg)
+}
+
+func (c *Client) replayOffline(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for c.replayNext() {
+	}
+}
+
+// replayNext sends the oldest queued message, it returns false once the
+// queue is empty or the connection failed.
+func (c *Client) replayNext() (ok bool) {
+	c.offlineLock.Lock()
+	defer c.offlineLock.Unlock()
+
+	defer func() {
+		c.replaying = ok
+	}()
+
+	if !c.connected.Load() || c.interrupted.Load() {
+		return false
+	}
+
+	msg, err := c.offline.Peek()
+	if errors.Is(err, diskqueue.ErrEmpty) {
+		return false
+	}
+	if err != nil {
+		_ = c.logger.Error("socket", "read offline queue: %v", err)
+		return false
+	}
+
+	// written directly, a priority queue would hold it in memory only
+	if c.conn == nil {
+		return false
+	}
+	if err = c.send(msg); err != nil {
+		return false
+	}
+	if err = c.offline.Ack(); err != nil {
+		_ = c.logger.Error("socket", "ack offline queue: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/diskqueue"
+)
+
+func TestOfflineQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offline")
+
+	sMsgCh := make(chan connection.Message, 8)
+	s := NewTcpServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		sMsgCh, make(chan connection.Event, 8)))
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	queue, err := diskqueue.Open(path, diskqueue.Config{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(nil, make(chan connection.Event, 4)),
+		connection.Tcp, WithOfflineQueue(queue))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = c.Send([]byte(fmt.Sprint("offline", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if c.OfflineDepth() != 3 {
+		t.Error("unexpected depth: ", c.OfflineDepth())
+	}
+
+	// the queue survives a restart of the client
+	_ = queue.Close()
+	if queue, err = diskqueue.Open(path, diskqueue.Config{}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer queue.Close()
+
+	c, _ = NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(nil, make(chan connection.Event, 4)),
+		connection.Tcp, WithOfflineQueue(queue))
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	if err = c.Send([]byte("online")); err != nil {
+		t.Error(err)
+	}
+
+	for _, expected := range []string{"offline0", "offline1", "offline2", "online"} {
+		select {
+		case msg := <-sMsgCh:
+			if string(msg.Content) != expected {
+				t.Error("unexpected message: ", string(msg.Content), ", expected ", expected)
+			}
+		case <-time.After(time.Second):
+			t.Error("message not received: ", expected)
+			t.FailNow()
+		}
+	}
+	if c.OfflineDepth() != 0 {
+		t.Error("queue not replayed: ", c.OfflineDepth())
+	}
+
+	if _, err = NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tcp, WithOfflineQueue(queue)); err == nil {
+
+		t.Error("offline queue accepted on server")
+	}
+}
+
+func TestOfflineQueuePriorities(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 8)
+	s := NewTcpServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		sMsgCh, make(chan connection.Event, 8)))
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	queue, err := diskqueue.Open(filepath.Join(t.TempDir(), "offline"), diskqueue.Config{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer queue.Close()
+
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(nil, make(chan connection.Event, 4)),
+		connection.Tcp, WithOfflineQueue(queue), WithPriorities(PriorityConfig{}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = c.Send([]byte(fmt.Sprint("offline", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	// replayed messages are written before they leave the disk
+	for _, expected := range []string{"offline0", "offline1", "offline2"} {
+		select {
+		case msg := <-sMsgCh:
+			if string(msg.Content) != expected {
+				t.Error("unexpected message: ", string(msg.Content), ", expected ", expected)
+			}
+		case <-time.After(time.Second):
+			t.Error("message not received: ", expected)
+			t.FailNow()
+		}
+	}
+	if stats, _ := c.QueueStats(); stats[PriorityNormal].Sent != 0 {
+		t.Error("replay went through the priority queue")
+	}
+}
+
+// failOnceConn fails its first write without closing the connection.
+type failOnceConn struct {
+	net.Conn
+	failed *atomic.Bool
+}
+
+func (c failOnceConn) Write(b []byte) (int, error) {
+	if c.failed.CompareAndSwap(false, true) {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(b)
+}
+
+type failOnceWrapper struct {
+	failed atomic.Bool
+}
+
+func (w *failOnceWrapper) WrapConn(conn net.Conn) net.Conn {
+	return failOnceConn{Conn: conn, failed: &w.failed}
+}
+
+func (w *failOnceWrapper) WrapPacketConn(conn net.PacketConn) net.PacketConn {
+	return conn
+}
+
+func TestOfflineQueueWriteError(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 8)
+	s := NewTcpServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		sMsgCh, make(chan connection.Event, 8)))
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	queue, err := diskqueue.Open(filepath.Join(t.TempDir(), "offline"), diskqueue.Config{})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer queue.Close()
+
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(nil, make(chan connection.Event, 4)),
+		connection.Tcp, WithOfflineQueue(queue), WithConnWrapper(&failOnceWrapper{}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	// let the replay of the empty queue finish
+	time.Sleep(50 * time.Millisecond)
+
+	// the first message is queued, the replay sends it while connected
+	for _, msg := range []string{"first", "second"} {
+		if err = c.Send([]byte(msg)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case msg := <-sMsgCh:
+			if string(msg.Content) != expected {
+				t.Error("unexpected message: ", string(msg.Content), ", expected ", expected)
+			}
+		case <-time.After(time.Second):
+			t.Error("message not received: ", expected)
+			t.FailNow()
+		}
+	}
+}
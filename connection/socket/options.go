@@ -0,0 +1,234 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+var ErrSocketOptionsUnsupported = errors.New("socket options not supported on this platform")
+
+// Toggle is a socket option, which can be switched on and off or left at the
+// system default.
+type Toggle int8
+
+const (
+	Default Toggle = iota
+	On
+	Off
+)
+
+func toggle(on bool) Toggle {
+	if on {
+		return On
+	}
+	return Off
+}
+
+// SocketOptions are applied when a client dials, a server listens and on
+// every accepted connection. Zero values keep the defaults of the system.
+// Options, which do not apply to the protocol (e.g. NoDelay on udp), are
+// ignored.
+type SocketOptions struct {
+	// TCP_NODELAY, Go enables it by default
+	NoDelay Toggle
+
+	// SO_KEEPALIVE with TCP_KEEPIDLE, TCP_KEEPINTVL and TCP_KEEPCNT
+	KeepAlive         Toggle
+	KeepAliveIdle     time.Duration
+	KeepAliveInterval time.Duration
+	KeepAliveCount    int
+
+	// SO_SNDBUF and SO_RCVBUF in bytes. The kernel may adjust the size.
+	SendBuffer    int
+	ReceiveBuffer int
+
+	// SO_REUSEADDR and SO_REUSEPORT
+	ReuseAddr Toggle
+	ReusePort Toggle
+
+	// IP_TTL or IPV6_UNICAST_HOPS
+	TTL int
+	// IP_TOS or IPV6_TCLASS, the DSCP is TOS >> 2
+	TOS int
+}
+
+func (o *SocketOptions) empty() bool {
+	return *o == SocketOptions{}
+}
+
+// SetSocketOptions sets the options applied on Connect.
+func (c *Client) SetSocketOptions(options SocketOptions) {
+	c.options = options
+}
+
+// SocketOptions reads the effective options of the connection back from the
+// socket.
+func (c *Client) SocketOptions() (SocketOptions, error) {
+	if c.conn == nil {
+		return SocketOptions{}, errors.New("not connected")
+	}
+	return ReadSocketOptions(c.conn)
+}
+
+// SetSocketOptions sets the options applied by ListenAndServe and on accepted
+// connections.
+func (s *Server) SetSocketOptions(options SocketOptions) {
+	s.options = options
+}
+
+// SocketOptions reads the effective options of a connection back from the
+// socket. On udp all peers of a listener share the listening socket, unknown
+// ids read the options of an udp server's own listener.
+func (s *Server) SocketOptions(id int) (SocketOptions, error) {
+	_, item := s.clients.Get(id)
+	if peer, ok := item.(*udpPeer); ok {
+		return ReadSocketOptions(peer.conn)
+	}
+	if primary := s.primary(); item == nil && primary != nil &&
+		primary.packetConn != nil {
+
+		return ReadSocketOptions(primary.packetConn)
+	}
+
+	conn, err := s.getConnFromId(id)
+	if err != nil {
+		return SocketOptions{}, errors.New("no connection with given id")
+	}
+	return ReadSocketOptions(conn)
+}
+
+// ReadSocketOptions reads the effective options of a connection or a packet
+// connection, underneath wrappers and TLS.
+func ReadSocketOptions(conn any) (options SocketOptions, err error) {
+	raw, err := rawConn(conn)
+	if err != nil {
+		return
+	}
+
+	ctrlErr := raw.Control(func(fd uintptr) {
+		options, err = getSocketOptions(fd)
+	})
+	if ctrlErr != nil {
+		err = ctrlErr
+	}
+	return
+}
+
+// applySocketOptions sets the options on an established connection. Go
+// overwrites some of them (e.g. TCP_NODELAY) after the Control hook.
+func applySocketOptions(conn any, options SocketOptions) error {
+	if options.empty() {
+		return nil
+	}
+
+	raw, err := rawConn(conn)
+	if err != nil {
+		return err
+	}
+
+	ctrlErr := raw.Control(func(fd uintptr) {
+		err = setSocketOptions(fd, options)
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+func control(options SocketOptions) func(network, address string,
+	raw syscall.RawConn) error {
+
+	if options.empty() {
+		return nil
+	}
+
+	return func(network, address string, raw syscall.RawConn) (err error) {
+		ctrlErr := raw.Control(func(fd uintptr) {
+			err = setSocketOptions(fd, options)
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}
+}
+
+func keepAlive(options SocketOptions) time.Duration {
+	// a negative value keeps Go from overwriting the keep alive options
+	if options.KeepAlive != Default {
+		return -1
+	}
+	return 0
+}
+
+func (c *Client) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   c.timeouts.Dial,
+		Control:   control(c.options),
+		KeepAlive: keepAlive(c.options),
+	}
+}
+
+func (c *Client) dial(network string, address string) (net.Conn, error) {
+	conn, err := c.dialer().DialContext(context.Background(), network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applySocketOptions(conn, c.options); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (s *Server) listenConfig() *net.ListenConfig {
+	return &net.ListenConfig{
+		Control:   control(s.options),
+		KeepAlive: keepAlive(s.options),
+	}
+}
+
+// rawConn finds the system socket underneath wrappers and TLS.
+func rawConn(conn any) (syscall.RawConn, error) {
+	for {
+		switch c := conn.(type) {
+		case syscall.Conn:
+			return c.SyscallConn()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		case interface{ NetPacketConn() net.PacketConn }:
+			conn = c.NetPacketConn()
+		default:
+			return nil, errors.New("no system socket underneath the connection")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"syscall"
+	"time"
+)
+
+func setSocketOptions(fd uintptr, o SocketOptions) error {
+	s := int(fd)
+
+	domain, err := syscall.GetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+	if err != nil {
+		return err
+	}
+	sockType, err := syscall.GetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return err
+	}
+	ip := domain == syscall.AF_INET || domain == syscall.AF_INET6
+	tcp := ip && sockType == syscall.SOCK_STREAM
+
+	set := func(level, option, value int) {
+		if err == nil {
+			err = syscall.SetsockoptInt(s, level, option, value)
+		}
+	}
+	setToggle := func(level, option int, value Toggle) {
+		if value != Default {
+			set(level, option, boolInt(value == On))
+		}
+	}
+
+	if tcp {
+		setToggle(syscall.IPPROTO_TCP, syscall.TCP_NODELAY, o.NoDelay)
+		setToggle(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE, o.KeepAlive)
+		if o.KeepAliveIdle > 0 {
+			set(syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, seconds(o.KeepAliveIdle))
+		}
+		if o.KeepAliveInterval > 0 {
+			set(syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, seconds(o.KeepAliveInterval))
+		}
+		if o.KeepAliveCount > 0 {
+			set(syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, o.KeepAliveCount)
+		}
+	}
+
+	if o.SendBuffer > 0 {
+		set(syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer)
+	}
+	if o.ReceiveBuffer > 0 {
+		set(syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer)
+	}
+
+	if ip {
+		setToggle(syscall.SOL_SOCKET, syscall.SO_REUSEADDR, o.ReuseAddr)
+		setToggle(syscall.SOL_SOCKET, soReusePort, o.ReusePort)
+	}
+
+	if domain == syscall.AF_INET {
+		if o.TTL > 0 {
+			set(syscall.IPPROTO_IP, syscall.IP_TTL, o.TTL)
+		}
+		if o.TOS > 0 {
+			set(syscall.IPPROTO_IP, syscall.IP_TOS, o.TOS)
+		}
+	} else if domain == syscall.AF_INET6 {
+		if o.TTL > 0 {
+			set(syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, o.TTL)
+		}
+		if o.TOS > 0 {
+			set(syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, o.TOS)
+		}
+	}
+
+	return err
+}
+
+func getSocketOptions(fd uintptr) (o SocketOptions, err error) {
+	s := int(fd)
+
+	get := func(level, option int) (value int) {
+		if err == nil {
+			value, err = syscall.GetsockoptInt(s, level, option)
+		}
+		return
+	}
+
+	domain := get(syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+	sockType := get(syscall.SOL_SOCKET, syscall.SO_TYPE)
+	ip := domain == syscall.AF_INET || domain == syscall.AF_INET6
+
+	if ip && sockType == syscall.SOCK_STREAM {
+		o.NoDelay = toggle(get(syscall.IPPROTO_TCP, syscall.TCP_NODELAY) != 0)
+		o.KeepAlive = toggle(get(syscall.SOL_SOCKET, syscall.SO_KEEPALIVE) != 0)
+		o.KeepAliveIdle = time.Duration(get(syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)) * time.Second
+		o.KeepAliveInterval = time.Duration(get(syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL)) * time.Second
+		o.KeepAliveCount = get(syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT)
+	}
+
+	o.SendBuffer = get(syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	o.ReceiveBuffer = get(syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+
+	if ip {
+		o.ReuseAddr = toggle(get(syscall.SOL_SOCKET, syscall.SO_REUSEADDR) != 0)
+		o.ReusePort = toggle(get(syscall.SOL_SOCKET, soReusePort) != 0)
+	}
+
+	if domain == syscall.AF_INET {
+		o.TTL = get(syscall.IPPROTO_IP, syscall.IP_TTL)
+		o.TOS = get(syscall.IPPROTO_IP, syscall.IP_TOS)
+	} else if domain == syscall.AF_INET6 {
+		o.TTL = get(syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS)
+		o.TOS = get(syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS)
+	}
+
+	return
+}
+
+func boolInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func seconds(d time.Duration) int {
+	if d < time.Second {
+		return 1
+	}
+	return int(d / time.Second)
+}
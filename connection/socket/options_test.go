@@ -0,0 +1,156 @@
+//go:build linux
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestTcpSocketOptions(t *testing.T) {
+	sEvtCh := make(chan connection.Event, 1)
+	s := NewTcpServer("localhost", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh))
+	s.SetSocketOptions(SocketOptions{
+		ReuseAddr:     On,
+		ReceiveBuffer: 64 * 1024,
+		TTL:           32,
+		TOS:           0x20,
+	})
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c := NewTcpClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	c.SetSocketOptions(SocketOptions{
+		NoDelay:           Off,
+		KeepAlive:         On,
+		KeepAliveIdle:     30 * time.Second,
+		KeepAliveInterval: 5 * time.Second,
+		KeepAliveCount:    3,
+		SendBuffer:        32 * 1024,
+		TTL:               17,
+		TOS:               46 << 2,
+	})
+
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	sEvt := <-sEvtCh
+	if sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+		t.FailNow()
+	}
+
+	cOpts, err := c.SocketOptions()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if cOpts.NoDelay != Off || cOpts.KeepAlive != On {
+		t.Error("unexpected toggles: ", cOpts.NoDelay, cOpts.KeepAlive)
+	}
+	if cOpts.KeepAliveIdle != 30*time.Second || cOpts.KeepAliveInterval != 5*time.Second ||
+		cOpts.KeepAliveCount != 3 {
+
+		t.Error("unexpected keep alive: ", cOpts.KeepAliveIdle, cOpts.KeepAliveInterval,
+			cOpts.KeepAliveCount)
+	}
+	// linux doubles the buffer size for its bookkeeping
+	if cOpts.SendBuffer < 32*1024 {
+		t.Error("unexpected send buffer: ", cOpts.SendBuffer)
+	}
+	if cOpts.TTL != 17 || cOpts.TOS != 46<<2 {
+		t.Error("unexpected ip options: ", cOpts.TTL, cOpts.TOS)
+	}
+
+	sOpts, err := s.SocketOptions(sEvt.Id)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if sOpts.NoDelay != On || sOpts.ReuseAddr != On {
+		t.Error("unexpected toggles: ", sOpts.NoDelay, sOpts.ReuseAddr)
+	}
+	if sOpts.ReceiveBuffer < 64*1024 {
+		t.Error("unexpected receive buffer: ", sOpts.ReceiveBuffer)
+	}
+	if sOpts.TTL != 32 || sOpts.TOS != 0x20 {
+		t.Error("unexpected ip options: ", sOpts.TTL, sOpts.TOS)
+	}
+}
+
+func TestUdpSocketOptions(t *testing.T) {
+	options := SocketOptions{
+		ReusePort:  On,
+		SendBuffer: 128 * 1024,
+		TTL:        5,
+	}
+
+	s := NewUdpServer("localhost", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 1)))
+	s.SetSocketOptions(options)
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	// a second listener on the same port is possible with SO_REUSEPORT
+	other := NewUdpServer("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 1)))
+	other.SetSocketOptions(options)
+	if err := other.ListenAndServe(); err != nil {
+		t.Error(err)
+	} else {
+		other.Stop()
+	}
+
+	sOpts, err := s.SocketOptions(0)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if sOpts.ReusePort != On || sOpts.SendBuffer < 128*1024 || sOpts.TTL != 5 {
+		t.Error("unexpected options: ", sOpts)
+	}
+	if sOpts.NoDelay != Default {
+		t.Error("tcp option on udp socket: ", sOpts.NoDelay)
+	}
+}
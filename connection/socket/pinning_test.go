@@ -0,0 +1,206 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestPinnedKeys(t *testing.T) {
+	cert, privKey := createTestCertificate(t, 3459)
+	otherCert, _ := createTestCertificate(t, 3460)
+
+	pin, err := SPKIPinFromPEM(cert)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	otherPin, _ := SPKIPinFromPEM(otherCert)
+
+	s := NewTlsServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 32)), cert, privKey)
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cases := []struct {
+		name    string
+		options []Option
+		valid   bool
+	}{
+		{"pin only", []Option{WithPinnedKeysOnly(otherPin, pin)}, true},
+		{"wrong pin only", []Option{WithPinnedKeysOnly(otherPin)}, false},
+		{"pin on chain", []Option{WithRootCA(cert, true), WithPinnedKeys(pin)}, true},
+		{"wrong pin on chain", []Option{WithRootCA(cert, true), WithPinnedKeys(otherPin)}, false},
+		{"pin on untrusted chain", []Option{WithRootCA(otherCert, true), WithPinnedKeys(pin)}, false},
+	}
+
+	for _, test := range cases {
+		c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+			connection.NewEventsToChannel(make(chan connection.Message, 1),
+				make(chan connection.Event, 2)), connection.Tls, test.options...)
+		if err != nil {
+			t.Error(test.name, ": ", err)
+			continue
+		}
+
+		err = c.Connect()
+		if test.valid && err != nil {
+			t.Error(test.name, ": ", err)
+		} else if !test.valid && err == nil {
+			t.Error(test.name, ": connected")
+		}
+		if err == nil {
+			_ = c.Disconnect()
+		}
+	}
+
+	c, _ := NewClientWithOptions("127.0.0.1", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)), connection.Tls,
+		WithPinnedKeysOnly(otherPin))
+	if err = c.Connect(); !errors.Is(err, ErrPinMismatch) {
+		t.Error("unexpected error: ", err)
+	}
+
+	// the verification of the caller runs before the pins
+	errVerify := errors.New("caller verification")
+	for _, verifyErr := range []error{nil, errVerify} {
+		verified := false
+		c, _ = NewClientWithOptions("127.0.0.1", boundPort(t, s), connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)), connection.Tls,
+			WithTLS(&tls.Config{VerifyConnection: func(tls.ConnectionState) error {
+				verified = true
+				return verifyErr
+			}}),
+			WithPinnedKeysOnly(pin))
+
+		err = c.Connect()
+		if !verified || !errors.Is(err, verifyErr) {
+			t.Error("caller verification skipped: ", verified, err)
+		}
+		if err == nil {
+			_ = c.Disconnect()
+		}
+	}
+}
+
+func TestClientTlsOptions(t *testing.T) {
+	cert, privKey := createTestCertificate(t, 3461)
+	clientCert, clientKey := createTestCertificate(t, 3462)
+	keyPair, _ := tls.X509KeyPair(cert, privKey)
+
+	sEvtCh := make(chan connection.Event, 4)
+	s, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh), connection.Tls,
+		WithTLS(&tls.Config{
+			Certificates: []tls.Certificate{keyPair},
+			ClientAuth:   tls.RequireAnyClientCert,
+		}),
+		WithALPN("device/2", "device/1"))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	pin, _ := SPKIPinFromPEM(cert)
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(make(chan connection.Message, 1),
+			make(chan connection.Event, 2)), connection.Tls,
+		WithRootCA(cert, true),
+		WithServerName("::1"),
+		WithClientCertificate(clientCert, clientKey),
+		WithALPN("device/1"),
+		WithMinTLSVersion(tls.VersionTLS13),
+		WithPinnedKeys(pin))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if c.TLS() != nil {
+		t.Error("tls state before connect")
+	}
+
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	state := c.TLS()
+	if state.NegotiatedProtocol != "device/1" || state.Version != tls.VersionTLS13 {
+		t.Error("unexpected tls state: ", state.NegotiatedProtocol, state.Version)
+	}
+
+	session, ok := s.Session((<-sEvtCh).Id)
+	if !ok || len(session.PeerCertificates()) != 1 {
+		t.Error("no client certificate")
+	} else if clientPin, _ := SPKIPinFromPEM(clientCert); SPKIPin(session.PeerCertificates()[0]) != clientPin {
+		t.Error("unexpected client certificate")
+	}
+
+	// the certificate is issued for the loopback ips only
+	other, _ := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(make(chan connection.Message, 1),
+			make(chan connection.Event, 2)), connection.Tls,
+		WithRootCA(cert, true),
+		WithServerName("localhost"),
+		WithClientCertificate(clientCert, clientKey))
+	if err = other.Connect(); err == nil {
+		t.Error("connected with wrong server name")
+		_ = other.Disconnect()
+	}
+
+	invalid := []Option{
+		WithMinTLSVersion(0x0200),
+		WithCipherSuites(tls.TLS_RSA_WITH_RC4_128_SHA),
+		WithPinnedKeys("not a pin"),
+		WithPinnedKeys(),
+	}
+	for _, option := range invalid {
+		if _, err = NewClientWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+			connection.Tls, option); err == nil {
+
+			t.Error("invalid option accepted")
+		}
+	}
+	if _, err = NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tls, WithTLS(&tls.Config{Certificates: []tls.Certificate{keyPair}}),
+		WithServerName("localhost")); err == nil {
+
+		t.Error("server name accepted on server")
+	}
+}
@@ -0,0 +1,411 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection/trace"
+)
+
+// Priority is the class of an outbound message, see SendPriority.
+type Priority int
+
+const (
+	PriorityCritical Priority = iota
+	PriorityNormal
+	PriorityBulk
+)
+
+// PriorityClasses is the number of priority classes.
+const PriorityClasses = 3
+
+const defaultQueueDepth = 256
+
+// Scheduling selects the class written next.
+type Scheduling int
+
+const (
+	// StrictPriority writes a class only while all higher ones are empty.
+	StrictPriority Scheduling = iota
+	// WeightedPriority writes the classes in proportion to their weights, so
+	// a busy higher class does not starve the lower ones.
+	WeightedPriority
+)
+
+var (
+	ErrPrioritiesDisabled = errors.New("priorities not enabled")
+	ErrInvalidPriority    = errors.New("invalid priority")
+
+	errQueueClosed = errors.New("queue closed")
+)
+
+var defaultWeights = [PriorityClasses]int{8, 4, 1}
+
+// PriorityConfig configures the outbound queues of a connection.
+type PriorityConfig struct {
+	Scheduling Scheduling
+	// Weights of the classes on weighted scheduling, 8:4:1 if not set. A
+	// class with weight 0 is written only while the others are empty.
+	Weights [PriorityClasses]int
+	// Depth limits the queued messages per class, 256 if not set. A full
+	// bulk queue drops its oldest message, the other classes block.
+	Depth [PriorityClasses]int
+}
+
+// QueueStats are the statistics of one priority class. Latency is the mean
+// and MaxLatency the longest time from queueing a message to writing it.
+type QueueStats struct {
+	Depth      int
+	Sent       uint64
+	Dropped    uint64
+	Latency    time.Duration
+	MaxLatency time.Duration
+}
+
+// WithPriorities queues outbound messages per connection and priority class,
+// see SendPriority. Send queues with PriorityNormal.
+func WithPriorities(priorities PriorityConfig) Option {
+	return func(c *config) error {
+		if priorities.Scheduling != StrictPriority &&
+			priorities.Scheduling != WeightedPriority {
+
+			return errors.New("unknown scheduling")
+		}
+		for i := 0; i < PriorityClasses; i++ {
+			if priorities.Weights[i] < 0 || priorities.Depth[i] < 0 {
+				return errors.New("negative priority weight or depth")
+			}
+			if priorities.Depth[i] == 0 {
+				priorities.Depth[i] = defaultQueueDepth
+			}
+		}
+		if priorities.Weights == [PriorityClasses]int{} {
+			priorities.Weights = defaultWeights
+		}
+
+		c.priorities = &priorities
+		return nil
+	}
+}
+
+type queuedMsg struct {
+	msg    []byte
+	queued time.Time
+}
+
+// priorityQueue holds the outbound messages of a connection, run writes them
+// one by one with send.
+type priorityQueue struct {
+	config PriorityConfig
+	send   func(msg []byte) error
+
+	lock    sync.Mutex
+	cond    *sync.Cond
+	items   [PriorityClasses][]queuedMsg
+	credits [PriorityClasses]int
+	stats   [PriorityClasses]QueueStats
+	latency [PriorityClasses]time.Duration
+	closed  bool
+}
+
+func newPriorityQueue(config PriorityConfig, send func(msg []byte) error) *priorityQueue {
+	q := &priorityQueue{
+		config:  config,
+		send:    send,
+		credits: config.Weights,
+	}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+func (q *priorityQueue) push(msg []byte, priority Priority) error {
+	if priority < PriorityCritical || priority > PriorityBulk {
+		return ErrInvalidPriority
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for !q.closed && len(q.items[priority]) >= q.config.Depth[priority] {
+		if priority == PriorityBulk {
+			q.items[priority] = q.items[priority][1:]
+			q.stats[priority].Dropped++
+			break
+		}
+		q.cond.Wait()
+	}
+	if q.closed {
+		return errQueueClosed
+	}
+
+	q.items[priority] = append(q.items[priority], queuedMsg{
+		msg:    append([]byte(nil), msg...),
+		queued: time.Now(),
+	})
+	q.cond.Broadcast()
+	return nil
+}
+
+// next returns the class to write, the queue must not be empty.
+func (q *priorityQueue) next() int {
+	if q.config.Scheduling == WeightedPriority {
+		for round := 0; round < 2; round++ {
+			for class := 0; class < PriorityClasses; class++ {
+				if len(q.items[class]) > 0 && q.credits[class] > 0 {
+					q.credits[class]--
+					return class
+				}
+			}
+			q.credits = q.config.Weights
+		}
+	}
+
+	for class := 0; class < PriorityClasses; class++ {
+		if len(q.items[class]) > 0 {
+			return class
+		}
+	}
+	return PriorityClasses - 1
+}
+
+func (q *priorityQueue) empty() bool {
+	for class := 0; class < PriorityClasses; class++ {
+		if len(q.items[class]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *priorityQueue) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		q.lock.Lock()
+		for !q.closed && q.empty() {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.lock.Unlock()
+			return
+		}
+
+		class := q.next()
+		item := q.items[class][0]
+		q.items[class] = q.items[class][1:]
+		q.cond.Broadcast()
+		q.lock.Unlock()
+
+		if err := q.send(item.msg); err != nil {
+			continue
+		}
+
+		latency := time.Since(item.queued)
+
+		q.lock.Lock()
+		q.stats[class].Sent++
+		q.latency[class] += latency
+		if latency > q.stats[class].MaxLatency {
+			q.stats[class].MaxLatency = latency
+		}
+		q.lock.Unlock()
+	}
+}
+
+// close drops the queued messages and stops run.
+func (q *priorityQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.items = [PriorityClasses][]queuedMsg{}
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) statistics() [PriorityClasses]QueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stats := q.stats
+	for class := 0; class < PriorityClasses; class++ {
+		stats[class].Depth = len(q.items[class])
+		if stats[class].Sent > 0 {
+			stats[class].Latency = q.latency[class] / time.Duration(stats[class].Sent)
+		}
+	}
+	return stats
+}
+
+// SendPriority queues msg in its priority class. It returns once queued,
+// write errors are notified to the handler.
+func (c *Client) SendPriority(msg []byte, priority Priority) error {
+	if c.priorities == nil {
+		return ErrPrioritiesDisabled
+	}
+
+	start := time.Now()
+	msg, span, parent := c.tracing.inject(context.Background(), msg)
+	err := c.enqueue(msg, priority)
+	c.tracing.emit(trace.Send, 1, start, err, span, parent,
+		trace.AttrSize, strconv.Itoa(len(msg)))
+	return err
+}
+
+func (c *Client) enqueue(msg []byte, priority Priority) error {
+	queue := c.currentQueue()
+	if queue == nil {
+		return errors.New("not connected")
+	}
+	return queue.push(msg, priority)
+}
+
+// QueueStats returns the statistics per priority class of the connection.
+func (c *Client) QueueStats() ([PriorityClasses]QueueStats, error) {
+	if c.priorities == nil {
+		return [PriorityClasses]QueueStats{}, ErrPrioritiesDisabled
+	}
+	queue := c.currentQueue()
+	if queue == nil {
+		return [PriorityClasses]QueueStats{}, errors.New("not connected")
+	}
+
+	return queue.statistics(), nil
+}
+
+// startQueue starts writing the queued messages of a new connection.
+func (c *Client) startQueue() {
+	if c.priorities == nil {
+		return
+	}
+
+	queue := newPriorityQueue(*c.priorities, c.send)
+	c.queueLock.Lock()
+	c.queue = queue
+	c.queueLock.Unlock()
+
+	c.wg.Add(1)
+	go queue.run(&c.wg)
+}
+
+// currentQueue returns the queue of the current connection, a new one is set
+// on every Connect.
+func (c *Client) currentQueue() *priorityQueue {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+
+	return c.queue
+}
+
+// SendPriority queues msg for client id, see Client.SendPriority.
+func (s *Server) SendPriority(id int, msg []byte, priority Priority) error {
+	if s.priorities == nil {
+		return ErrPrioritiesDisabled
+	}
+
+	start := time.Now()
+	msg, span, parent := s.tracing.inject(context.Background(), msg)
+	err := s.enqueue(id, msg, priority)
+	s.tracing.emit(trace.Send, id, start, err, span, parent,
+		trace.AttrSize, strconv.Itoa(len(msg)))
+	return err
+}
+
+func (s *Server) enqueue(id int, msg []byte, priority Priority) error {
+	queue, err := s.queue(id)
+	if err != nil {
+		return err
+	}
+	return queue.push(msg, priority)
+}
+
+// QueueStats returns the statistics per priority class of client id.
+func (s *Server) QueueStats(id int) ([PriorityClasses]QueueStats, error) {
+	if s.priorities == nil {
+		return [PriorityClasses]QueueStats{}, ErrPrioritiesDisabled
+	}
+
+	queue, err := s.queue(id)
+	if err != nil {
+		return [PriorityClasses]QueueStats{}, err
+	}
+	return queue.statistics(), nil
+}
+
+// queue returns the queue of client id, it starts with the first message. It
+// checks the connection under the lock, which removeQueue drops the session
+// with, so no queue is created for a connection already gone.
+func (s *Server) queue(id int) (*priorityQueue, error) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	if queue, ok := s.queues[id]; ok {
+		return queue, nil
+	}
+	if _, item := s.clients.Get(id); item == nil {
+		return nil, errors.New("no connection with given id")
+	}
+	if _, ok := s.Session(id); !ok {
+		return nil, errors.New("no connection with given id")
+	}
+
+	queue := newPriorityQueue(*s.priorities, func(msg []byte) error {
+		return s.send(id, msg)
+	})
+	s.queues[id] = queue
+
+	s.wg.Add(1)
+	go queue.run(&s.wg)
+
+	return queue, nil
+}
+
+// removeQueue drops the session and the queue of a disconnected client.
+func (s *Server) removeQueue(id int) {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	s.removeSession(id)
+
+	if queue, ok := s.queues[id]; ok {
+		queue.close()
+		delete(s.queues, id)
+	}
+}
+
+func (s *Server) resetQueues() {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+
+	for _, queue := range s.queues {
+		queue.close()
+	}
+	s.queues = make(map[int]*priorityQueue)
+}
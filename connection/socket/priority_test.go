@@ -0,0 +1,220 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+// drainQueue runs q until count messages are written and returns them.
+func drainQueue(t *testing.T, q *priorityQueue, sent chan string, count int) []string {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go q.run(&wg)
+	defer wg.Wait()
+	defer q.close()
+
+	var order []string
+	for len(order) < count {
+		select {
+		case msg := <-sent:
+			order = append(order, msg)
+		case <-time.After(time.Second):
+			t.Error("missing messages: ", order)
+			t.FailNow()
+		}
+	}
+	return order
+}
+
+func TestPriorityScheduling(t *testing.T) {
+	sent := make(chan string, 16)
+	send := func(msg []byte) error {
+		sent <- string(msg)
+		return nil
+	}
+
+	strict := newPriorityQueue(PriorityConfig{
+		Depth: [PriorityClasses]int{8, 8, 8},
+	}, send)
+	_ = strict.push([]byte("b1"), PriorityBulk)
+	_ = strict.push([]byte("b2"), PriorityBulk)
+	_ = strict.push([]byte("n1"), PriorityNormal)
+	_ = strict.push([]byte("c1"), PriorityCritical)
+
+	order := drainQueue(t, strict, sent, 4)
+	for i, expected := range []string{"c1", "n1", "b1", "b2"} {
+		if order[i] != expected {
+			t.Error("unexpected strict order: ", order)
+			break
+		}
+	}
+
+	weighted := newPriorityQueue(PriorityConfig{
+		Scheduling: WeightedPriority,
+		Weights:    [PriorityClasses]int{2, 1, 1},
+		Depth:      [PriorityClasses]int{8, 8, 8},
+	}, send)
+	for _, msg := range []string{"c1", "c2", "c3", "c4"} {
+		_ = weighted.push([]byte(msg), PriorityCritical)
+	}
+	_ = weighted.push([]byte("b1"), PriorityBulk)
+	_ = weighted.push([]byte("b2"), PriorityBulk)
+
+	order = drainQueue(t, weighted, sent, 6)
+	for i, expected := range []string{"c1", "c2", "b1", "c3", "c4", "b2"} {
+		if order[i] != expected {
+			t.Error("unexpected weighted order: ", order)
+			break
+		}
+	}
+
+	stats := weighted.statistics()
+	if stats[PriorityCritical].Sent != 4 || stats[PriorityBulk].Sent != 2 {
+		t.Error("unexpected stats: ", stats)
+	}
+}
+
+func TestPriorityDropBulk(t *testing.T) {
+	q := newPriorityQueue(PriorityConfig{
+		Depth: [PriorityClasses]int{1, 1, 2},
+	}, func(msg []byte) error { return nil })
+
+	for _, msg := range []string{"b1", "b2", "b3"} {
+		if err := q.push([]byte(msg), PriorityBulk); err != nil {
+			t.Error(err)
+		}
+	}
+
+	stats := q.statistics()
+	if stats[PriorityBulk].Depth != 2 || stats[PriorityBulk].Dropped != 1 {
+		t.Error("unexpected stats: ", stats[PriorityBulk])
+	}
+	if string(q.items[PriorityBulk][0].msg) != "b2" {
+		t.Error("dropped the wrong message")
+	}
+
+	// a full critical queue blocks until there is space
+	_ = q.push([]byte("c1"), PriorityCritical)
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- q.push([]byte("c2"), PriorityCritical)
+	}()
+	select {
+	case <-pushed:
+		t.Error("pushed into a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.close()
+	if err := <-pushed; !errors.Is(err, errQueueClosed) {
+		t.Error("unexpected error: ", err)
+	}
+	if err := q.push([]byte("n"), Priority(7)); !errors.Is(err, ErrInvalidPriority) {
+		t.Error("unexpected error: ", err)
+	}
+}
+
+func TestSendPriority(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 4)
+	sEvtCh := make(chan connection.Event, 4)
+	s, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(
+		sMsgCh, sEvtCh), connection.Tcp,
+		WithPriorities(PriorityConfig{Scheduling: WeightedPriority}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cMsgCh := make(chan connection.Message, 4)
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(cMsgCh, make(chan connection.Event, 2)),
+		connection.Tcp, WithPriorities(PriorityConfig{}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = c.SendPriority([]byte("early"), PriorityCritical); err == nil {
+		t.Error("sent before connect")
+	}
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	id := (<-sEvtCh).Id
+
+	if err = c.SendPriority([]byte("stop motor"), PriorityCritical); err != nil {
+		t.Error(err)
+	}
+	if err = c.Send([]byte("status")); err != nil {
+		t.Error(err)
+	}
+	if err = s.SendPriority(id, []byte("telemetry"), PriorityBulk); err != nil {
+		t.Error(err)
+	}
+
+	for _, ch := range []chan connection.Message{sMsgCh, sMsgCh, cMsgCh} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Error("message not received")
+			t.FailNow()
+		}
+	}
+
+	stats, err := c.QueueStats()
+	if err != nil || stats[PriorityCritical].Sent != 1 || stats[PriorityNormal].Sent != 1 {
+		t.Error("unexpected client stats: ", stats, err)
+	}
+	if stats, err = s.QueueStats(id); err != nil || stats[PriorityBulk].Sent != 1 {
+		t.Error("unexpected server stats: ", stats, err)
+	}
+	if _, err = s.QueueStats(id + 1); err == nil {
+		t.Error("stats of unknown client")
+	}
+
+	plain := NewTcpClient("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil))
+	if err = plain.SendPriority(nil, PriorityBulk); !errors.Is(err, ErrPrioritiesDisabled) {
+		t.Error("unexpected error: ", err)
+	}
+	if _, err = NewClientWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tcp, WithPriorities(PriorityConfig{Depth: [PriorityClasses]int{-1}})); err == nil {
+
+		t.Error("negative depth accepted")
+	}
+}
@@ -0,0 +1,121 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestTlsClientThroughProxy(t *testing.T) {
+	tunnels := make(chan string, 1)
+
+	proxyServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodConnect {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			upstream, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			defer upstream.Close()
+
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			tunnels <- r.Host
+			_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+			go func() { _, _ = io.Copy(upstream, rw) }()
+			_, _ = io.Copy(conn, upstream)
+		}))
+	defer proxyServer.Close()
+
+	sMsgCh := make(chan connection.Message, 1)
+	cert, privKey := createTestCertificate(t, 3458)
+
+	s := NewTlsServer("127.0.0.1", 0, connection.NewEventsToChannel(
+		sMsgCh, make(chan connection.Event, 2)), cert, privKey)
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	t.Setenv("HTTPS_PROXY", proxyURL.Host)
+	t.Setenv("NO_PROXY", "")
+
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(make(chan connection.Message, 1),
+			make(chan connection.Event, 2)), connection.Tls,
+		WithRootCA(cert, true), WithProxyFromEnvironment())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	if tunnel := <-tunnels; tunnel != s.Addr().String() {
+		t.Error("unexpected tunnel: ", tunnel)
+	}
+
+	if err = c.Send([]byte("through the proxy")); err != nil {
+		t.Error(err)
+	}
+	select {
+	case msg := <-sMsgCh:
+		if string(msg.Content) != "through the proxy" {
+			t.Error("unexpected rx: ", string(msg.Content))
+		}
+	case <-time.After(time.Second):
+		t.Error("server no rx")
+	}
+
+	if _, err = NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(nil, nil), connection.Udp,
+		WithProxy("socks5://127.0.0.1:1080")); err == nil {
+
+		t.Error("proxy accepted on udp")
+	}
+}
@@ -0,0 +1,212 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/capture"
+	"github.com/ChrIgiSta/go-utils/connection/reliable"
+)
+
+const maxDatagramSize = 0xFFFF
+
+// udpIdleTimeout is the time an udp peer is kept without datagrams, unless
+// Timeouts.Read is set.
+const udpIdleTimeout = 5 * time.Minute
+
+var errReliableUdpOnly = errors.New("reliable delivery requires udp")
+
+// EnableReliable switches the udp client to acknowledged, ordered delivery.
+// The server has to enable it as well. Messages are sent without delimiter
+// and may contain any byte.
+func (c *Client) EnableReliable(config reliable.Config) error {
+	if c.proto != connection.Udp {
+		return errReliableUdpOnly
+	}
+
+	c.reliableConfig = &config
+	return nil
+}
+
+// EnableReliable switches the udp server to acknowledged, ordered delivery
+// with a session per peer. The clients have to enable it as well.
+func (s *Server) EnableReliable(config reliable.Config) error {
+	if s.proto != connection.Udp {
+		return errReliableUdpOnly
+	}
+
+	s.reliableConfig = &config
+	return nil
+}
+
+func (c *Client) readReliable() {
+	buffer := make([]byte, maxDatagramSize)
+
+	for !c.interrupted.Load() {
+		n, err := c.conn.Read(buffer)
+		if err != nil {
+			_ = c.logger.Warn("socket", "client read: %v", err)
+			if !c.interrupted.Load() && !isClosed(err) {
+				notifyError(c.handler, 1, connection.ReadError, err)
+			}
+			return
+		}
+
+		if err = c.session.Input(buffer[:n]); err != nil {
+			_ = c.logger.Warn("socket", "client reliable input: %v", err)
+			notifyError(c.handler, 1, connection.FramingError, err)
+		}
+	}
+}
+
+func (c *Client) newReliableSession() *reliable.Session {
+	return reliable.NewSession(1, *c.reliableConfig,
+		func(datagram []byte) error {
+			_, err := c.conn.Write(datagram)
+			return err
+		},
+		func(msg []byte) {
+			c.record(capture.Rx, msg)
+			c.tracing.deliver(c.handler, 1, msg)
+		})
+}
+
+// udpPeer is a remote address on one of the udp listeners.
+type udpPeer struct {
+	net.Addr
+	conn     net.PacketConn
+	id       int
+	lastSeen time.Time
+}
+
+func (p *udpPeer) key() string {
+	return p.conn.LocalAddr().String() + "|" + p.String()
+}
+
+// udpPeer maps the address to an id, which is stable until the peer is idle
+// for the idle timeout.
+func (s *Server) udpPeer(conn net.PacketConn, addr net.Addr,
+	received time.Time) (id int, isNew bool) {
+
+	s.udpLock.Lock()
+	defer s.udpLock.Unlock()
+
+	peer := &udpPeer{Addr: addr, conn: conn, lastSeen: received}
+	if known, ok := s.udpPeers[peer.key()]; ok {
+		known.lastSeen = received
+		return known.id, false
+	}
+	if s.maxConns > 0 && len(s.clients.GetIds()) >= s.maxConns {
+		return 0, false
+	}
+
+	id = s.nextId()
+	peer.id = id
+	s.udpPeers[peer.key()] = peer
+	s.clients.AddOrUpdate(id, peer)
+	session := newSession(id, connection.Udp, conn.LocalAddr(), addr)
+	session.connectedAt = received
+	session.span = s.tracing.connection()
+	s.addSession(session)
+
+	if s.reliableConfig != nil {
+		s.sessions[id] = reliable.NewSession(id, *s.reliableConfig,
+			func(datagram []byte) error {
+				_, err := conn.WriteTo(datagram, addr)
+				return err
+			},
+			func(msg []byte) {
+				s.record(capture.Rx, id, addr, msg)
+				s.tracing.deliver(s.handler, id, msg)
+			})
+	}
+
+	return id, true
+}
+
+func (s *Server) removeUdpPeer(id int, peer *udpPeer) {
+	s.udpLock.Lock()
+	session := s.sessions[id]
+	delete(s.sessions, id)
+	delete(s.udpPeers, peer.key())
+	s.udpLock.Unlock()
+
+	if session != nil {
+		session.Close()
+	}
+}
+
+func (s *Server) udpIdle() time.Duration {
+	if s.timeouts.Read > 0 {
+		return s.timeouts.Read
+	}
+	return udpIdleTimeout
+}
+
+// evictUdpPeers disconnects the peers of conn, which sent nothing for the
+// idle timeout.
+func (s *Server) evictUdpPeers(conn net.PacketConn, now time.Time) {
+	var idle []*udpPeer
+
+	s.udpLock.Lock()
+	for _, peer := range s.udpPeers {
+		if peer.conn == conn && now.Sub(peer.lastSeen) >= s.udpIdle() {
+			idle = append(idle, peer)
+		}
+	}
+	s.udpLock.Unlock()
+
+	for _, peer := range idle {
+		_ = s.logger.Debug("socket", "udp peer %v idle", peer.Addr)
+		if s.clients.Delete(peer.id) != nil {
+			s.removeUdpPeer(peer.id, peer)
+			s.disconnected(peer.id)
+		}
+	}
+}
+
+func (s *Server) reliableSession(id int) *reliable.Session {
+	s.udpLock.Lock()
+	defer s.udpLock.Unlock()
+
+	return s.sessions[id]
+}
+
+func (s *Server) resetUdpPeers() {
+	s.udpLock.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[int]*reliable.Session)
+	s.udpPeers = make(map[string]*udpPeer)
+	s.udpLock.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+}
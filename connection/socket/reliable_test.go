@@ -0,0 +1,146 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/chaos"
+	"github.com/ChrIgiSta/go-utils/connection/reliable"
+)
+
+func TestReliableUdpClientServer(t *testing.T) {
+	const count = 20
+
+	cMsgCh := make(chan connection.Message, count)
+	cEvtCh := make(chan connection.Event, 1)
+
+	sMsgCh := make(chan connection.Message, count)
+	sEvtCh := make(chan connection.Event, 1)
+
+	config := reliable.Config{
+		MinRTO:         5 * time.Millisecond,
+		MaxRTO:         100 * time.Millisecond,
+		MaxRetransmits: 50,
+	}
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewUdpServer("localhost", 0, sCh)
+	if err := s.EnableReliable(config); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err := NewTcpClient("localhost", 0, sCh).EnableReliable(config); err == nil {
+		t.Error("reliable mode accepted on tcp")
+	}
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewUdpClient("localhost", boundPort(t, s), cCh)
+	if err := c.EnableReliable(config); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	c.SetConnWrapper(chaos.NewInjector(chaos.Config{
+		Seed:      7,
+		Direction: chaos.Both,
+		DropRate:  0.3,
+	}))
+
+	err = c.Connect()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	<-cEvtCh
+
+	for i := 0; i < count; i++ {
+		// binary safe, no delimiter needed
+		if err = c.Send([]byte{byte(i), 0x00, 0xFF}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	sEvt := <-sEvtCh
+	if sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case sMsg := <-sMsgCh:
+			if len(sMsg.Content) != 3 || sMsg.Content[0] != byte(i) ||
+				sMsg.Content[1] != 0x00 || sMsg.Content[2] != 0xFF {
+
+				t.Error("unexpected rx on server: ", sMsg.Content)
+			}
+			if sMsg.Id != sEvt.Id {
+				t.Error("unstable udp peer id: ", sMsg.Id, sEvt.Id)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("server rx timeout at ", i)
+			t.FailNow()
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if err = s.Send(sEvt.Id, []byte(fmt.Sprintf("reply %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case cMsg := <-cMsgCh:
+			if string(cMsg.Content) != fmt.Sprintf("reply %d", i) {
+				t.Error("unexpected rx on client: ", string(cMsg.Content))
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("client rx timeout at ", i)
+			t.FailNow()
+		}
+	}
+
+	select {
+	case sEvt = <-sEvtCh:
+		t.Error("unexpected server event: ", sEvt)
+	default:
+	}
+
+	if err = c.Disconnect(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,248 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// ticketKeyCount is the number of ticket keys a server accepts, the newest
+// encrypts new tickets.
+const ticketKeyCount = 3
+
+// SessionStore persists the TLS sessions of a client, so they resume after
+// a restart as well. Keys are chosen by crypto/tls, e.g. the server name.
+type SessionStore interface {
+	Load(key string) ([]byte, bool)
+	Store(key string, session []byte)
+	Delete(key string)
+}
+
+// WithSessionCache lets a TLS client resume its sessions on reconnect. The
+// cache holds up to capacity sessions in memory, a store is optional.
+func WithSessionCache(capacity int, store SessionStore) Option {
+	return func(c *config) error {
+		if c.server {
+			return errors.New("session cache is a client option")
+		}
+		if capacity < 0 {
+			return errors.New("negative session cache capacity")
+		}
+		c.sessionCache = &sessionCache{
+			memory: tls.NewLRUClientSessionCache(capacity),
+			store:  store,
+		}
+		return nil
+	}
+}
+
+// WithTicketKeyRotation rotates the session ticket keys of a TLS server. A
+// ticket is accepted for up to three intervals.
+func WithTicketKeyRotation(interval time.Duration) Option {
+	return func(c *config) error {
+		if !c.server {
+			return errors.New("ticket key rotation is a server option")
+		}
+		if interval <= 0 {
+			return errors.New("invalid ticket key rotation interval")
+		}
+		c.ticketRotation = interval
+		return nil
+	}
+}
+
+type sessionCache struct {
+	memory tls.ClientSessionCache
+	store  SessionStore
+	logger log.LoggingInteface
+}
+
+func (c *sessionCache) Get(key string) (*tls.ClientSessionState, bool) {
+	if session, ok := c.memory.Get(key); ok {
+		return session, true
+	}
+	if c.store == nil {
+		return nil, false
+	}
+
+	data, ok := c.store.Load(key)
+	if !ok {
+		return nil, false
+	}
+
+	session, err := decodeSession(data)
+	if err != nil {
+		_ = c.logger.Warn("socket", "drop stored tls session %s: %v", key, err)
+		c.store.Delete(key)
+		return nil, false
+	}
+	c.memory.Put(key, session)
+	return session, true
+}
+
+func (c *sessionCache) Put(key string, session *tls.ClientSessionState) {
+	c.memory.Put(key, session)
+	if c.store == nil {
+		return
+	}
+
+	if session == nil {
+		c.store.Delete(key)
+		return
+	}
+
+	data, err := encodeSession(session)
+	if err != nil {
+		_ = c.logger.Warn("socket", "store tls session %s: %v", key, err)
+		return
+	}
+	c.store.Store(key, data)
+}
+
+// encodeSession serializes the ticket, prefixed by its length, and the state.
+func encodeSession(session *tls.ClientSessionState) ([]byte, error) {
+	ticket, state, err := session.ResumptionState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.New("session not resumable")
+	}
+
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(ticket)))
+	data = append(data, ticket...)
+	return append(data, stateBytes...), nil
+}
+
+func decodeSession(data []byte) (*tls.ClientSessionState, error) {
+	if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+		return nil, errors.New("truncated session")
+	}
+	ticketEnd := 4 + int(binary.BigEndian.Uint32(data))
+
+	state, err := tls.ParseSessionState(data[ticketEnd:])
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewResumptionState(data[4:ticketEnd], state)
+}
+
+// SetTicketKeys sets the session ticket keys of a TLS server, e.g. to share
+// them within a cluster. The first key encrypts new tickets, all decrypt.
+func (s *Server) SetTicketKeys(keys ...[32]byte) error {
+	if len(keys) == 0 {
+		return errors.New("no ticket keys")
+	}
+
+	s.ticketLock.Lock()
+	s.ticketKeys = append([][32]byte{}, keys...)
+	s.ticketLock.Unlock()
+
+	return s.applyTicketKeys()
+}
+
+// RotateTicketKey adds a new random key, which encrypts the tickets from
+// now on. Tickets of the oldest keys are no longer accepted.
+func (s *Server) RotateTicketKey() error {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+
+	s.ticketLock.Lock()
+	keys := append([][32]byte{key}, s.ticketKeys...)
+	if len(keys) > ticketKeyCount {
+		keys = keys[:ticketKeyCount]
+	}
+	s.ticketKeys = keys
+	s.ticketLock.Unlock()
+
+	return s.applyTicketKeys()
+}
+
+func (s *Server) applyTicketKeys() error {
+	configs := s.tlsConfigs()
+	if len(configs) == 0 {
+		return errors.New("no tls configuration")
+	}
+
+	s.ticketLock.Lock()
+	defer s.ticketLock.Unlock()
+
+	for _, config := range configs {
+		config.SetSessionTicketKeys(s.ticketKeys)
+	}
+	return nil
+}
+
+// tlsConfigs returns the configurations of the server and its TLS listeners.
+func (s *Server) tlsConfigs() []*tls.Config {
+	var configs []*tls.Config
+	if s.tlsConfig != nil {
+		configs = append(configs, s.tlsConfig)
+	}
+
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+
+	for _, listener := range s.listeners {
+		if listener.tlsConfig != nil && listener.tlsConfig != s.tlsConfig {
+			configs = append(configs, listener.tlsConfig)
+		}
+	}
+	return configs
+}
+
+func (s *Server) rotateTicketKeys(wg *sync.WaitGroup, stop <-chan struct{}) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(s.ticketRotation)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RotateTicketKey(); err != nil {
+			_ = s.logger.Warn("socket", "rotate ticket key: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
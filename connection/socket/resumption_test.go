@@ -0,0 +1,190 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+type memStore struct {
+	lock     sync.Mutex
+	sessions map[string][]byte
+}
+
+func (m *memStore) Load(key string) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	session, ok := m.sessions[key]
+	return session, ok
+}
+
+func (m *memStore) Store(key string, session []byte) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.sessions[key] = session
+}
+
+func (m *memStore) Delete(key string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.sessions, key)
+}
+
+func (m *memStore) len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.sessions)
+}
+
+func TestSessionResumption(t *testing.T) {
+	cert, privKey := createTestCertificate(t, 3463)
+
+	sEvtCh := make(chan connection.Event, 16)
+	s, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh), connection.Tls,
+		WithCertificate(cert, privKey), WithTicketKeyRotation(time.Hour))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	store := &memStore{sessions: make(map[string][]byte)}
+
+	// connect exchanges a message, so the client received its ticket
+	connect := func(c *Client, msgCh chan connection.Message) *Session {
+		if err := c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		var id int
+		for id == 0 {
+			select {
+			case evt := <-sEvtCh:
+				if evt.EventType == connection.CONNECTED {
+					id = evt.Id
+				}
+			case <-time.After(time.Second):
+				t.Error("not connected")
+				t.FailNow()
+			}
+		}
+		if err := s.Send(id, []byte("hello")); err != nil {
+			t.Error(err)
+		}
+		select {
+		case <-msgCh:
+		case <-time.After(time.Second):
+			t.Error("no message")
+		}
+
+		session, _ := s.Session(id)
+		return session
+	}
+
+	newClient := func() (*Client, chan connection.Message) {
+		msgCh := make(chan connection.Message, 1)
+		c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+			connection.NewEventsToChannel(msgCh, make(chan connection.Event, 16)),
+			connection.Tls, WithRootCA(cert, true), WithSessionCache(0, store))
+		if err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		return c, msgCh
+	}
+
+	c, msgCh := newClient()
+	session := connect(c, msgCh)
+	if c.Resumed() || session.Resumed() {
+		t.Error("first session resumed")
+	}
+	if c.HandshakeDuration() <= 0 || session.HandshakeDuration() <= 0 {
+		t.Error("no handshake duration")
+	}
+	_ = c.Disconnect()
+
+	if store.len() != 1 {
+		t.Error("session not stored")
+	}
+
+	session = connect(c, msgCh)
+	if !c.Resumed() || !session.Resumed() {
+		t.Error("session not resumed on reconnect")
+	}
+	_ = c.Disconnect()
+
+	// a new client resumes from the store only
+	other, otherCh := newClient()
+	session = connect(other, otherCh)
+	if !other.Resumed() || !session.Resumed() {
+		t.Error("stored session not resumed")
+	}
+	_ = other.Disconnect()
+
+	for i := 0; i < ticketKeyCount; i++ {
+		if err = s.RotateTicketKey(); err != nil {
+			t.Error(err)
+		}
+	}
+	session = connect(c, msgCh)
+	if c.Resumed() || session.Resumed() {
+		t.Error("resumed with a retired ticket key")
+	}
+	_ = c.Disconnect()
+}
+
+func TestSessionOptions(t *testing.T) {
+	if _, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tcp, WithTicketKeyRotation(time.Hour)); err == nil {
+
+		t.Error("ticket key rotation accepted without tls")
+	}
+	if _, err := NewClientWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tls, WithTicketKeyRotation(time.Hour)); err == nil {
+
+		t.Error("ticket key rotation accepted on client")
+	}
+	if _, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tls, WithSessionCache(1, nil)); err == nil {
+
+		t.Error("session cache accepted on server")
+	}
+
+	s := NewTcpServer("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil))
+	if err := s.RotateTicketKey(); err == nil {
+		t.Error("ticket key rotated without tls")
+	}
+}
@@ -27,13 +27,21 @@ package socket
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/capture"
+	"github.com/ChrIgiSta/go-utils/connection/reliable"
+	"github.com/ChrIgiSta/go-utils/connection/trace"
 	"github.com/ChrIgiSta/go-utils/containers"
 	log "github.com/ChrIgiSta/go-utils/logger"
 )
@@ -42,28 +50,59 @@ type Server struct {
 	wg          sync.WaitGroup
 	host        string
 	port        uint16
-	interrupted bool
-	listener    net.Listener
-	udpListener net.PacketConn
+	interrupted atomic.Bool
 	handler     connection.Handler
 	clients     *containers.List
+	groups      *containers.Index
+	lastId      atomic.Int64
 	proto       connection.Protocol
 	tlsConfig   *tls.Config
+	framer      Framer
+	timeouts    Timeouts
+	logger      log.LoggingInteface
+	maxConns    int
+	wrapper     connection.ConnWrapper
+	recorder    capture.Recorder
+	unixOptions UnixOptions
+	options     SocketOptions
+
+	ticketLock     sync.Mutex
+	ticketKeys     [][32]byte
+	ticketRotation time.Duration
+	rotationStop   chan struct{}
+
+	maxFrameSize int
+	oversized    atomic.Uint64
+	tracing      tracing
+
+	priorities *PriorityConfig
+	queueLock  sync.Mutex
+	queues     map[int]*priorityQueue
+
+	listenerLock   sync.Mutex
+	listeners      []*serverListener
+	extraListeners []Listener
+
+	sessionLock  sync.RWMutex
+	connSessions map[int]*Session
+
+	udpLock        sync.Mutex
+	udpPeers       map[string]*udpPeer
+	reliableConfig *reliable.Config
+	sessions       map[int]*reliable.Session
+
+	streams   bool
+	streamIds atomic.Uint32
+	outgoing  outgoingStreams
 }
 
 func NewServer(host string, port uint16, handler connection.Handler, protocol connection.Protocol) *Server {
-
-	return &Server{
-		host:        host,
-		port:        port,
-		wg:          sync.WaitGroup{},
-		interrupted: false,
-		listener:    nil,
-		udpListener: nil,
-		handler:     handler,
-		clients:     containers.NewList(),
-		proto:       protocol,
+	server, err := newServer(host, port, handler, protocol, certificateLater())
+	if err != nil {
+		_ = log.Error("socket", "setup server: %v", err)
 	}
+
+	return server
 }
 
 func NewUdpServer(host string, port uint16, handler connection.Handler) *Server {
@@ -80,9 +119,9 @@ func NewUnixServer(host string, port uint16, handler connection.Handler) *Server
 
 func NewTlsServer(host string, port uint16, handle connection.Handler, certificate []byte, privateKey []byte) *Server {
 
-	server := NewServer(host, port, handle, connection.Tls)
-
-	if err := server.TlsConfig(certificate, privateKey); err != nil {
+	server, err := newServer(host, port, handle, connection.Tls,
+		WithCertificate(certificate, privateKey))
+	if err != nil {
 		_ = log.Error("socket", "setup tls listener: %v", err)
 	}
 
@@ -98,78 +137,141 @@ func (s *Server) TlsConfig(certificate []byte, privateKey []byte) (err error) {
 	return
 }
 
-func (s *Server) ListenAndServe() (err error) {
+// SetConnWrapper decorates the accepted connections and the udp listener. On
+// TLS the wrapper sees the raw TCP connection underneath the TLS layer.
+func (s *Server) SetConnWrapper(wrapper connection.ConnWrapper) {
+	s.wrapper = wrapper
+}
 
-	s.interrupted = false
+// SetRecorder records every framed message sent and received.
+func (s *Server) SetRecorder(recorder capture.Recorder) {
+	s.recorder = recorder
+}
 
-	if s.listener != nil {
+// ListenAndServe binds the server's address and all additional listeners.
+func (s *Server) ListenAndServe() error {
+	if s.primary() != nil {
 		return errors.New("listener already up")
 	}
 
-	sAddr := connection.Address(s.host, s.port)
+	primary, err := s.bind(Listener{Protocol: s.proto, Host: s.host, Port: s.port})
+	if err != nil {
+		return err
+	}
 
-	switch s.proto {
-	case connection.Tcp:
-		s.listener, err = net.Listen(string(s.proto),
-			sAddr)
-	case connection.Tls:
-		s.listener, err = tls.Listen(string(connection.Tcp), sAddr, s.tlsConfig)
-	case connection.Udp:
-		var udpAddr *net.UDPAddr
+	return s.start(primary)
+}
 
-		udpAddr, err = connection.GetUdpAddress(s.host, s.port)
-		if err == nil {
-			s.udpListener, err = net.ListenUDP(string(s.proto), udpAddr)
-		}
-	case connection.Unix:
-		var lAddr *net.UnixAddr
+// Serve accepts clients on a listener created elsewhere, e.g. one inherited
+// from a predecessor process with FileListener. On TLS, listener is the plain
+// TCP listener. The additional listeners are bound as on ListenAndServe.
+func (s *Server) Serve(listener net.Listener) error {
+	if s.primary() != nil {
+		return errors.New("listener already up")
+	}
 
-		lAddr, err = connection.GetUnixAddress(s.host, s.port)
+	primary := &serverListener{proto: s.proto}
+	if err := s.accept(primary, listener, nil); err != nil {
+		return err
+	}
+
+	return s.start(primary)
+}
+
+func (s *Server) start(primary *serverListener) error {
+	bound := []*serverListener{primary}
+
+	for _, listener := range s.extraListeners {
+		l, err := s.bind(listener)
 		if err != nil {
-			return err
+			for _, l := range bound {
+				l.close()
+			}
+			return fmt.Errorf("listen on %s %s: %w", listener.Protocol,
+				connection.Address(listener.Host, listener.Port), err)
 		}
-		s.listener, err = net.ListenUnix(string(s.proto), lAddr)
-	default:
-		err = fmt.Errorf("unknown protocol: %s", s.proto)
+		bound = append(bound, l)
 	}
 
-	if err != nil {
-		return err
+	s.interrupted.Store(false)
+	for _, l := range bound {
+		s.serve(l)
 	}
 
-	_ = log.Debug("socket", "server listen on %s:%d", s.host, s.port)
+	if s.ticketRotation > 0 {
+		s.ticketLock.Lock()
+		s.rotationStop = make(chan struct{})
+		stop := s.rotationStop
+		s.ticketLock.Unlock()
 
-	s.wg.Add(1)
-	switch s.proto {
-	case connection.Tcp, connection.Tls, connection.Unix:
-		go s.listenTcp(&s.wg)
-	case connection.Udp:
-		go s.listenUdp(&s.wg)
+		s.wg.Add(1)
+		go s.rotateTicketKeys(&s.wg, stop)
 	}
 
-	return
+	return nil
 }
 
 func (s *Server) Send(id int, msg []byte) (err error) {
+	return s.SendContext(context.Background(), id, msg)
+}
+
+// SendContext sends msg to client id within the trace carried by ctx, see
+// Client.SendContext.
+func (s *Server) SendContext(ctx context.Context, id int, msg []byte) (err error) {
+	start := time.Now()
+	msg, span, parent := s.tracing.inject(ctx, msg)
+
+	if s.priorities != nil {
+		err = s.enqueue(id, msg, PriorityNormal)
+	} else {
+		err = s.send(id, msg)
+	}
 
+	s.tracing.emit(trace.Send, id, start, err, span, parent,
+		trace.AttrSize, strconv.Itoa(len(msg)))
+	return err
+}
+
+func (s *Server) send(id int, msg []byte) (err error) {
 	_, item := s.clients.Get(id)
 	if item == nil {
 		return errors.New("no connection with given id")
 	}
 
-	switch s.proto {
-	case connection.Tcp, connection.Tls, connection.Unix:
-		conn := item.(net.Conn)
+	switch item := item.(type) {
+	case net.Conn:
+		conn := item
+
+		frame := msg
+		if s.streams {
+			frame = messageFrame(msg)
+		}
 
-		_, err = conn.Write(connection.AppendDelimeter(msg))
+		err = writeFrame(conn, s.writeLock(id), s.framer, s.timeouts.Write, frame)
+		if err == nil {
+			s.record(capture.Tx, id, conn.RemoteAddr(), msg)
+		} else {
+			notifyError(s.handler, id, connection.WriteError, err)
+		}
 
-	case connection.Udp:
-		addr := item.(net.Addr)
+	case *udpPeer:
+		peer := item
 
-		_, err = s.udpListener.WriteTo(connection.AppendDelimeter(msg), addr)
+		if session := s.reliableSession(id); session != nil {
+			if err = session.Send(msg); err == nil {
+				s.record(capture.Tx, id, peer.Addr, msg)
+			}
+			return err
+		}
+
+		_, err = peer.conn.WriteTo(connection.AppendDelimeter(msg), peer.Addr)
 		if err != nil {
+			notifyError(s.handler, id, connection.WriteError, err)
 			s.clients.Delete(id)
-			s.handler.Disconnected(id)
+			s.removeUdpPeer(id, peer)
+			s.disconnected(id)
+		} else {
+			s.record(capture.Tx, id, peer.Addr, msg)
 		}
 	}
 
@@ -189,6 +291,25 @@ func (s *Server) Broadcast(msg []byte) (err error) {
 	return
 }
 
+// Disconnect closes the connection to a client. An udp peer is forgotten, it
+// connects again with its next datagram.
+func (s *Server) Disconnect(id int) error {
+	_, item := s.clients.Get(id)
+
+	switch item := item.(type) {
+	case net.Conn:
+		return item.Close()
+	case *udpPeer:
+		if s.clients.Delete(id) != nil {
+			s.removeUdpPeer(id, item)
+			s.disconnected(id)
+		}
+		return nil
+	}
+
+	return errors.New("no connection with given id")
+}
+
 func (s *Server) ClientIp(id int) (ip string, err error) {
 
 	_, item := s.clients.Get(id)
@@ -196,118 +317,367 @@ func (s *Server) ClientIp(id int) (ip string, err error) {
 		return "", errors.New("no connection with given id")
 	}
 
-	switch s.proto {
-	case connection.Tcp, connection.Tls, connection.Unix:
-		conn := item.(net.Conn)
-		ip = conn.RemoteAddr().String()
+	switch item := item.(type) {
+	case net.Conn:
+		ip = item.RemoteAddr().String()
 
-	case connection.Udp:
-		addr := item.(net.Addr)
-		ip = addr.String()
+	case *udpPeer:
+		ip = item.String()
 	}
 	return
 }
 
+// OversizedFrames returns the number of received messages, which exceeded
+// the max frame size.
+func (s *Server) OversizedFrames() uint64 {
+	return s.oversized.Load()
+}
+
 func (s *Server) Stop() {
-	defer s.wg.Wait()
+	s.interrupted.Store(true)
 
-	s.interrupted = true
+	s.ticketLock.Lock()
+	if s.rotationStop != nil {
+		close(s.rotationStop)
+		s.rotationStop = nil
+	}
+	s.ticketLock.Unlock()
 
-	if s.proto == connection.Tcp || s.proto == connection.Tls || s.proto == connection.Unix {
-		s.listener.Close()
+	s.closeListeners()
 
-		cIds := s.clients.GetIds()
-		for _, id := range cIds {
-			conn, err := s.getConnFromId(id)
-			if err != nil {
-				conn.Close()
-			}
+	cIds := s.clients.GetIds()
+	for _, id := range cIds {
+		_, item := s.clients.Get(id)
+		switch item := item.(type) {
+		case net.Conn:
+			item.Close()
+		case *udpPeer:
+			s.clients.Delete(id)
 		}
 	}
+	s.resetUdpPeers()
+	s.resetQueues()
 
-	if s.proto == connection.Udp {
-		s.udpListener.Close()
-	}
+	// the client handlers still need their sessions to disconnect
+	s.wg.Wait()
 
 	s.clients.Reset()
+	s.groups.Reset()
+	s.resetSessions()
 }
 
-func (s *Server) listenTcp(wg *sync.WaitGroup) {
+func (s *Server) listenTcp(wg *sync.WaitGroup, listener *serverListener) {
 
-	// defer s.listener.Close()
 	defer wg.Done()
 
-	for !s.interrupted {
-		conn, err := s.listener.Accept()
+	for !s.interrupted.Load() {
+		conn, err := listener.listener.Accept()
+		accepted := time.Now()
 		if err != nil {
-			_ = log.Warn("socket", "accept client: %v", err)
+			_ = s.logger.Warn("socket", "accept client: %v", err)
+			if !s.interrupted.Load() && !isClosed(err) {
+				notifyError(s.handler, 0, connection.AcceptError, err)
+			}
 			continue
 		}
 
-		_ = log.Debug("socket", "server accept client %v", conn.RemoteAddr())
+		_ = s.logger.Debug("socket", "server accept client %v", conn.RemoteAddr())
 
-		if !s.interrupted {
-			id := connection.GetIdFromConn(&conn)
+		if s.maxConns > 0 && len(s.clients.GetIds()) >= s.maxConns {
+			_ = s.logger.Warn("socket", "reject %v: %v", conn.RemoteAddr(), ErrMaxConns)
+			s.traceAccept(newSession(0, listener.proto, conn.LocalAddr(), conn.RemoteAddr()),
+				accepted, ErrMaxConns)
+			conn.Close()
+			notifyError(s.handler, 0, connection.AcceptError, ErrMaxConns)
+			continue
+		}
+
+		if err = applySocketOptions(conn, s.options); err != nil {
+			_ = s.logger.Warn("socket", "socket options of %v: %v", conn.RemoteAddr(), err)
+		}
+
+		if !s.interrupted.Load() {
+			id := s.nextId()
+			session := newSession(id, listener.proto, conn.LocalAddr(), conn.RemoteAddr())
+			session.connectedAt = accepted
+			session.span = s.tracing.connection()
+
+			s.addSession(session)
 			s.clients.AddOrUpdate(id, conn)
+			s.traceAccept(session, accepted, nil)
 			wg.Add(1)
-			go s.clientHandler(wg, conn, id)
+			go s.clientHandler(wg, conn, session)
 		}
 	}
-	_ = log.Debug("socket", "listener exited")
+	_ = s.logger.Debug("socket", "listener exited")
 }
 
-func (s *Server) listenUdp(wg *sync.WaitGroup) {
+func (s *Server) listenUdp(wg *sync.WaitGroup, listener *serverListener) {
 
 	defer wg.Done()
-	// defer s.udpListener.Close()
 
-	var buffer []byte = make([]byte, 1024)
+	var buffer []byte = make([]byte, maxDatagramSize)
 
-	for !s.interrupted {
-		n, addr, err := s.udpListener.ReadFrom(buffer)
+	// idle peers are looked for in intervals of half the idle timeout
+	swept := time.Now()
+
+	for !s.interrupted.Load() {
+		_ = listener.packetConn.SetReadDeadline(swept.Add(s.udpIdle() / 2))
+		n, addr, err := listener.packetConn.ReadFrom(buffer)
+		received := time.Now()
+		if received.Sub(swept) >= s.udpIdle()/2 {
+			s.evictUdpPeers(listener.packetConn, received)
+			swept = received
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
 		if err != nil {
-			_ = log.Error("socket", "read udp: %v", err)
+			_ = s.logger.Error("socket", "read udp: %v", err)
+			if !s.interrupted.Load() && !isClosed(err) {
+				notifyError(s.handler, 0, connection.ReadError, err)
+			}
 			return
 		}
 
-		id := connection.GetIdFromAddr(&addr)
-		s.clients.AddOrUpdate(id, addr)
-		s.handler.Connected(id)
-		s.handler.Received(id, buffer[:n-1]) // delim ?
-		_ = log.Fine("socket", "udp pck from %v", addr.String())
+		id, isNew := s.udpPeer(listener.packetConn, addr, received)
+		if id == 0 {
+			_ = s.logger.Fine("socket", "drop udp pck from %v: %v", addr, ErrMaxConns)
+			continue
+		}
+		if isNew {
+			if session, ok := s.Session(id); ok {
+				s.traceAccept(session, received, nil)
+			}
+		}
+		// a plain udp peer is connected with every datagram, a reliable one
+		// once per session
+		if isNew || s.reliableConfig == nil {
+			s.handler.Connected(id)
+		}
+
+		if s.maxFrameSize > 0 && n-1 > s.maxFrameSize {
+			s.oversized.Add(1)
+			_ = s.logger.Warn("socket", "drop udp pck from %v: %v", addr, ErrFrameSize)
+			notifyError(s.handler, id, connection.FramingError, ErrFrameSize)
+			continue
+		}
+
+		if session := s.reliableSession(id); session != nil {
+			if err = session.Input(buffer[:n]); err != nil {
+				_ = s.logger.Warn("socket", "reliable input from %v: %v", addr, err)
+				notifyError(s.handler, id, connection.FramingError, err)
+			}
+			continue
+		}
+
+		// each datagram is one message, the sender appends the delimiter
+		if n == 0 || buffer[n-1] != connection.DefaultDelimiter {
+			_ = s.logger.Warn("socket", "drop udp pck from %v: %v", addr, errNoDelimiter)
+			notifyError(s.handler, id, connection.FramingError, errNoDelimiter)
+			continue
+		}
+
+		msg := connection.TruncateDelimeter(buffer[:n])
+		s.record(capture.Rx, id, addr, msg)
+		s.tracing.deliver(s.handler, id, msg)
+		_ = s.logger.Fine("socket", "udp pck from %v", addr.String())
 	}
-	_ = log.Debug("socket", "listener exited")
+	_ = s.logger.Debug("socket", "listener exited")
 }
 
-func (s *Server) clientHandler(wg *sync.WaitGroup,
-	client net.Conn, id int) {
-
+func (s *Server) clientHandler(wg *sync.WaitGroup, client net.Conn, session *Session) {
 	defer wg.Done()
 	defer client.Close()
 
-	bufReader := bufio.NewReader(client)
+	id, proto := session.id, session.proto
 
+	if tlsConn, ok := client.(*tls.Conn); ok {
+		if s.timeouts.Handshake > 0 {
+			_ = client.SetDeadline(time.Now().Add(s.timeouts.Handshake))
+		}
+		start := time.Now()
+		if err := tlsConn.Handshake(); err != nil {
+			_ = s.logger.Warn("socket", "tls handshake with %v: %v", client.RemoteAddr(), err)
+			s.tracing.lifecycle(trace.Handshake, id, start, err, session.span)
+			s.traceClose(session, err)
+			s.clients.Delete(id)
+			s.removeQueue(id)
+			notifyError(s.handler, 0, connection.HandshakeError, err)
+			return
+		}
+		_ = client.SetDeadline(time.Time{})
+		state := tlsConn.ConnectionState()
+		session.setTLS(&state, time.Since(start))
+		s.tracing.lifecycle(trace.Handshake, id, start, nil, session.span,
+			trace.AttrResumed, strconv.FormatBool(state.DidResume))
+	}
+	if proto == connection.Unix {
+		if cred, err := peerCredentials(client); err == nil {
+			session.setCredentials(cred)
+		} else {
+			_ = s.logger.Debug("socket", "peer credentials of %d: %v", id, err)
+		}
+	}
+
+	var bufReader *bufio.Reader
+
+	fds := newFdReader(client, s.logger)
+	if fds != nil {
+		bufReader = getReader(fds)
+		defer fds.close()
+	} else {
+		bufReader = getReader(client)
+	}
+	defer putReader(bufReader)
+
+	if s.streams {
+		s.outgoing.connect(id)
+	}
 	s.handler.Connected(id)
-	defer s.handler.Disconnected(id)
+	defer s.disconnected(id)
+	defer s.clients.Delete(id)
 
-	for !s.interrupted {
-		msg, err := bufReader.ReadBytes(connection.DefaultDelimiter)
+	received := func(msg []byte) {
+		s.record(capture.Rx, id, client.RemoteAddr(), msg)
+		s.tracing.deliver(s.handler, id, msg)
+	}
+
+	var demux *streamDemux
+	if s.streams {
+		demux = newStreamDemux(id, s.handler, s.logger, received, func(frame []byte) error {
+			return writeFrame(client, &session.writeLock, s.framer, s.timeouts.Write, frame)
+		}, &s.outgoing)
+		defer demux.close()
+	}
 
+	for !s.interrupted.Load() {
+		if s.timeouts.Read > 0 {
+			_ = client.SetReadDeadline(time.Now().Add(s.timeouts.Read))
+		}
+		msg, err := s.framer.ReadFrame(bufReader)
+
+		if errors.Is(err, ErrFrameSize) {
+			s.oversized.Add(1)
+			_ = s.logger.Warn("socket", "frame from %v: %v", client.RemoteAddr(), err)
+			notifyError(s.handler, id, connection.FramingError, err)
+			if errors.Is(err, ErrFrameDiscarded) {
+				continue
+			}
+			return
+		}
 		if err != nil {
-			_ = log.Error("socket", "read from client: %v", err)
+			_ = s.logger.Error("socket", "read from client: %v", err)
+			if !s.interrupted.Load() && !isClosed(err) {
+				notifyError(s.handler, id, connection.ReadError, err)
+			}
 			return
 		} else {
-			msg = connection.TruncateDelimeter(msg)
-			_ = log.Fine("socket", "server: rx %v", string(msg[:len(msg)-1]))
-			s.handler.Received(id, msg)
+			_ = s.logger.Fine("socket", "server: rx %v", string(msg))
+			if files := fds.take(bufReader.Buffered()); len(files) > 0 {
+				if demux != nil && len(msg) > 0 {
+					msg = msg[1:]
+				}
+				s.record(capture.Rx, id, client.RemoteAddr(), msg)
+				deliverFiles(s.handler, s.logger, id, msg, files)
+			} else if demux != nil {
+				demux.input(msg)
+			} else {
+				received(msg)
+			}
 		}
 	}
 }
 
+// traceAccept reports the accept of the connection of session, which started
+// at start. A rejected connection has no span and gets a new trace.
+func (s *Server) traceAccept(session *Session, start time.Time, err error) {
+	s.tracing.lifecycle(trace.Accept, session.id, start, err, session.span,
+		trace.AttrProtocol, string(session.proto), trace.AttrLocal, addrString(session.local),
+		trace.AttrPeer, addrString(session.remote))
+}
+
+// traceClose reports the span of the whole connection of session.
+func (s *Server) traceClose(session *Session, err error) {
+	s.tracing.emit(trace.Close, session.id, session.connectedAt, err, session.span,
+		trace.SpanContext{}, trace.AttrPeer, addrString(session.remote))
+}
+
+func (s *Server) record(direction capture.Direction, id int,
+	remote net.Addr, msg []byte) {
+
+	if s.recorder == nil {
+		return
+	}
+
+	proto := s.proto
+	var local net.Addr
+	if session, ok := s.Session(id); ok {
+		proto = session.Protocol()
+		local = session.LocalAddr()
+	}
+
+	err := s.recorder.Record(capture.Record{
+		Time:      time.Now(),
+		Direction: direction,
+		Id:        id,
+		Protocol:  proto,
+		Local:     addrString(local),
+		Remote:    addrString(remote),
+		Payload:   msg,
+	})
+	if err != nil {
+		_ = s.logger.Warn("socket", "server record: %v", err)
+	}
+}
+
+// disconnected notifies the handler and drops the state of the connection.
+func (s *Server) disconnected(id int) {
+	if session, ok := s.Session(id); ok {
+		s.traceClose(session, nil)
+	}
+	s.groups.RemoveId(id)
+	s.handler.Disconnected(id)
+	s.removeQueue(id)
+}
+
+// nextId returns a new connection id. Ids are unique per server and never 0.
+func (s *Server) nextId() int {
+	return int(s.lastId.Add(1))
+}
+
 func (s *Server) getConnFromId(id int) (conn net.Conn, err error) {
 	_, connIf := s.clients.Get(id)
-	if connIf == nil {
+	conn, ok := connIf.(net.Conn)
+	if !ok {
 		return nil, errors.New("not found")
 	}
-	return connIf.(net.Conn), err
+	return conn, err
+}
+
+func (s *Server) wrapListener(listener net.Listener) net.Listener {
+	if s.wrapper == nil {
+		return listener
+	}
+	return &wrappedListener{Listener: listener, wrapper: s.wrapper}
+}
+
+type wrappedListener struct {
+	net.Listener
+	wrapper connection.ConnWrapper
+}
+
+func (l *wrappedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.wrapper.WrapConn(conn), nil
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
 }
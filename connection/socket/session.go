@@ -0,0 +1,237 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/trace"
+)
+
+// Session holds the state of a server connection. It is created when the
+// connection is accepted and destroyed after the handler's Disconnected. The
+// TLS state and peer credentials are filled in before the handler's
+// Connected.
+type Session struct {
+	id          int
+	proto       connection.Protocol
+	local       net.Addr
+	remote      net.Addr
+	connectedAt time.Time
+	// span of the connection, the parent of its lifecycle traces
+	span trace.SpanContext
+
+	lock        sync.RWMutex
+	tlsState    *tls.ConnectionState
+	handshake   time.Duration
+	credentials *PeerCredentials
+	identity    string
+	values      map[any]any
+
+	// writeLock serializes the frames written to the connection
+	writeLock sync.Mutex
+}
+
+func newSession(id int, proto connection.Protocol, local net.Addr,
+	remote net.Addr) *Session {
+
+	return &Session{
+		id:          id,
+		proto:       proto,
+		local:       local,
+		remote:      remote,
+		connectedAt: time.Now(),
+		values:      make(map[any]any),
+	}
+}
+
+func (s *Session) Id() int {
+	return s.id
+}
+
+func (s *Session) Protocol() connection.Protocol {
+	return s.proto
+}
+
+func (s *Session) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+func (s *Session) ConnectedAt() time.Time {
+	return s.connectedAt
+}
+
+// TLS returns the negotiated TLS state or nil on other protocols and before
+// the handshake completed.
+func (s *Session) TLS() *tls.ConnectionState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.tlsState
+}
+
+// HandshakeDuration returns how long the TLS handshake took.
+func (s *Session) HandshakeDuration() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.handshake
+}
+
+// Resumed reports, if the TLS session was resumed without full handshake.
+func (s *Session) Resumed() bool {
+	state := s.TLS()
+	return state != nil && state.DidResume
+}
+
+// PeerCertificates returns the certificates the TLS peer presented.
+func (s *Session) PeerCertificates() []*x509.Certificate {
+	state := s.TLS()
+	if state == nil {
+		return nil
+	}
+	return state.PeerCertificates
+}
+
+// PeerCredentials returns the credentials of the process connected over a
+// unix socket. It is nil on other protocols and unsupported platforms.
+func (s *Session) PeerCredentials() *PeerCredentials {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.credentials
+}
+
+func (s *Session) setTLS(state *tls.ConnectionState, handshake time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tlsState = state
+	s.handshake = handshake
+}
+
+func (s *Session) setCredentials(credentials *PeerCredentials) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.credentials = credentials
+}
+
+// Identity returns the identity set by SetIdentity, e.g. after the
+// application authenticated the peer. It is empty otherwise.
+func (s *Session) Identity() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.identity
+}
+
+func (s *Session) SetIdentity(identity string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.identity = identity
+}
+
+func (s *Session) Get(key any) (value any, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	value, ok = s.values[key]
+	return
+}
+
+func (s *Session) Set(key any, value any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.values[key] = value
+}
+
+func (s *Session) Delete(key any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.values, key)
+}
+
+// SessionValue returns the value of key, if it is set and of type T.
+func SessionValue[T any](session *Session, key any) (value T, ok bool) {
+	raw, found := session.Get(key)
+	if !found {
+		return
+	}
+	value, ok = raw.(T)
+	return
+}
+
+// Session returns the session of a connected client.
+func (s *Server) Session(id int) (*Session, bool) {
+	s.sessionLock.RLock()
+	defer s.sessionLock.RUnlock()
+
+	session, ok := s.connSessions[id]
+	return session, ok
+}
+
+// writeLock returns the lock of connection id, see writeFrame. A connection
+// without session is gone, its write fails anyway.
+func (s *Server) writeLock(id int) sync.Locker {
+	if session, ok := s.Session(id); ok {
+		return &session.writeLock
+	}
+	return &sync.Mutex{}
+}
+
+func (s *Server) addSession(session *Session) {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	s.connSessions[session.id] = session
+}
+
+func (s *Server) removeSession(id int) {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	delete(s.connSessions, id)
+}
+
+func (s *Server) resetSessions() {
+	s.sessionLock.Lock()
+	defer s.sessionLock.Unlock()
+
+	s.connSessions = make(map[int]*Session)
+}
@@ -0,0 +1,246 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+type sessionKey struct{}
+
+func TestServerSession(t *testing.T) {
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	cert, privKey := createTestCertificate(t, 3455)
+
+	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
+	s := NewTlsServer("localhost", 0, sCh, cert, privKey)
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c := NewTlsClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)), cert, true)
+
+	before := time.Now()
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	sEvt := <-sEvtCh
+	if sEvt.EventType != connection.CONNECTED {
+		t.Error("server event is not connected")
+		t.FailNow()
+	}
+
+	session, ok := s.Session(sEvt.Id)
+	if !ok {
+		t.Error("no session for connected client")
+		t.FailNow()
+	}
+
+	if session.Id() != sEvt.Id || session.Protocol() != connection.Tls {
+		t.Error("unexpected session: ", session.Id(), session.Protocol())
+	}
+	if session.RemoteAddr().String() != c.conn.LocalAddr().String() {
+		t.Error("unexpected remote address: ", session.RemoteAddr())
+	}
+	if session.ConnectedAt().Before(before) {
+		t.Error("connect time before connect")
+	}
+	if session.TLS() == nil || !session.TLS().HandshakeComplete {
+		t.Error("no tls state")
+	}
+	if len(session.PeerCertificates()) != 0 {
+		t.Error("unexpected client certificates")
+	}
+
+	session.SetIdentity("device-1")
+	session.Set(sessionKey{}, 42)
+
+	if value, ok := SessionValue[int](session, sessionKey{}); !ok || value != 42 {
+		t.Error("unexpected session value: ", value, ok)
+	}
+	if _, ok := SessionValue[string](session, sessionKey{}); ok {
+		t.Error("value returned with wrong type")
+	}
+	session.Delete(sessionKey{})
+	if _, ok := session.Get(sessionKey{}); ok {
+		t.Error("value not deleted")
+	}
+	if session.Identity() != "device-1" {
+		t.Error("unexpected identity: ", session.Identity())
+	}
+
+	if err = c.Disconnect(); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.DISCONNECTED {
+			t.Error("server event is not disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("server not disconnected")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := s.Session(sEvt.Id); ok {
+		t.Error("session not destroyed after disconnect")
+	}
+}
+
+type stopHandler struct {
+	server    *Server
+	connected chan int
+	session   chan bool
+}
+
+func (h *stopHandler) Connected(id int) {
+	h.connected <- id
+}
+
+func (h *stopHandler) Disconnected(id int) {
+	_, ok := h.server.Session(id)
+	h.session <- ok
+}
+
+func (h *stopHandler) Received(id int, message []byte) {}
+
+// slowConn delays the read error, so the handler disconnects late.
+type slowConn struct {
+	net.Conn
+}
+
+func (c slowConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return n, err
+}
+
+type slowWrapper struct{}
+
+func (slowWrapper) WrapConn(conn net.Conn) net.Conn {
+	return slowConn{Conn: conn}
+}
+
+func (slowWrapper) WrapPacketConn(conn net.PacketConn) net.PacketConn {
+	return conn
+}
+
+func TestServerSessionOnStop(t *testing.T) {
+	h := &stopHandler{connected: make(chan int, 1), session: make(chan bool, 1)}
+	s, err := NewServerWithOptions("localhost", 0, h, connection.Tcp,
+		WithConnWrapper(slowWrapper{}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	h.server = s
+
+	err = s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	c := NewTcpClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 4)))
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	select {
+	case <-h.connected:
+	case <-time.After(time.Second):
+		t.Error("client not connected")
+		t.FailNow()
+	}
+
+	s.Stop()
+
+	select {
+	case ok := <-h.session:
+		if !ok {
+			t.Error("session gone before disconnected")
+		}
+	case <-time.After(time.Second):
+		t.Error("client not disconnected")
+	}
+}
+
+func TestServerSessionAtAccept(t *testing.T) {
+	cert, privKey := createTestCertificate(t, 3456)
+
+	s := NewTlsServer("localhost", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)), cert, privKey)
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	// a tcp connection, which never starts the tls handshake
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	var session *Session
+	for start := time.Now(); session == nil && time.Since(start) < time.Second; {
+		session, _ = s.Session(1)
+		time.Sleep(time.Millisecond)
+	}
+	if session == nil {
+		t.Error("no session before the handshake")
+		t.FailNow()
+	}
+	if session.TLS() != nil || session.RemoteAddr().String() != conn.LocalAddr().String() {
+		t.Error("unexpected session: ", session.TLS(), session.RemoteAddr())
+	}
+
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := s.Session(1); ok {
+		t.Error("session not destroyed after failed handshake")
+	}
+}
@@ -0,0 +1,546 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// Frame kinds once streams are enabled. Every frame starts with its kind,
+// messages follow as they are, stream frames are cobs encoded:
+//
+//	message: 0x01 | message
+//	open:    0x02 | cobs(stream id uint32)
+//	data:    0x03 | cobs(stream id uint32 | chunk)
+//	end:     0x04 | cobs(stream id uint32 | sha256 of the stream)
+//	cancel:  0x05 | cobs(stream id uint32 | reason)
+//	credit:  0x06 | cobs(stream id uint32 | chunks uint32)
+//	reject:  0x07 | cobs(stream id uint32 | reason)
+//
+// Open, data, end and cancel go from the sender to the receiver, credit and
+// reject back to the sender of the stream.
+const (
+	kindMessage byte = 0x01
+	kindOpen    byte = 0x02
+	kindData    byte = 0x03
+	kindEnd     byte = 0x04
+	kindCancel  byte = 0x05
+	kindCredit  byte = 0x06
+	kindReject  byte = 0x07
+)
+
+// A sender may send streamQueueLength chunks ahead of the receiver, it gets
+// credit for more once the receiver read them.
+const (
+	StreamChunkSize   = 16 * 1024
+	streamQueueLength = 64
+)
+
+var (
+	ErrStreamCanceled  = errors.New("stream canceled by peer")
+	ErrStreamRejected  = errors.New("stream rejected by peer")
+	ErrStreamOverrun   = errors.New("stream exceeds its credit")
+	ErrStreamChecksum  = errors.New("stream checksum mismatch")
+	ErrStreamsDisabled = errors.New("streams not enabled")
+	ErrStreamsUdp      = errors.New("streams require a stream protocol")
+
+	errMalformedFrame = errors.New("malformed stream frame")
+)
+
+// EnableStreams allows sending streams with SendStream and receiving them on
+// a handler implementing connection.StreamHandler. Normal messages are
+// prefixed with a frame kind, so the server has to enable it as well.
+func (c *Client) EnableStreams() error {
+	if c.proto == connection.Udp {
+		return ErrStreamsUdp
+	}
+
+	c.streams = true
+	return nil
+}
+
+// EnableStreams allows sending streams with SendStream and receiving them on
+// a handler implementing connection.StreamHandler. Normal messages are
+// prefixed with a frame kind, so all clients have to enable it as well.
+func (s *Server) EnableStreams() error {
+	if s.proto == connection.Udp {
+		return ErrStreamsUdp
+	}
+
+	s.streams = true
+	return nil
+}
+
+// SendStream sends everything read from r in chunks, which interleave with
+// normal messages. It returns once r is exhausted, on an error or when ctx
+// is canceled. The receiver sees a canceled or failed stream as
+// ErrStreamCanceled. Sending waits for the receiver reading the stream and
+// returns ErrStreamRejected, if the receiver closed it early.
+func (c *Client) SendStream(ctx context.Context, r io.Reader) (streamId uint32, err error) {
+	if !c.streams {
+		return 0, ErrStreamsDisabled
+	}
+	if c.conn == nil {
+		return 0, errors.New("not connected")
+	}
+
+	streamId = c.streamIds.Add(1)
+
+	stream, ctx, err := c.outgoing.add(ctx, 1, streamId)
+	if err != nil {
+		return 0, err
+	}
+	defer c.outgoing.remove(1, streamId)
+
+	return streamId, sendStream(ctx, streamId, r, stream, func(frame []byte) error {
+		return writeFrame(c.conn, &c.writeLock, c.framer, c.timeouts.Write, frame)
+	})
+}
+
+// SendStream sends everything read from r to client id, see Client.SendStream.
+func (s *Server) SendStream(ctx context.Context, id int, r io.Reader) (streamId uint32, err error) {
+	if !s.streams {
+		return 0, ErrStreamsDisabled
+	}
+
+	conn, err := s.getConnFromId(id)
+	if err != nil {
+		return 0, err
+	}
+
+	streamId = s.streamIds.Add(1)
+
+	stream, ctx, err := s.outgoing.add(ctx, id, streamId)
+	if err != nil {
+		return 0, err
+	}
+	defer s.outgoing.remove(id, streamId)
+
+	return streamId, sendStream(ctx, streamId, r, stream, func(frame []byte) error {
+		return writeFrame(conn, s.writeLock(id), s.framer, s.timeouts.Write, frame)
+	})
+}
+
+func sendStream(ctx context.Context, streamId uint32, r io.Reader,
+	stream *outgoingStream, write func(frame []byte) error) error {
+
+	if err := write(streamFrame(kindOpen, streamId, nil)); err != nil {
+		return err
+	}
+
+	cancel := func(reason error) error {
+		_ = write(streamFrame(kindCancel, streamId, []byte(reason.Error())))
+		return reason
+	}
+
+	checksum := sha256.New()
+	buffer := make([]byte, StreamChunkSize)
+
+	for {
+		if ctx.Err() != nil {
+			return cancel(context.Cause(ctx))
+		}
+
+		n, err := r.Read(buffer)
+		if n > 0 {
+			if wErr := stream.take(ctx); wErr != nil {
+				return cancel(wErr)
+			}
+			checksum.Write(buffer[:n])
+			if wErr := write(streamFrame(kindData, streamId, buffer[:n])); wErr != nil {
+				return wErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return cancel(err)
+		}
+	}
+
+	return write(streamFrame(kindEnd, streamId, checksum.Sum(nil)))
+}
+
+func streamFrame(kind byte, streamId uint32, payload []byte) []byte {
+	body := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(body, streamId)
+	copy(body[4:], payload)
+
+	return append([]byte{kind}, connection.CobsEncode(body)...)
+}
+
+func messageFrame(msg []byte) []byte {
+	return append([]byte{kindMessage}, msg...)
+}
+
+// outgoingStream is a stream being sent, which may send as many chunks as
+// the receiver granted.
+type outgoingStream struct {
+	lock   sync.Mutex
+	credit uint32
+	ready  chan struct{}
+	cancel context.CancelCauseFunc
+}
+
+func (o *outgoingStream) grant(chunks uint32) {
+	o.lock.Lock()
+	o.credit += chunks
+	o.lock.Unlock()
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take waits for credit to send a chunk.
+func (o *outgoingStream) take(ctx context.Context) error {
+	for {
+		o.lock.Lock()
+		if o.credit > 0 {
+			o.credit--
+			o.lock.Unlock()
+			return nil
+		}
+		o.lock.Unlock()
+
+		select {
+		case <-o.ready:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// outgoingStreams are the streams sent on the connections of a client or a
+// server, by connection id and stream id.
+type outgoingStreams struct {
+	lock    sync.Mutex
+	open    map[int]bool
+	streams map[uint64]*outgoingStream
+}
+
+func streamKey(id int, streamId uint32) uint64 {
+	return uint64(uint32(id))<<32 | uint64(streamId)
+}
+
+// connect allows sending streams on connection id.
+func (o *outgoingStreams) connect(id int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.open == nil {
+		o.open = make(map[int]bool)
+		o.streams = make(map[uint64]*outgoingStream)
+	}
+	o.open[id] = true
+}
+
+// disconnect cancels the streams sent on connection id.
+func (o *outgoingStreams) disconnect(id int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.open, id)
+	for key, stream := range o.streams {
+		if uint32(key>>32) == uint32(id) {
+			stream.cancel(io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func (o *outgoingStreams) add(ctx context.Context, id int,
+	streamId uint32) (*outgoingStream, context.Context, error) {
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.open[id] {
+		return nil, nil, errors.New("not connected")
+	}
+
+	stream := &outgoingStream{
+		credit: streamQueueLength,
+		ready:  make(chan struct{}, 1),
+	}
+	ctx, stream.cancel = context.WithCancelCause(ctx)
+	o.streams[streamKey(id, streamId)] = stream
+
+	return stream, ctx, nil
+}
+
+func (o *outgoingStreams) remove(id int, streamId uint32) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if stream := o.streams[streamKey(id, streamId)]; stream != nil {
+		stream.cancel(nil)
+		delete(o.streams, streamKey(id, streamId))
+	}
+}
+
+func (o *outgoingStreams) get(id int, streamId uint32) *outgoingStream {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.streams[streamKey(id, streamId)]
+}
+
+// streamDemux splits the frames of one connection into messages and the
+// incoming streams. It answers the sender of an incoming stream with credit
+// and rejects, and passes those for outgoing streams on.
+type streamDemux struct {
+	id       int
+	handler  connection.Handler
+	logger   log.LoggingInteface
+	received func(msg []byte)
+	write    func(frame []byte) error
+	incoming map[uint32]*incomingStream
+	outgoing *outgoingStreams
+}
+
+func newStreamDemux(id int, handler connection.Handler, logger log.LoggingInteface,
+	received func(msg []byte), write func(frame []byte) error,
+	outgoing *outgoingStreams) *streamDemux {
+
+	return &streamDemux{
+		id:       id,
+		handler:  handler,
+		logger:   logger,
+		received: received,
+		write:    write,
+		incoming: make(map[uint32]*incomingStream),
+		outgoing: outgoing,
+	}
+}
+
+func (d *streamDemux) input(frame []byte) {
+	if len(frame) == 0 {
+		d.framingError(errors.New("empty frame"))
+		return
+	}
+
+	kind := frame[0]
+	if kind == kindMessage {
+		d.received(frame[1:])
+		return
+	}
+
+	body, err := connection.CobsDecode(frame[1:])
+	if err != nil || len(body) < 4 {
+		d.framingError(errMalformedFrame)
+		return
+	}
+	streamId := binary.BigEndian.Uint32(body)
+	payload := body[4:]
+
+	switch kind {
+	case kindCredit:
+		if len(payload) != 4 {
+			d.framingError(errMalformedFrame)
+		} else if stream := d.outgoing.get(d.id, streamId); stream != nil {
+			stream.grant(binary.BigEndian.Uint32(payload))
+		}
+		return
+
+	case kindReject:
+		if stream := d.outgoing.get(d.id, streamId); stream != nil {
+			_ = d.logger.Debug("socket", "stream %d rejected: %s", streamId, string(payload))
+			stream.cancel(ErrStreamRejected)
+		}
+		return
+	}
+
+	stream := d.incoming[streamId]
+	if stream == nil && kind != kindOpen {
+		d.framingError(fmt.Errorf("frame for unknown stream %d", streamId))
+		return
+	}
+
+	switch kind {
+	case kindOpen:
+		if stream != nil {
+			stream.finish(ErrStreamCanceled)
+		}
+		stream = d.newIncomingStream(streamId)
+		d.incoming[streamId] = stream
+
+		streamHandler, ok := d.handler.(connection.StreamHandler)
+		if !ok {
+			_ = d.logger.Warn("socket", "handler does not accept streams, discard %d", streamId)
+			_ = stream.Close()
+			return
+		}
+		go streamHandler.ReceivedStream(d.id, streamId, stream)
+
+	case kindData:
+		if !stream.push(payload) {
+			_ = d.logger.Warn("socket", "stream %d from %d: %v", streamId, d.id, ErrStreamOverrun)
+			stream.finish(ErrStreamOverrun)
+			stream.reject(ErrStreamOverrun)
+		}
+
+	case kindEnd:
+		delete(d.incoming, streamId)
+		if bytes.Equal(stream.checksum.Sum(nil), payload) {
+			stream.finish(io.EOF)
+		} else {
+			stream.finish(ErrStreamChecksum)
+		}
+
+	case kindCancel:
+		delete(d.incoming, streamId)
+		_ = d.logger.Debug("socket", "stream %d canceled: %s", streamId, string(payload))
+		stream.finish(ErrStreamCanceled)
+
+	default:
+		d.framingError(fmt.Errorf("unknown frame kind %d", kind))
+	}
+}
+
+func (d *streamDemux) framingError(err error) {
+	_ = d.logger.Warn("socket", "frame from %d: %v", d.id, err)
+	notifyError(d.handler, d.id, connection.FramingError, err)
+}
+
+// close ends all incoming and outgoing streams of a lost connection.
+func (d *streamDemux) close() {
+	for streamId, stream := range d.incoming {
+		stream.finish(io.ErrUnexpectedEOF)
+		delete(d.incoming, streamId)
+	}
+	d.outgoing.disconnect(d.id)
+}
+
+func (d *streamDemux) newIncomingStream(streamId uint32) *incomingStream {
+	s := &incomingStream{
+		chunks:   make(chan []byte, streamQueueLength),
+		checksum: sha256.New(),
+	}
+
+	s.credit = func(chunks uint32) {
+		_ = d.write(streamFrame(kindCredit, streamId, binary.BigEndian.AppendUint32(nil, chunks)))
+	}
+	s.reject = func(reason error) {
+		if s.rejected.CompareAndSwap(false, true) {
+			_ = d.write(streamFrame(kindReject, streamId, []byte(reason.Error())))
+		}
+	}
+
+	return s
+}
+
+type incomingStream struct {
+	chunks   chan []byte
+	checksum hash.Hash
+	err      error
+	current  []byte
+	// read counts the chunks read since the last credit
+	read     uint32
+	credit   func(chunks uint32)
+	reject   func(reason error)
+	rejected atomic.Bool
+	finished atomic.Bool
+	discard  atomic.Bool
+	once     sync.Once
+	finishes sync.Once
+}
+
+// push queues a chunk without blocking the connection. It fails, if the
+// sender ignored its credit and the queue is full.
+func (s *incomingStream) push(chunk []byte) bool {
+	s.checksum.Write(chunk)
+
+	if s.discard.Load() {
+		return true
+	}
+	select {
+	case s.chunks <- chunk:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *incomingStream) finish(err error) {
+	s.finishes.Do(func() {
+		s.err = err
+		s.finished.Store(true)
+		s.discard.Store(true)
+		close(s.chunks)
+	})
+}
+
+func (s *incomingStream) Read(b []byte) (int, error) {
+	for len(s.current) == 0 {
+		chunk, ok := <-s.chunks
+		if !ok {
+			return 0, s.err
+		}
+		s.current = chunk
+
+		s.read++
+		if s.read >= streamQueueLength/2 {
+			s.credit(s.read)
+			s.read = 0
+		}
+	}
+
+	n := copy(b, s.current)
+	s.current = s.current[n:]
+
+	return n, nil
+}
+
+// Close discards the rest of the stream and rejects it, so the sender stops
+// sending.
+func (s *incomingStream) Close() error {
+	s.once.Do(func() {
+		if !s.finished.Load() {
+			s.reject(errors.New("closed by receiver"))
+		}
+		s.discard.Store(true)
+		go func() {
+			for range s.chunks {
+			}
+		}()
+	})
+	return nil
+}
@@ -0,0 +1,263 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+type streamResult struct {
+	streamId uint32
+	data     []byte
+	err      error
+}
+
+type streamCollector struct {
+	*connection.EventsToChannel
+	results chan streamResult
+}
+
+func (h *streamCollector) ReceivedStream(id int, streamId uint32, stream io.ReadCloser) {
+	data, err := io.ReadAll(stream)
+	h.results <- streamResult{streamId: streamId, data: data, err: err}
+}
+
+func TestStreamClientServer(t *testing.T) {
+	cMsgCh := make(chan connection.Message, 1)
+	cEvtCh := make(chan connection.Event, 1)
+
+	sMsgCh := make(chan connection.Message, 1)
+	sEvtCh := make(chan connection.Event, 1)
+
+	payload := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	sCh := &streamCollector{
+		EventsToChannel: connection.NewEventsToChannel(sMsgCh, sEvtCh),
+		results:         make(chan streamResult, 1),
+	}
+	s := NewTcpServer("localhost", 0, sCh)
+	if err := s.EnableStreams(); err != nil {
+		t.Error(err)
+	}
+
+	if err := NewUdpServer("localhost", 0, sCh).EnableStreams(); err == nil {
+		t.Error("streams enabled on udp")
+	}
+
+	err := s.ListenAndServe()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTcpClient("localhost", boundPort(t, s), cCh)
+	if err := c.EnableStreams(); err != nil {
+		t.Error(err)
+	}
+
+	err = c.Connect()
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	<-cEvtCh
+	sEvt := <-sEvtCh
+
+	sent := make(chan error, 1)
+	go func() {
+		_, err := c.SendStream(context.Background(), bytes.NewReader(payload))
+		sent <- err
+	}()
+
+	// normal messages interleave with the stream
+	time.Sleep(10 * time.Millisecond)
+	if err = c.Send([]byte("in between")); err != nil {
+		t.Error(err)
+	}
+
+	select {
+	case sMsg := <-sMsgCh:
+		if string(sMsg.Content) != "in between" {
+			t.Error("unexpected rx on server: ", string(sMsg.Content))
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("server no rx")
+	}
+
+	select {
+	case result := <-sCh.results:
+		if result.err != nil {
+			t.Error(result.err)
+		}
+		if !bytes.Equal(result.data, payload) {
+			t.Error("stream content differs, len ", len(result.data))
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("stream not received")
+	}
+
+	if err = <-sent; err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Send(sEvt.Id, []byte("hello client")); err != nil {
+		t.Error(err)
+	}
+	select {
+	case cMsg := <-cMsgCh:
+		if string(cMsg.Content) != "hello client" {
+			t.Error("unexpected rx on client: ", string(cMsg.Content))
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("client no rx")
+	}
+
+	if err = c.Disconnect(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamCancelAndChecksum(t *testing.T) {
+	results := make(chan streamResult, 2)
+	handler := &streamCollector{
+		EventsToChannel: connection.NewEventsToChannel(nil, nil),
+		results:         results,
+	}
+
+	var demux *streamDemux
+	write := func(frame []byte) error {
+		demux.input(frame)
+		return nil
+	}
+	outgoing := &outgoingStreams{}
+	outgoing.connect(1)
+	demux = newStreamDemux(1, handler, log.Global{}, func(msg []byte) {}, write, outgoing)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stream, ctx, err := outgoing.add(ctx, 1, 1)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = sendStream(ctx, 1, bytes.NewReader([]byte("data")), stream, write); !errors.Is(err, context.Canceled) {
+		t.Error("stream not canceled: ", err)
+	}
+	if result := <-results; !errors.Is(result.err, ErrStreamCanceled) {
+		t.Error("receiver not canceled: ", result.err)
+	}
+
+	_ = write(streamFrame(kindOpen, 2, nil))
+	_ = write(streamFrame(kindData, 2, []byte("data")))
+	_ = write(streamFrame(kindEnd, 2, make([]byte, 32)))
+	if result := <-results; !errors.Is(result.err, ErrStreamChecksum) {
+		t.Error("checksum mismatch not detected: ", result.err)
+	}
+}
+
+// rejectingHandler closes every stream without reading it.
+type rejectingHandler struct {
+	*connection.EventsToChannel
+}
+
+func (h *rejectingHandler) ReceivedStream(id int, streamId uint32, stream io.ReadCloser) {
+	_ = stream.Close()
+}
+
+func TestStreamRejectAndOverrun(t *testing.T) {
+	var demux *streamDemux
+	write := func(frame []byte) error {
+		demux.input(frame)
+		return nil
+	}
+	outgoing := &outgoingStreams{}
+	outgoing.connect(1)
+	demux = newStreamDemux(1, &rejectingHandler{connection.NewEventsToChannel(nil, nil)},
+		log.Global{}, func(msg []byte) {}, write, outgoing)
+
+	// the sender stops once the receiver closed the stream
+	stream, ctx, err := outgoing.add(context.Background(), 1, 1)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	payload := make([]byte, 4*streamQueueLength*StreamChunkSize)
+	if err = sendStream(ctx, 1, bytes.NewReader(payload), stream, write); !errors.Is(err, ErrStreamRejected) {
+		t.Error("stream not rejected: ", err)
+	}
+	outgoing.remove(1, 1)
+
+	// a sender ignoring its credit gets rejected instead of blocking the reader
+	replies := make(chan []byte, 8)
+	release := make(chan struct{})
+	results := make(chan streamResult, 1)
+	demux = newStreamDemux(1, &streamCollector{
+		EventsToChannel: connection.NewEventsToChannel(nil, nil),
+		results:         results,
+	}, log.Global{}, func(msg []byte) {}, func(frame []byte) error {
+		replies <- frame
+		return nil
+	}, &outgoingStreams{})
+
+	// hold back the reader of the stream
+	demux.handler = &delayedHandler{streamCollector: demux.handler.(*streamCollector), release: release}
+
+	demux.input(streamFrame(kindOpen, 2, nil))
+	for i := 0; i <= streamQueueLength; i++ {
+		demux.input(streamFrame(kindData, 2, []byte("chunk")))
+	}
+	close(release)
+
+	if result := <-results; !errors.Is(result.err, ErrStreamOverrun) {
+		t.Error("overrun not detected: ", result.err)
+	}
+	if reply := <-replies; reply[0] != kindReject {
+		t.Error("overrun stream not rejected: ", reply)
+	}
+}
+
+// delayedHandler reads streams once released.
+type delayedHandler struct {
+	*streamCollector
+	release chan struct{}
+}
+
+func (h *delayedHandler) ReceivedStream(id int, streamId uint32, stream io.ReadCloser) {
+	<-h.release
+	h.streamCollector.ReceivedStream(id, streamId, stream)
+}
@@ -27,6 +27,7 @@ package socket
 
 import (
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
@@ -40,11 +41,8 @@ func TestTcpClientServer(t *testing.T) {
 	sMsgCh := make(chan connection.Message, 1)
 	sEvtCh := make(chan connection.Event, 1)
 
-	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
-	c := NewTcpClient("localhost", 22334, cCh)
-
 	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
-	s := NewTcpServer("localhost", 22334, sCh)
+	s := NewTcpServer("localhost", 0, sCh)
 
 	err := s.ListenAndServe()
 	if err != nil {
@@ -52,6 +50,9 @@ func TestTcpClientServer(t *testing.T) {
 		t.FailNow()
 	}
 
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTcpClient("localhost", boundPort(t, s), cCh)
+
 	err = c.Connect()
 	if err != nil {
 		t.Error(err)
@@ -109,3 +110,69 @@ func TestTcpClientServer(t *testing.T) {
 	}
 	s.Stop()
 }
+
+func TestEphemeralPort(t *testing.T) {
+	sEvtCh := make(chan connection.Event, 1)
+
+	for _, proto := range []connection.Protocol{connection.Tcp, connection.Udp} {
+		s := NewServer("localhost", 0, connection.NewEventsToChannel(
+			make(chan connection.Message, 1), sEvtCh), proto)
+		if s.Addr() != nil {
+			t.Error("address before listen: ", s.Addr())
+		}
+
+		if err := s.ListenAndServe(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		c := NewClient("localhost", boundPort(t, s), connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)), proto)
+		if c.LocalAddr() != nil || c.RemoteAddr() != nil {
+			t.Error("address before connect")
+		}
+		if err := c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		if err := c.Send([]byte("hello")); err != nil {
+			t.Error(err)
+		}
+
+		sEvt := <-sEvtCh
+		session, ok := s.Session(sEvt.Id)
+		if !ok {
+			t.Error("no session on ", proto)
+			t.FailNow()
+		}
+		if c.RemoteAddr().String() != s.Addr().String() ||
+			c.LocalAddr().String() != session.RemoteAddr().String() {
+
+			t.Error("unexpected addresses: ", c.LocalAddr(), c.RemoteAddr(), s.Addr())
+		}
+
+		_ = c.Disconnect()
+		if proto == connection.Tcp {
+			<-sEvtCh
+		}
+		s.Stop()
+	}
+}
+
+// boundPort returns the port a server listening on port 0 is bound to.
+func boundPort(t *testing.T, s *Server) uint16 {
+	return addrPort(t, s.Addr())
+}
+
+func addrPort(t *testing.T, addr net.Addr) uint16 {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return uint16(addr.Port)
+	case *net.UDPAddr:
+		return uint16(addr.Port)
+	}
+
+	t.Error("no ip address: ", addr)
+	t.FailNow()
+	return 0
+}
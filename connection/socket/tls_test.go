@@ -55,10 +55,7 @@ func TestTlsClientServer(t *testing.T) {
 		t.FailNow()
 	}
 	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
-	s := NewTlsServer("localhost", 22334, sCh, cert, privKey)
-
-	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
-	c := NewTlsClient("localhost", 22334, cCh, cert, true)
+	s := NewTlsServer("localhost", 0, sCh, cert, privKey)
 
 	err = s.ListenAndServe()
 	if err != nil {
@@ -66,6 +63,9 @@ func TestTlsClientServer(t *testing.T) {
 		t.FailNow()
 	}
 
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewTlsClient("localhost", boundPort(t, s), cCh, cert, true)
+
 	err = c.Connect()
 	if err != nil {
 		t.Error(err)
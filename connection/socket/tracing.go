@@ -0,0 +1,183 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/trace"
+)
+
+// WithTracer reports dial, accept, handshake, receive, dispatch, send and
+// close to hook.
+func WithTracer(hook trace.Hook) Option {
+	return func(c *config) error {
+		if hook == nil {
+			return errors.New("trace hook is nil")
+		}
+		c.tracing.hook = hook
+		return nil
+	}
+}
+
+// WithTraceparent prefixes every message sent with the W3C traceparent of
+// its span and a line feed, and strips it from received messages. Both sides
+// need it. A connection.ContextHandler gets the trace context of received
+// messages.
+func WithTraceparent() Option {
+	return func(c *config) error {
+		c.tracing.traceparent = true
+		return nil
+	}
+}
+
+type tracing struct {
+	hook        trace.Hook
+	traceparent bool
+}
+
+func (t tracing) enabled() bool {
+	return t.hook != nil || t.traceparent
+}
+
+// emit reports an operation started at start.
+func (t tracing) emit(op trace.Operation, id int, start time.Time, err error,
+	span trace.SpanContext, parent trace.SpanContext, attributes ...string) {
+
+	if t.hook == nil {
+		return
+	}
+
+	evt := trace.Event{
+		Operation:  op,
+		Id:         id,
+		Start:      start,
+		Duration:   time.Since(start),
+		Err:        err,
+		Attributes: make(map[string]string, len(attributes)/2),
+		Span:       span,
+		Parent:     parent,
+	}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		evt.Attributes[attributes[i]] = attributes[i+1]
+	}
+	t.hook.Trace(evt)
+}
+
+// connection returns the span of a new connection. It is reported on close
+// and is the parent of the other lifecycle operations.
+func (t tracing) connection() trace.SpanContext {
+	if t.hook == nil {
+		return trace.SpanContext{}
+	}
+	return trace.NewRoot()
+}
+
+// lifecycle reports an operation of the connection with span conn, a new
+// trace without.
+func (t tracing) lifecycle(op trace.Operation, id int, start time.Time, err error,
+	conn trace.SpanContext, attributes ...string) {
+
+	if t.hook == nil {
+		return
+	}
+
+	span := trace.NewRoot()
+	if conn.IsValid() {
+		span = conn.Child()
+	}
+	t.emit(op, id, start, err, span, conn, attributes...)
+}
+
+// inject starts the span of a message sent within ctx and prefixes the
+// message with its traceparent.
+func (t tracing) inject(ctx context.Context, msg []byte) (
+	[]byte, trace.SpanContext, trace.SpanContext) {
+
+	if !t.enabled() {
+		return msg, trace.SpanContext{}, trace.SpanContext{}
+	}
+
+	parent, ok := trace.SpanFromContext(ctx)
+	span := trace.NewRoot()
+	if ok {
+		span = parent.Child()
+	}
+	if !t.traceparent {
+		return msg, span, parent
+	}
+
+	header := make([]byte, 0, trace.TraceparentSize+1+len(msg))
+	header = append(header, span.Traceparent()...)
+	header = append(header, '\n')
+	return append(header, msg...), span, parent
+}
+
+// extract strips the traceparent of a received message, if any.
+func (t tracing) extract(msg []byte) ([]byte, trace.SpanContext) {
+	if !t.traceparent || len(msg) <= trace.TraceparentSize ||
+		msg[trace.TraceparentSize] != '\n' {
+
+		return msg, trace.SpanContext{}
+	}
+
+	span, err := trace.ParseTraceparent(string(msg[:trace.TraceparentSize]))
+	if err != nil {
+		return msg, trace.SpanContext{}
+	}
+	return msg[trace.TraceparentSize+1:], span
+}
+
+// deliver passes a received message to the handler, within the trace of the
+// sender if propagated.
+func (t tracing) deliver(handler connection.Handler, id int, msg []byte) {
+	if !t.enabled() {
+		handler.Received(id, msg)
+		return
+	}
+
+	start := time.Now()
+	msg, remote := t.extract(msg)
+	receive := trace.NewRoot()
+	if remote.IsValid() {
+		receive = remote.Child()
+	}
+	t.emit(trace.Receive, id, start, nil, receive, remote,
+		trace.AttrSize, strconv.Itoa(len(msg)))
+
+	dispatch := receive.Child()
+	start = time.Now()
+	if contextHandler, ok := handler.(connection.ContextHandler); ok {
+		contextHandler.ReceivedContext(trace.ContextWithSpan(context.Background(), dispatch), id, msg)
+	} else {
+		handler.Received(id, msg)
+	}
+	t.emit(trace.Dispatch, id, start, nil, dispatch, receive)
+}
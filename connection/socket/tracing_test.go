@@ -0,0 +1,195 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+	"github.com/ChrIgiSta/go-utils/connection/trace"
+)
+
+type traceRecorder struct {
+	lock   sync.Mutex
+	events []trace.Event
+}
+
+func (r *traceRecorder) Trace(evt trace.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, evt)
+}
+
+func (r *traceRecorder) find(op trace.Operation) (trace.Event, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, evt := range r.events {
+		if evt.Operation == op {
+			return evt, true
+		}
+	}
+	return trace.Event{}, false
+}
+
+type contextMessage struct {
+	ctx context.Context
+	msg []byte
+}
+
+type contextHandler struct {
+	*connection.EventsToChannel
+	received chan contextMessage
+}
+
+func (h *contextHandler) ReceivedContext(ctx context.Context, id int, message []byte) {
+	h.received <- contextMessage{ctx: ctx, msg: message}
+}
+
+func TestTracing(t *testing.T) {
+	sTrace := &traceRecorder{}
+	sEvtCh := make(chan connection.Event, 4)
+	handler := &contextHandler{
+		EventsToChannel: connection.NewEventsToChannel(nil, sEvtCh),
+		received:        make(chan contextMessage, 2),
+	}
+
+	s, err := NewServerWithOptions("127.0.0.1", 0, handler, connection.Tcp,
+		WithTracer(sTrace), WithTraceparent())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	cTrace := &traceRecorder{}
+	cMsgCh := make(chan connection.Message, 1)
+	c, err := NewClientWithOptions("127.0.0.1", boundPort(t, s),
+		connection.NewEventsToChannel(cMsgCh, make(chan connection.Event, 2)), connection.Tcp,
+		WithTracer(cTrace), WithTraceparent())
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	id := (<-sEvtCh).Id
+
+	parent := trace.NewRoot()
+	if err = c.SendContext(trace.ContextWithSpan(context.Background(), parent), []byte("stop motor")); err != nil {
+		t.Error(err)
+	}
+
+	var received contextMessage
+	select {
+	case received = <-handler.received:
+	case <-time.After(time.Second):
+		t.Error("message not received")
+		t.FailNow()
+	}
+	if string(received.msg) != "stop motor" {
+		t.Error("traceparent not stripped: ", string(received.msg))
+	}
+
+	span, ok := trace.SpanFromContext(received.ctx)
+	if !ok || span.TraceID != parent.TraceID {
+		t.Error("trace not propagated: ", span)
+	}
+
+	send, ok := cTrace.find(trace.Send)
+	if !ok || send.Parent != parent || send.Span.TraceID != parent.TraceID {
+		t.Error("unexpected send event: ", send)
+	}
+	receive, _ := sTrace.find(trace.Receive)
+	if receive.Parent != send.Span || receive.Attributes[trace.AttrSize] != "10" {
+		t.Error("unexpected receive event: ", receive)
+	}
+	if dispatch, _ := sTrace.find(trace.Dispatch); dispatch.Span != span || dispatch.Parent != receive.Span {
+		t.Error("unexpected dispatch event: ", dispatch)
+	}
+
+	// the plain handler interface gets the message without header as well
+	if err = s.Send(id, []byte("ack")); err != nil {
+		t.Error(err)
+	}
+	select {
+	case msg := <-cMsgCh:
+		if string(msg.Content) != "ack" {
+			t.Error("traceparent not stripped: ", string(msg.Content))
+		}
+	case <-time.After(time.Second):
+		t.Error("message not received")
+	}
+
+	_ = c.Disconnect()
+	select {
+	case <-sEvtCh:
+	case <-time.After(time.Second):
+		t.Error("not disconnected")
+	}
+
+	for _, op := range []trace.Operation{trace.Dial, trace.Send, trace.Receive, trace.Dispatch, trace.Close} {
+		if _, ok = cTrace.find(op); !ok {
+			t.Error("client did not trace ", op)
+		}
+	}
+	for _, op := range []trace.Operation{trace.Accept, trace.Receive, trace.Dispatch, trace.Send, trace.Close} {
+		if _, ok = sTrace.find(op); !ok {
+			t.Error("server did not trace ", op)
+		}
+	}
+	dial, _ := cTrace.find(trace.Dial)
+	if dial.Attributes[trace.AttrProtocol] != "tcp" {
+		t.Error("unexpected dial event: ", dial)
+	}
+
+	// the lifecycle operations are children of the connection span
+	closed, _ := cTrace.find(trace.Close)
+	if dial.Parent != closed.Span || closed.Parent.IsValid() || closed.Start.After(dial.Start) {
+		t.Error("dial not within the connection span: ", dial, closed)
+	}
+	accept, _ := sTrace.find(trace.Accept)
+	closed, _ = sTrace.find(trace.Close)
+	if accept.Parent != closed.Span || accept.Duration <= 0 || closed.Start.After(accept.Start) {
+		t.Error("accept not within the connection span: ", accept, closed)
+	}
+
+	if _, err = NewClientWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(nil, nil),
+		connection.Tcp, WithFramer(RawFramer{}), WithTraceparent()); err == nil {
+
+		t.Error("traceparent accepted without message boundaries")
+	}
+}
@@ -40,11 +40,8 @@ func TestUdpClientServer(t *testing.T) {
 	sMsgCh := make(chan connection.Message, 1)
 	sEvtCh := make(chan connection.Event, 1)
 
-	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
-	c := NewUdpClient("localhost", 22333, cCh)
-
 	sCh := connection.NewEventsToChannel(sMsgCh, sEvtCh)
-	s := NewUdpServer("localhost", 22333, sCh)
+	s := NewUdpServer("localhost", 0, sCh)
 
 	err := s.ListenAndServe()
 	if err != nil {
@@ -52,6 +49,9 @@ func TestUdpClientServer(t *testing.T) {
 		t.FailNow()
 	}
 
+	cCh := connection.NewEventsToChannel(cMsgCh, cEvtCh)
+	c := NewUdpClient("localhost", boundPort(t, s), cCh)
+
 	err = c.Connect()
 	if err != nil {
 		t.Error(err)
@@ -109,3 +109,64 @@ func TestUdpClientServer(t *testing.T) {
 	}
 	s.Stop()
 }
+
+func TestUdpIdlePeer(t *testing.T) {
+	sEvtCh := make(chan connection.Event, 8)
+	s, err := NewServerWithOptions("127.0.0.1", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 4), sEvtCh), connection.Udp,
+		WithTimeouts(Timeouts{Read: 100 * time.Millisecond}), WithMaxConns(1))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	send := func() int {
+		c := NewUdpClient("127.0.0.1", boundPort(t, s), connection.NewEventsToChannel(
+			make(chan connection.Message, 1), make(chan connection.Event, 2)))
+		if err := c.Connect(); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+		defer c.Disconnect()
+
+		if err := c.Send([]byte("hi")); err != nil {
+			t.Error(err)
+		}
+		select {
+		case sEvt := <-sEvtCh:
+			if sEvt.EventType != connection.CONNECTED {
+				t.Error("server event is not connected")
+			}
+			return sEvt.Id
+		case <-time.After(time.Second):
+			t.Error("server not connected")
+			t.FailNow()
+		}
+		return 0
+	}
+
+	id := send()
+
+	// the idle peer is disconnected and frees its slot of the max conns
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.DISCONNECTED || sEvt.Id != id {
+			t.Error("unexpected event: ", sEvt.EventType, sEvt.Id)
+		}
+	case <-time.After(time.Second):
+		t.Error("idle peer not disconnected")
+		t.FailNow()
+	}
+	if _, ok := s.Session(id); ok {
+		t.Error("session of idle peer not destroyed")
+	}
+
+	if next := send(); next == id {
+		t.Error("id of evicted peer reused")
+	}
+}
@@ -0,0 +1,130 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrPeerCredentials = errors.New("peer credentials not supported")
+
+// UnixOptions apply to the socket file of a unix server. They are not
+// available for abstract names.
+type UnixOptions struct {
+	// Mode of the socket file, 0 keeps the default of the umask
+	Mode os.FileMode
+	// Owner of the socket file, nil keeps the process owner
+	Owner *UnixOwner
+}
+
+type UnixOwner struct {
+	Uid int
+	Gid int
+}
+
+// PeerCredentials of the process on the other side of a unix connection.
+type PeerCredentials struct {
+	Pid int
+	Uid int
+	Gid int
+}
+
+// SetUnixOptions sets mode and owner of the socket file created by
+// ListenAndServe.
+func (s *Server) SetUnixOptions(options UnixOptions) {
+	s.unixOptions = options
+}
+
+func isAbstract(path string) bool {
+	return strings.HasPrefix(path, "@")
+}
+
+// removeStaleSocket removes a socket file, which nothing listens on anymore,
+// e.g. after a crash. Any other file is left for ListenUnix to fail on. It
+// probes by connecting, so a server still listening sees a connection, which
+// closes right away.
+func (s *Server) removeStaleSocket(addr *net.UnixAddr) error {
+	if isAbstract(addr.Name) {
+		return nil
+	}
+
+	info, err := os.Lstat(addr.Name)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout(addr.Net, addr.Name, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s in use", addr.Name)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return nil
+	}
+
+	_ = s.logger.Info("socket", "remove stale socket %s", addr.Name)
+	return os.Remove(addr.Name)
+}
+
+func (options UnixOptions) isSet() bool {
+	return options.Mode != 0 || options.Owner != nil
+}
+
+// applyUnixOptions sets owner and mode of the socket file at path. The mode
+// stays as created, if none is set.
+func applyUnixOptions(path string, options UnixOptions) error {
+	if options.Owner != nil {
+		err := os.Chown(path, options.Owner.Uid, options.Owner.Gid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.Mode != 0 {
+		return os.Chmod(path, options.Mode)
+	}
+	return nil
+}
+
+// unixConn finds the unix connection underneath wrappers.
+func unixConn(conn net.Conn) (*net.UnixConn, bool) {
+	for {
+		switch c := conn.(type) {
+		case *net.UnixConn:
+			return c, true
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,158 @@
+//go:build linux
+
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package socket
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ChrIgiSta/go-utils/connection"
+)
+
+func TestUnixAbstractPeerCredentials(t *testing.T) {
+	sEvtCh := make(chan connection.Event, 1)
+	s := NewUnixServer("@go-utils-test", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh))
+
+	s.SetUnixOptions(UnixOptions{Mode: 0600})
+	if err := s.ListenAndServe(); err == nil {
+		t.Error("file options accepted on abstract socket")
+		s.Stop()
+	}
+	s.SetUnixOptions(UnixOptions{})
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	c := NewUnixClient("@go-utils-test", 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err := c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	var sEvt connection.Event
+	select {
+	case sEvt = <-sEvtCh:
+		if sEvt.EventType != connection.CONNECTED {
+			t.Error("server event is not connected")
+			t.FailNow()
+		}
+	case <-time.After(time.Second):
+		t.Error("server not connected")
+		t.FailNow()
+	}
+
+	session, ok := s.Session(sEvt.Id)
+	if !ok {
+		t.Error("no session")
+		t.FailNow()
+	}
+
+	cred := session.PeerCredentials()
+	if cred == nil {
+		t.Error("no peer credentials")
+		t.FailNow()
+	}
+	if cred.Pid != os.Getpid() || cred.Uid != os.Getuid() || cred.Gid != os.Getgid() {
+		t.Error("unexpected peer credentials: ", *cred)
+	}
+}
+
+func TestUnixOwnerKeepsUmask(t *testing.T) {
+	const path = "/tmp/go-utils-owner-test.sock"
+
+	mask := syscall.Umask(0o022)
+	defer syscall.Umask(mask)
+
+	s := NewUnixServer(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 1)))
+	s.SetUnixOptions(UnixOptions{
+		Owner: &UnixOwner{Uid: os.Getuid(), Gid: os.Getgid()}})
+
+	if err := s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0755 {
+		t.Error("unexpected mode: ", info.Mode().Perm())
+	}
+
+	if current := syscall.Umask(0o022); current != 0o022 {
+		t.Error("umask not restored: ", current)
+	}
+}
+
+func TestUnixOptionsMoveSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/moved.sock"
+
+	s, err := NewServerWithOptions(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)),
+		connection.Unix, WithUnixOptions(UnixOptions{Mode: 0600}))
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// the private directory is gone, the socket in place
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "moved.sock" {
+		t.Error("unexpected directory content: ", entries)
+	}
+	if s.Addr().String() != path {
+		t.Error("unexpected address: ", s.Addr())
+	}
+
+	c := NewUnixClient(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+	}
+	_ = c.Disconnect()
+
+	s.Stop()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket not removed: ", err)
+	}
+}
@@ -27,6 +27,8 @@ package socket
 
 import (
 	"fmt"
+	"net"
+	"os"
 	"testing"
 	"time"
 
@@ -109,3 +111,59 @@ func TestUnixClientServer(t *testing.T) {
 	}
 	s.Stop()
 }
+
+func TestUnixPathServer(t *testing.T) {
+	const path = "/tmp/go-utils-test.sock"
+
+	// leave a stale socket file behind, as after a crash
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	sEvtCh := make(chan connection.Event, 4)
+	s := NewUnixServer(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), sEvtCh))
+	s.SetUnixOptions(UnixOptions{Mode: 0600})
+
+	if err = s.ListenAndServe(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer s.Stop()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Error("unexpected mode: ", info.Mode().Perm())
+	}
+
+	c := NewUnixClient(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 2)))
+	if err = c.Connect(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer c.Disconnect()
+
+	select {
+	case sEvt := <-sEvtCh:
+		if sEvt.EventType != connection.CONNECTED {
+			t.Error("server event is not connected")
+		}
+	case <-time.After(time.Second):
+		t.Error("server not connected")
+	}
+
+	// the probe for a listener connects to the running server
+	other := NewUnixServer(path, 0, connection.NewEventsToChannel(
+		make(chan connection.Message, 1), make(chan connection.Event, 1)))
+	if err = other.ListenAndServe(); err == nil {
+		t.Error("socket in use removed")
+		other.Stop()
+	}
+}
@@ -0,0 +1,143 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trace
+
+import (
+	"context"
+	"time"
+
+	log "github.com/ChrIgiSta/go-utils/logger"
+)
+
+// SpanData is a finished span, shaped like an OpenTelemetry span, so an
+// exporter maps it field by field.
+type SpanData struct {
+	Name         string
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Err          error
+}
+
+// Exporter is implemented by a thin shim around e.g. an OpenTelemetry span
+// exporter.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// ExporterHook batches the events as spans for an Exporter.
+type ExporterHook struct {
+	exporter Exporter
+	spans    chan SpanData
+	done     chan struct{}
+}
+
+// NewExporterHook exports up to batchSize spans at once, at the latest after
+// interval (1s if not set). Spans are dropped while the exporter is behind
+// by more than a few batches.
+func NewExporterHook(exporter Exporter, batchSize int, interval time.Duration) *ExporterHook {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	h := &ExporterHook{
+		exporter: exporter,
+		spans:    make(chan SpanData, 4*batchSize),
+		done:     make(chan struct{}),
+	}
+	go h.run(batchSize, interval)
+	return h
+}
+
+func (h *ExporterHook) Trace(evt Event) {
+	if !evt.Span.IsValid() {
+		return
+	}
+
+	span := SpanData{
+		Name:         string(evt.Operation),
+		TraceID:      evt.Span.TraceID,
+		SpanID:       evt.Span.SpanID,
+		ParentSpanID: evt.Parent.SpanID,
+		Start:        evt.Start,
+		End:          evt.Start.Add(evt.Duration),
+		Attributes:   evt.Attributes,
+		Err:          evt.Err,
+	}
+
+	select {
+	case h.spans <- span:
+	default:
+		_ = log.Fine("trace", "drop span %s, exporter behind", span.Name)
+	}
+}
+
+// Close exports the pending spans and stops the hook, it must not be traced
+// to afterwards.
+func (h *ExporterHook) Close() {
+	close(h.spans)
+	<-h.done
+}
+
+func (h *ExporterHook) run(batchSize int, interval time.Duration) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.exporter.ExportSpans(context.Background(), batch); err != nil {
+			_ = log.Warn("trace", "export %d spans: %v", len(batch), err)
+		}
+		batch = make([]SpanData, 0, batchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-h.spans:
+			if !ok {
+				export()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		}
+	}
+}
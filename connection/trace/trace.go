@@ -0,0 +1,94 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+// Package trace describes the lifecycle of socket connections and messages
+// as events for a Hook, and propagates W3C trace contexts.
+package trace
+
+import (
+	"context"
+	"time"
+)
+
+// Operation is traced. Close spans the whole connection, Dial, Accept and
+// Handshake are its children.
+type Operation string
+
+const (
+	Dial      Operation = "dial"
+	Accept    Operation = "accept"
+	Handshake Operation = "handshake"
+	Receive   Operation = "receive"
+	Dispatch  Operation = "dispatch"
+	Send      Operation = "send"
+	Close     Operation = "close"
+)
+
+// Common attribute keys.
+const (
+	AttrProtocol = "net.protocol"
+	AttrLocal    = "net.local"
+	AttrPeer     = "net.peer"
+	AttrSize     = "message.size"
+	AttrResumed  = "tls.resumed"
+)
+
+// Event is a finished operation on connection Id. Span is the span of the
+// operation, Parent the span it belongs to, if any.
+type Event struct {
+	Operation  Operation
+	Id         int
+	Start      time.Time
+	Duration   time.Duration
+	Err        error
+	Attributes map[string]string
+	Span       SpanContext
+	Parent     SpanContext
+}
+
+// Hook is called synchronously on every operation, so it should be fast.
+type Hook interface {
+	Trace(evt Event)
+}
+
+type HookFunc func(evt Event)
+
+func (f HookFunc) Trace(evt Event) {
+	f(evt)
+}
+
+type contextKey struct{}
+
+// ContextWithSpan returns a context carrying span, e.g. to pass it to
+// socket.Client.SendContext.
+func ContextWithSpan(ctx context.Context, span SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	span, ok := ctx.Value(contextKey{}).(SpanContext)
+	return span, ok && span.IsValid()
+}
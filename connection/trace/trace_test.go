@@ -0,0 +1,116 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trace
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	root := NewRoot()
+	child := root.Child()
+	if child.TraceID != root.TraceID || child.SpanID == root.SpanID {
+		t.Error("unexpected child: ", child)
+	}
+
+	parsed, err := ParseTraceparent(child.Traceparent())
+	if err != nil || parsed != child {
+		t.Error("roundtrip failed: ", parsed, err)
+	}
+
+	span, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil || span.Flags != FlagSampled || span.SpanID[7] != 0xb7 {
+		t.Error("unexpected span: ", span, err)
+	}
+
+	invalid := []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7-01",
+	}
+	for _, traceparent := range invalid {
+		if _, err = ParseTraceparent(traceparent); err == nil {
+			t.Error("accepted ", traceparent)
+		}
+	}
+
+	if _, ok := SpanFromContext(context.Background()); ok {
+		t.Error("span in empty context")
+	}
+	if span, ok := SpanFromContext(ContextWithSpan(context.Background(), root)); !ok || span != root {
+		t.Error("span not carried")
+	}
+}
+
+type testExporter struct {
+	lock    sync.Mutex
+	batches [][]SpanData
+}
+
+func (e *testExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.batches = append(e.batches, spans)
+	return nil
+}
+
+func TestExporterHook(t *testing.T) {
+	exporter := &testExporter{}
+	hook := NewExporterHook(exporter, 2, time.Hour)
+
+	root := NewRoot()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		hook.Trace(Event{
+			Operation:  Receive,
+			Start:      start,
+			Duration:   time.Millisecond,
+			Attributes: map[string]string{AttrSize: "5"},
+			Span:       root.Child(),
+			Parent:     root,
+		})
+	}
+	hook.Trace(Event{Operation: Close})
+	hook.Close()
+
+	if len(exporter.batches) != 2 || len(exporter.batches[0]) != 2 || len(exporter.batches[1]) != 1 {
+		t.Error("unexpected batches: ", exporter.batches)
+		t.FailNow()
+	}
+
+	span := exporter.batches[0][0]
+	if span.Name != "receive" || span.TraceID != root.TraceID ||
+		span.ParentSpanID != root.SpanID || span.End.Sub(span.Start) != time.Millisecond {
+
+		t.Error("unexpected span: ", span)
+	}
+}
@@ -0,0 +1,102 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// TraceparentSize is the length of a version 00 traceparent.
+const TraceparentSize = 55
+
+var ErrTraceparent = errors.New("trace: malformed traceparent")
+
+// SpanContext identifies a span as in a W3C traceparent.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// FlagSampled marks a trace to be recorded.
+const FlagSampled byte = 0x01
+
+// NewRoot starts a new sampled trace.
+func NewRoot() SpanContext {
+	span := SpanContext{Flags: FlagSampled}
+	_, _ = rand.Read(span.TraceID[:])
+	_, _ = rand.Read(span.SpanID[:])
+	return span
+}
+
+// Child returns a new span within the same trace.
+func (s SpanContext) Child() SpanContext {
+	child := SpanContext{TraceID: s.TraceID, Flags: s.Flags}
+	_, _ = rand.Read(child.SpanID[:])
+	return child
+}
+
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != [16]byte{} && s.SpanID != [8]byte{}
+}
+
+// Traceparent formats the span as version 00 traceparent.
+func (s SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", s.TraceID, s.SpanID, s.Flags)
+}
+
+func (s SpanContext) String() string {
+	return s.Traceparent()
+}
+
+// ParseTraceparent parses a version 00 traceparent.
+func ParseTraceparent(traceparent string) (span SpanContext, err error) {
+	if len(traceparent) != TraceparentSize || traceparent[:3] != "00-" ||
+		traceparent[35] != '-' || traceparent[52] != '-' {
+
+		return span, ErrTraceparent
+	}
+
+	if _, err = hex.Decode(span.TraceID[:], []byte(traceparent[3:35])); err != nil {
+		return span, ErrTraceparent
+	}
+	if _, err = hex.Decode(span.SpanID[:], []byte(traceparent[36:52])); err != nil {
+		return span, ErrTraceparent
+	}
+	var flags [1]byte
+	if _, err = hex.Decode(flags[:], []byte(traceparent[53:])); err != nil {
+		return span, ErrTraceparent
+	}
+	span.Flags = flags[0]
+
+	if !span.IsValid() {
+		return span, ErrTraceparent
+	}
+	return span, nil
+}
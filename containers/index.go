@@ -0,0 +1,175 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package containers
+
+import (
+	"sort"
+	"sync"
+)
+
+// Index is a concurrent many-to-many relation between named keys and ids,
+// which can be looked up from both sides.
+type Index struct {
+	ids  map[string]map[int]struct{}
+	keys map[int]map[string]struct{}
+	lock sync.RWMutex
+}
+
+func NewIndex() *Index {
+	return &Index{
+		ids:  make(map[string]map[int]struct{}),
+		keys: make(map[int]map[string]struct{}),
+	}
+}
+
+// Add relates id to key. It returns false, if they were already related.
+func (x *Index) Add(key string, id int) bool {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if _, ok := x.ids[key][id]; ok {
+		return false
+	}
+
+	if x.ids[key] == nil {
+		x.ids[key] = make(map[int]struct{})
+	}
+	if x.keys[id] == nil {
+		x.keys[id] = make(map[string]struct{})
+	}
+	x.ids[key][id] = struct{}{}
+	x.keys[id][key] = struct{}{}
+
+	return true
+}
+
+// Remove deletes the relation of id and key. It returns false, if they were
+// not related.
+func (x *Index) Remove(key string, id int) bool {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if _, ok := x.ids[key][id]; !ok {
+		return false
+	}
+
+	x.unrelate(key, id)
+	return true
+}
+
+// RemoveId deletes all relations of id and returns the keys it had.
+func (x *Index) RemoveId(id int) (keys []string) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	for key := range x.keys[id] {
+		keys = append(keys, key)
+		x.unrelate(key, id)
+	}
+	sort.Strings(keys)
+
+	return
+}
+
+// RemoveKey deletes all relations of key and returns the ids it had.
+func (x *Index) RemoveKey(key string) (ids []int) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	for id := range x.ids[key] {
+		ids = append(ids, id)
+		x.unrelate(key, id)
+	}
+	sort.Ints(ids)
+
+	return
+}
+
+func (x *Index) Contains(key string, id int) bool {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	_, ok := x.ids[key][id]
+	return ok
+}
+
+// Ids returns the sorted ids related to key.
+func (x *Index) Ids(key string) (ids []int) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	for id := range x.ids[key] {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return
+}
+
+// Keys returns the sorted keys related to id.
+func (x *Index) Keys(id int) (keys []string) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	for key := range x.keys[id] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return
+}
+
+// AllKeys returns the sorted keys with at least one id.
+func (x *Index) AllKeys() (keys []string) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	for key := range x.ids {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return
+}
+
+func (x *Index) Reset() {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	x.ids = make(map[string]map[int]struct{})
+	x.keys = make(map[int]map[string]struct{})
+}
+
+func (x *Index) unrelate(key string, id int) {
+	delete(x.ids[key], id)
+	if len(x.ids[key]) == 0 {
+		delete(x.ids, key)
+	}
+	delete(x.keys[id], key)
+	if len(x.keys[id]) == 0 {
+		delete(x.keys, id)
+	}
+}
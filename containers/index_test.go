@@ -0,0 +1,96 @@
+/**
+ * Copyright © 2024, Staufi Tech - Switzerland
+ * All rights reserved.
+ *
+ *   ________________________   ___ _     ________________  _  ____
+ *  / _____  _  ____________/  / __|_|   /_______________  | | ___/
+ * ( (____ _| |_ _____ _   _ _| |__ _      | |_____  ____| |_|_
+ *  \____ (_   _|____ | | | (_   __) |     | | ___ |/ ___)  _  \
+ *  _____) )| |_/ ___ | |_| | | |  | |     | | ____( (___| | | |
+ * (______/  \__)_____|____/  |_|  |_|     |_|_____)\____)_| |_|
+ *
+ *
+ *  THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+ *  AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+ *  IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+ *  ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+ *  LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+ *  CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+ *  SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+ *  INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+ *  CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+ *  ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+ *  POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package containers
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestContainersIndex(t *testing.T) {
+	x := NewIndex()
+
+	if !x.Add("tenant-a", 1) || !x.Add("tenant-a", 2) || !x.Add("building-3", 2) {
+		t.Error("add new relation returned false")
+	}
+	if x.Add("tenant-a", 1) {
+		t.Error("add existing relation returned true")
+	}
+
+	if ids := x.Ids("tenant-a"); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Error("unexpected ids: ", ids)
+	}
+	if keys := x.Keys(2); !reflect.DeepEqual(keys, []string{"building-3", "tenant-a"}) {
+		t.Error("unexpected keys: ", keys)
+	}
+	if !x.Contains("building-3", 2) || x.Contains("building-3", 1) {
+		t.Error("contains does not match")
+	}
+
+	if !x.Remove("tenant-a", 1) || x.Remove("tenant-a", 1) {
+		t.Error("unexpected remove result")
+	}
+
+	if keys := x.RemoveId(2); !reflect.DeepEqual(keys, []string{"building-3", "tenant-a"}) {
+		t.Error("unexpected removed keys: ", keys)
+	}
+	if keys := x.AllKeys(); len(keys) != 0 {
+		t.Error("empty keys are not removed: ", keys)
+	}
+
+	x.Add("a", 1)
+	x.Add("a", 3)
+	if ids := x.RemoveKey("a"); !reflect.DeepEqual(ids, []int{1, 3}) {
+		t.Error("unexpected removed ids: ", ids)
+	}
+	if keys := x.Keys(1); len(keys) != 0 {
+		t.Error("id still related: ", keys)
+	}
+}
+
+func TestContainersIndexConcurrent(t *testing.T) {
+	x := NewIndex()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				x.Add("all", id)
+				x.Ids("all")
+				x.Remove("all", id)
+			}
+			x.Add("all", id)
+		}(i)
+	}
+	wg.Wait()
+
+	if ids := x.Ids("all"); len(ids) != 8 {
+		t.Error("unexpected ids: ", ids)
+	}
+}
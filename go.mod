@@ -1,5 +1,5 @@
 module github.com/ChrIgiSta/go-utils
 
-go 1.20
+go 1.21
 
 require github.com/go-test/deep v1.1.0
@@ -31,6 +31,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -62,6 +63,7 @@ var (
 	logLevel      LogLevel = LevelInfo
 	formatString           = "2006-01-02 15:04:05.000000"
 	lastTimeStamp string
+	timeStampLock sync.Mutex
 
 	println func(in ...any) (int, error) = fmt.Println
 	file    *os.File
@@ -73,11 +75,15 @@ func init() {
 
 func formatLog(level LogLevel, module, logText string) string {
 
-	lastTimeStamp = time.Now().Format(formatString)
+	timeStamp := time.Now().Format(formatString)
+
+	timeStampLock.Lock()
+	lastTimeStamp = timeStamp
+	timeStampLock.Unlock()
 
 	return fmt.Sprintf("[%s]\t%s\t%s - %s",
 		logLevelToString[int(level)],
-		lastTimeStamp,
+		timeStamp,
 		strings.ToUpper(module),
 		logText)
 }
@@ -142,6 +148,8 @@ func OverwriteFormat(format string) {
 }
 
 func GetLastTimestamp() string {
+	timeStampLock.Lock()
+	defer timeStampLock.Unlock()
 
 	return lastTimeStamp
 }
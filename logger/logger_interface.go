@@ -32,3 +32,27 @@ type LoggingInteface interface {
 	Warn(module, logText string, args ...interface{}) error
 	Error(module, logText string, args ...interface{}) error
 }
+
+// Global passes to the package level logger, e.g. as default of a
+// LoggingInteface.
+type Global struct{}
+
+func (Global) Fine(module, logText string, args ...interface{}) error {
+	return Fine(module, logText, args...)
+}
+
+func (Global) Debug(module, logText string, args ...interface{}) error {
+	return Debug(module, logText, args...)
+}
+
+func (Global) Info(module, logText string, args ...interface{}) error {
+	return Info(module, logText, args...)
+}
+
+func (Global) Warn(module, logText string, args ...interface{}) error {
+	return Warn(module, logText, args...)
+}
+
+func (Global) Error(module, logText string, args ...interface{}) error {
+	return Error(module, logText, args...)
+}